@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kelsos/rotki-sync/internal/alert"
+	"github.com/kelsos/rotki-sync/internal/config"
+	"github.com/kelsos/rotki-sync/internal/logger"
+	"github.com/kelsos/rotki-sync/internal/paths"
+)
+
+// configEnvVar names the environment variable that points at the config file
+// when --config is not given.
+const configEnvVar = "ROTKI_SYNC_CONFIG"
+
+// configFileFromArgs resolves the config file path before cobra parses flags:
+// the file must be merged under the environment and flags, and flag defaults
+// are taken from the merged config. explicit reports whether the path was
+// asked for (--config or ROTKI_SYNC_CONFIG), in which case a missing file is
+// an error rather than silently ignored.
+func configFileFromArgs(args []string) (path string, explicit bool) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if v, ok := strings.CutPrefix(arg, "--config="); ok {
+			return v, true
+		}
+		if arg == "--config" && i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	if v := os.Getenv(configEnvVar); v != "" {
+		return v, true
+	}
+	return paths.ConfigFile(), false
+}
+
+// flagConfigKeys maps command-line flags to the config keys they override, so
+// `config show` can attribute a value to a flag.
+var flagConfigKeys = map[string]string{
+	"port":               "port",
+	"bin-path":           "bin_path",
+	"data-dir":           "data_dir",
+	"api-ready-timeout":  "api_ready_timeout",
+	"max-retries":        "max_retries",
+	"retry-delay":        "retry_delay",
+	"shutdown-timeout":   "shutdown_timeout",
+	"task-timeout":       "timeouts.task",
+	"backup-dir":         "backup_dir",
+	"only":               "steps.only",
+	"skip":               "steps.skip",
+	"user":               "users",
+	"exclude-user":       "exclude_users",
+	"report-json":        "report_json",
+	"metrics-file":       "metrics_file",
+	"schedule":           "daemon.schedule",
+	"keep-core":          "daemon.keep_core",
+	"attach":             "attach",
+	"force-logout":       "force_logout",
+	"workers":            "concurrency.workers",
+	"chain-workers":      "concurrency.chain_workers",
+	"batch-size":         "concurrency.batch_size",
+	"rate-limit-pause":   "rate_limits.pause",
+	"rate-limit-reorder": "rate_limits.reorder",
+	"events":             "events.format",
+	"events-output":      "events.output",
+}
+
+// markFlagSources records every config-backed flag set on cmd's command line
+// as SourceFlag.
+func markFlagSources(cmd *cobra.Command, cfg *config.Config) {
+	for name, key := range flagConfigKeys {
+		if f := cmd.Flags().Lookup(name); f != nil && f.Changed {
+			cfg.SetSource(key, config.SourceFlag)
+		}
+	}
+}
+
+// applyRuntimeConfig pushes config values consumed by packages that are not
+// handed the Config (alerting, log retention).
+func applyRuntimeConfig(cfg *config.Config) {
+	alert.SetWebhook(cfg.AlertWebhook)
+	logger.SetLogKeep(cfg.LogKeep)
+}
+
+// millisecondsValue is a flag value holding a duration expressed in whole
+// milliseconds on the command line (e.g. --retry-delay 2000).
+type millisecondsValue struct {
+	d *time.Duration
+}
+
+func (v millisecondsValue) String() string {
+	if v.d == nil {
+		return "0"
+	}
+	return strconv.FormatInt(v.d.Milliseconds(), 10)
+}
+
+func (v millisecondsValue) Set(s string) error {
+	ms, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid milliseconds %q", s)
+	}
+	*v.d = time.Duration(ms) * time.Millisecond
+	return nil
+}
+
+func (v millisecondsValue) Type() string { return "int" }
+
+// stepTimeoutsValue is a repeatable flag value holding step=duration time
+// limits (e.g. --step-timeout evm-decode=2h). Each one given is merged into
+// the configured limits and attributed to the flag; it is not listed in
+// flagConfigKeys because its config keys depend on the step ids.
+type stepTimeoutsValue struct {
+	cfg *config.Config
+}
+
+func (v stepTimeoutsValue) String() string {
+	if v.cfg == nil {
+		return ""
+	}
+	return config.FormatTimeouts(v.cfg.Timeouts.Steps)
+}
+
+func (v stepTimeoutsValue) Set(s string) error {
+	timeouts, err := config.ParseTimeouts(s)
+	if err != nil {
+		return err
+	}
+	v.cfg.SetStepTimeouts(timeouts, config.SourceFlag)
+	return nil
+}
+
+func (v stepTimeoutsValue) Type() string { return "step=duration" }
+
+// stepRetriesValue is a repeatable flag value holding step=count retry
+// overrides (e.g. --step-retries evm-decode=1), handled like
+// stepTimeoutsValue.
+type stepRetriesValue struct {
+	cfg *config.Config
+}
+
+func (v stepRetriesValue) String() string {
+	if v.cfg == nil {
+		return ""
+	}
+	return config.FormatRetries(v.cfg.Retries.Steps)
+}
+
+func (v stepRetriesValue) Set(s string) error {
+	retries, err := config.ParseRetries(s)
+	if err != nil {
+		return err
+	}
+	v.cfg.SetStepRetries(retries, config.SourceFlag)
+	return nil
+}
+
+func (v stepRetriesValue) Type() string { return "step=count" }
+
+// bindSyncFlags adds the flags that configure a sync run to cmd. Their
+// defaults are the values already merged from the config file and environment,
+// so a flag only overrides when given.
+func bindSyncFlags(cmd *cobra.Command, cfg *config.Config) {
+	cmd.Flags().IntVarP(&cfg.Port, "port", "p", cfg.Port, "Port to run rotki-core on")
+	cmd.Flags().StringVarP(&cfg.BinPath, "bin-path", "b", cfg.BinPath, "Path to rotki-core binary")
+	cmd.Flags().StringVarP(&cfg.DataDir, "data-dir", "", cfg.DataDir, "Directory where rotki's data resides")
+	cmd.Flags().IntVarP(&cfg.MaxRetries, "max-retries", "r", cfg.MaxRetries, "Maximum number of retries of an item that failed transiently (every item now, not only the balance fetch, so lowered from 10)")
+	cmd.Flags().VarP(millisecondsValue{&cfg.RetryDelay}, "retry-delay", "d", "Delay before the first retry in milliseconds, doubled for each later one")
+	cmd.Flags().Var(stepRetriesValue{cfg}, "step-retries", "Override --max-retries for a step (step=count, repeatable)")
+	cmd.Flags().IntVarP(&cfg.APIReadyTimeout, "api-ready-timeout", "t", cfg.APIReadyTimeout, "Maximum attempts to check API readiness")
+	cmd.Flags().StringSliceVar(&cfg.Steps.Only, "only", cfg.Steps.Only, "Run only these steps (comma-separated step ids)")
+	cmd.Flags().StringSliceVar(&cfg.Steps.Skip, "skip", cfg.Steps.Skip, "Skip these steps (comma-separated step ids)")
+	cmd.Flags().StringVar(&cfg.ReportJSON, "report-json", cfg.ReportJSON, "Also write the JSON run report to this path")
+	cmd.Flags().StringVar(&cfg.MetricsFile, "metrics-file", cfg.MetricsFile, "Write an OpenMetrics file describing the run to this path")
+	cmd.Flags().IntVar(&cfg.Concurrency.Workers, "workers", cfg.Concurrency.Workers, "Maximum concurrent transaction fetches")
+	cmd.Flags().IntVar(&cfg.Concurrency.ChainWorkers, "chain-workers", cfg.Concurrency.ChainWorkers, "Maximum concurrent transaction fetches per chain (0: up to --workers)")
+	cmd.Flags().Var(stepTimeoutsValue{cfg}, "step-timeout", "Give up on a step after this long (step=duration, repeatable)")
+	cmd.Flags().DurationVar(&cfg.Timeouts.Task, "task-timeout", cfg.Timeouts.Task, "Give up on an item whose rotki-core task runs longer than this (e.g. 30m)")
+	cmd.Flags().DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "How long an interrupted run waits for running tasks (e.g. 30s)")
+	cmd.Flags().BoolVar(&cfg.Resume, "resume", cfg.Resume, "Continue an interrupted run from its checkpoint")
+	cmd.Flags().BoolVar(&cfg.FullSync, "full", cfg.FullSync, "Refetch the full history instead of only what is new since the last run")
+	cmd.Flags().IntVar(&cfg.Concurrency.BatchSize, "batch-size", cfg.Concurrency.BatchSize, "Accounts per transaction fetch request (1: one request per account)")
+	cmd.Flags().DurationVar(&cfg.RateLimits.Pause, "rate-limit-pause", cfg.RateLimits.Pause, "Hold a new task back this long at most while a provider it depends on is rate-limited (0: never)")
+	cmd.Flags().BoolVar(&cfg.RateLimits.Reorder, "rate-limit-reorder", cfg.RateLimits.Reorder, "Work on the chains no rate-limited provider hit first")
+	cmd.Flags().StringVar(&cfg.Events.Format, "events", cfg.Events.Format, "Write a machine-readable event stream in this format (ndjson)")
+	cmd.Flags().StringVar(&cfg.Events.Output, "events-output", cfg.Events.Output, "Where --events writes: - for stdout, unix:<path> for a unix socket, or a file to append to")
+	bindUserFlags(cmd, cfg)
+	bindAttachFlags(cmd, cfg)
+}
+
+// bindAttachFlags adds the flags for using an already-running rotki-core to a
+// command that logs users in.
+func bindAttachFlags(cmd *cobra.Command, cfg *config.Config) {
+	bindAttachFlag(cmd, cfg)
+	cmd.Flags().BoolVar(&cfg.ForceLogout, "force-logout", cfg.ForceLogout, "With --attach, allow logging out sessions this run did not start")
+}
+
+// bindAttachFlag adds --attach to cmd.
+func bindAttachFlag(cmd *cobra.Command, cfg *config.Config) {
+	cmd.Flags().StringVar(&cfg.Attach, "attach", cfg.Attach, "Use the rotki-core running at this URL instead of starting one")
+}
+
+// bindUserFlags adds the user selection flags to cmd.
+func bindUserFlags(cmd *cobra.Command, cfg *config.Config) {
+	cmd.Flags().StringSliceVar(&cfg.Users, "user", cfg.Users, "Only process users matching these glob patterns (repeatable)")
+	cmd.Flags().StringSliceVar(&cfg.ExcludeUsers, "exclude-user", cfg.ExcludeUsers, "Never process users matching these glob patterns (repeatable)")
+}
+
+// configCmd builds the `config` command tree for inspecting the layered
+// configuration.
+func configCmd(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the rotki-sync configuration",
+	}
+	cmd.AddCommand(configShowCmd(cfg))
+	return cmd
+}
+
+func configShowCmd(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print the effective configuration and where each value came from",
+		Long: "Print the effective configuration after merging defaults, the config file,\n" +
+			"environment variables and flags (in increasing precedence). The output is\n" +
+			"valid TOML, annotated with the source of each value.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			printConfig(cfg)
+		},
+	}
+	bindSyncFlags(cmd, cfg)
+	return cmd
+}
+
+// printConfig writes the effective configuration as annotated TOML.
+func printConfig(cfg *config.Config) {
+	if file := cfg.File(); file != "" {
+		fmt.Printf("# config file: %s\n", file)
+	} else {
+		fmt.Printf("# no config file loaded (default location: %s)\n", paths.ConfigFile())
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, e := range cfg.Entries() {
+		fmt.Fprintf(w, "%s = %s\t# %s\n", e.Key, e.Value, e.Source)
+	}
+	_ = w.Flush()
+}
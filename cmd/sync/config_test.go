@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/config"
+	"github.com/kelsos/rotki-sync/internal/paths"
+)
+
+func TestConfigFileFromArgs(t *testing.T) {
+	t.Setenv(configEnvVar, "")
+	t.Setenv("ROTKI_SYNC_HOME", "/base")
+
+	cases := []struct {
+		name         string
+		args         []string
+		wantPath     string
+		wantExplicit bool
+	}{
+		{"default location", []string{"--no-tui"}, paths.ConfigFile(), false},
+		{"separate value", []string{"--no-tui", "--config", "/etc/rs.toml"}, "/etc/rs.toml", true},
+		{"equals form", []string{"preflight", "--config=/etc/rs.toml"}, "/etc/rs.toml", true},
+		{"after terminator ignored", []string{"--", "--config", "/etc/rs.toml"}, paths.ConfigFile(), false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path, explicit := configFileFromArgs(tc.args)
+			if path != tc.wantPath || explicit != tc.wantExplicit {
+				t.Fatalf("configFileFromArgs(%v) = (%q, %v), want (%q, %v)",
+					tc.args, path, explicit, tc.wantPath, tc.wantExplicit)
+			}
+		})
+	}
+
+	t.Run("environment variable", func(t *testing.T) {
+		t.Setenv(configEnvVar, "/env/rs.toml")
+		if path, explicit := configFileFromArgs(nil); path != "/env/rs.toml" || !explicit {
+			t.Fatalf("got (%q, %v)", path, explicit)
+		}
+	})
+}
+
+func TestMillisecondsValue(t *testing.T) {
+	d := 2 * time.Second
+	v := millisecondsValue{&d}
+	if v.String() != "2000" {
+		t.Fatalf("String() = %q, want 2000", v.String())
+	}
+	if err := v.Set("1500"); err != nil {
+		t.Fatal(err)
+	}
+	if d != 1500*time.Millisecond {
+		t.Fatalf("d = %v, want 1.5s", d)
+	}
+	if err := v.Set("soon"); err == nil {
+		t.Fatal("expected error for non-numeric value")
+	}
+}
+
+func TestStepTimeoutsValue(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.Timeouts.Steps = map[string]time.Duration{"evm-decode": time.Hour}
+	v := stepTimeoutsValue{cfg}
+
+	if err := v.Set("evm-decode=2h"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Set("exchange-trades=10m"); err != nil {
+		t.Fatal(err)
+	}
+	if got := v.String(); got != "evm-decode=2h0m0s,exchange-trades=10m0s" {
+		t.Fatalf("String() = %q", got)
+	}
+	if src := cfg.Source("timeouts.steps.exchange-trades"); src != config.SourceFlag {
+		t.Errorf("Source = %q, want flag", src)
+	}
+	if err := v.Set("evm-decode"); err == nil {
+		t.Fatal("expected error for a value without a duration")
+	}
+}
+
+func TestStepRetriesValue(t *testing.T) {
+	cfg := config.NewConfig()
+	v := stepRetriesValue{cfg}
+
+	if err := v.Set("evm-decode=1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Set("exchange-trades=5"); err != nil {
+		t.Fatal(err)
+	}
+	if got := v.String(); got != "evm-decode=1,exchange-trades=5" {
+		t.Fatalf("String() = %q", got)
+	}
+	if src := cfg.Source("retries.steps.evm-decode"); src != config.SourceFlag {
+		t.Errorf("Source = %q, want flag", src)
+	}
+	if err := v.Set("evm-decode=x"); err == nil {
+		t.Fatal("expected error for a count that is not a number")
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kelsos/rotki-sync/internal/alert"
+	"github.com/kelsos/rotki-sync/internal/config"
+	"github.com/kelsos/rotki-sync/internal/lock"
+	"github.com/kelsos/rotki-sync/internal/logger"
+	"github.com/kelsos/rotki-sync/internal/schedule"
+	"github.com/kelsos/rotki-sync/internal/services"
+)
+
+// daemonCmd builds the `daemon` command: a long-running alternative to the
+// systemd timer for hosts without systemd (e.g. containers). Its exit status
+// is set in exitCode.
+func daemonCmd(cfg *config.Config, exitCode *int) *cobra.Command {
+	var runNow bool
+
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Keep running and sync on a schedule",
+		Long: "Keep running and start a non-interactive sync whenever the schedule fires.\n" +
+			"The schedule uses the systemd OnCalendar syntax (a common subset, e.g.\n" +
+			"'*-*-* 09:30:00', 'Mon..Fri 06:00', 'hourly'). Runs never overlap: a slot\n" +
+			"that passes while a run is still going is skipped. rotki-core is started\n" +
+			"for each run unless --keep-core is set. A slot that finds another rotki-sync\n" +
+			"using the same data dir is skipped unless --wait is set.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			*exitCode = runDaemon(cfg, runNow)
+		},
+	}
+	bindSyncFlags(cmd, cfg)
+	cmd.Flags().StringVar(&cfg.Daemon.Schedule, "schedule", cfg.Daemon.Schedule, "OnCalendar-style schedule for runs")
+	cmd.Flags().BoolVar(&cfg.Daemon.KeepCore, "keep-core", cfg.Daemon.KeepCore, "Keep rotki-core running between runs")
+	cmd.Flags().BoolVar(&runNow, "now", false, "Also start a run immediately on startup")
+	bindWaitFlag(cmd)
+	return cmd
+}
+
+// runDaemon loops forever, running a sync each time the schedule fires, until
+// SIGINT/SIGTERM. A signal while waiting exits at once; during a run the run is
+// interrupted after its current step, a second signal cancels its running
+// tasks and a third exits immediately.
+func runDaemon(cfg *config.Config, runNow bool) int {
+	events, closeEvents, err := openEventStream(cfg.Events)
+	if err != nil {
+		logger.Error("%v", err)
+		return exitStepFailure
+	}
+	defer closeEvents()
+
+	logger.Init()
+	validateSyncConfig(cfg)
+
+	sched, err := schedule.Parse(cfg.Daemon.Schedule)
+	if err != nil {
+		logger.Error("%v", err)
+		return exitStepFailure
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	d := &daemon{cfg: cfg, signals: signals, events: events}
+	defer d.stopCore()
+
+	logger.Info("Daemon started (schedule %q, keep rotki-core running: %v)", sched, cfg.Daemon.KeepCore)
+	if runNow && !d.run() {
+		return exitOK
+	}
+
+	for {
+		next, ok := sched.Next(time.Now())
+		if !ok {
+			logger.Error("Schedule %q never fires again; exiting", sched)
+			return exitStepFailure
+		}
+		logger.Info("Next run at %s", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case sig := <-signals:
+			timer.Stop()
+			logger.Info("Received %s; stopping daemon", sig)
+			return exitOK
+		case <-timer.C:
+		}
+
+		if !d.run() {
+			return exitOK
+		}
+	}
+}
+
+// daemon holds the state kept across scheduled runs.
+type daemon struct {
+	cfg     *config.Config
+	signals chan os.Signal
+	// events writes the event stream of every run; nil without --events.
+	events services.Observer
+
+	mu sync.Mutex
+	// session is the running rotki-core: kept between runs with --keep-core,
+	// otherwise only set while a run is in progress.
+	session *coreSession
+	// runLock is held for as long as session is set.
+	runLock *lock.Lock
+	// interrupted is why the daemon is stopping, once a signal arrived during
+	// a run.
+	interrupted string
+}
+
+// run performs one scheduled sync in the background while watching for
+// signals. It returns false when the daemon should stop.
+func (d *daemon) run() bool {
+	done := make(chan int, 1)
+	go func() { done <- d.syncOnce() }()
+
+	received := 0
+	for {
+		select {
+		case code := <-done:
+			logger.Info("Scheduled run finished (exit %d)", code)
+			return received == 0
+		case sig := <-d.signals:
+			received++
+			switch received {
+			case 1:
+				logger.Info("Received %s; interrupting the current run (repeat to cancel its running tasks)", sig)
+			case 2:
+				logger.Warn("Received %s again; canceling the running tasks (repeat to exit now)", sig)
+			default:
+				logger.Warn("Received %s again; exiting without waiting for the run", sig)
+				d.stopCore()
+				os.Exit(exitInterrupted)
+			}
+			d.interrupt(signalReason(sig))
+		}
+	}
+}
+
+// interrupt interrupts the current run, or the one about to start, with reason
+// (see services.SyncService.Interrupt).
+func (d *daemon) interrupt(reason string) {
+	d.mu.Lock()
+	session := d.session
+	if d.interrupted == "" {
+		d.interrupted = reason
+	}
+	d.mu.Unlock()
+
+	if session != nil {
+		session.service.Interrupt(reason)
+	}
+}
+
+// interruption returns why the daemon is stopping, or "".
+func (d *daemon) interruption() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.interrupted
+}
+
+// syncOnce runs one sync, starting rotki-core unless a kept session is alive.
+func (d *daemon) syncOnce() int {
+	session, err := d.coreSession()
+	var held *lock.HeldError
+	if errors.As(err, &held) {
+		// Another run is already syncing this data dir; this slot is redundant.
+		logger.Warn("Skipping scheduled run: %v", err)
+		return exitOK
+	}
+	if err != nil {
+		logger.Error("Scheduled run could not start: %v", err)
+		alert.Notify("rotki-sync: scheduled run could not start", err.Error())
+		return exitStepFailure
+	}
+	if !d.cfg.Daemon.KeepCore {
+		defer d.stopCore()
+	}
+	// A signal that arrived while rotki-core was starting found no session
+	// to interrupt.
+	if reason := d.interruption(); reason != "" {
+		logger.Warn("Not starting the scheduled run (%s)", reason)
+		return exitInterrupted
+	}
+
+	info, err := session.service.GetInfo()
+	if err != nil {
+		logger.Error("Failed to fetch rotki-core version: %v", err)
+		return exitStepFailure
+	}
+	logger.Info("Starting scheduled run against rotki-core %s", info.Version.OurVersion)
+	return runUsers(d.cfg, session.service, info.Version.OurVersion)
+}
+
+// coreSession returns the kept rotki-core when it still responds, otherwise
+// takes the run lock and starts a new one.
+func (d *daemon) coreSession() (*coreSession, error) {
+	d.mu.Lock()
+	session := d.session
+	d.mu.Unlock()
+
+	if session != nil {
+		if session.service.WaitForAPIReady() {
+			return session, nil
+		}
+		logger.Warn("Kept rotki-core is no longer responding; restarting it")
+		d.stopCore()
+	}
+
+	runLock, err := acquireRunLock(d.cfg, "daemon")
+	if err != nil {
+		return nil, err
+	}
+	session, err = startCoreSession(d.cfg)
+	if err != nil {
+		runLock.Release()
+		return nil, err
+	}
+	if d.events != nil {
+		session.service.Subscribe(d.events)
+	}
+	d.mu.Lock()
+	d.session = session
+	d.runLock = runLock
+	d.mu.Unlock()
+	return session, nil
+}
+
+// stopCore stops the running rotki-core, if any, and releases the run lock.
+func (d *daemon) stopCore() {
+	d.mu.Lock()
+	session, runLock := d.session, d.runLock
+	d.session, d.runLock = nil, nil
+	d.mu.Unlock()
+
+	if session != nil {
+		session.close()
+	}
+	runLock.Release()
+}
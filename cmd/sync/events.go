@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/kelsos/rotki-sync/internal/config"
+	"github.com/kelsos/rotki-sync/internal/services"
+)
+
+// unixSocketPrefix marks an events output that is a unix socket to connect to
+// rather than a file.
+const unixSocketPrefix = "unix:"
+
+// openEventStream opens the event stream configured by events and returns the
+// observer writing it and a function writing the pending events and closing
+// its output. The observer is nil when no stream is configured.
+//
+// A stream to stdout takes stdout over: os.Stdout is pointed at stderr, so the
+// console log, the version prompt and rotki-core's own output all go there. It
+// must therefore run before the logger is set up.
+func openEventStream(events config.EventsConfig) (services.Observer, func(), error) {
+	if !events.Enabled() {
+		return nil, func() {}, nil
+	}
+	if events.ToStdout() {
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		observer, stop := services.NewEventWriter(stdout)
+		return observer, stop, nil
+	}
+
+	w, err := openEventOutput(events.Output)
+	if err != nil {
+		return nil, nil, err
+	}
+	observer, stop := services.NewEventWriter(w)
+	return observer, func() {
+		stop()
+		_ = w.Close()
+	}, nil
+}
+
+// openEventOutput connects to the unix socket of a "unix:<path>" output, or
+// opens the file at output for appending, creating it if needed.
+func openEventOutput(output string) (io.WriteCloser, error) {
+	if path, ok := strings.CutPrefix(output, unixSocketPrefix); ok {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to event socket %s: %w", path, err)
+		}
+		return conn, nil
+	}
+
+	f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event output %s: %w", output, err)
+	}
+	return f, nil
+}
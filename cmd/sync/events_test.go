@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenEventOutputAppendsToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	for _, line := range []string{"first\n", "second\n"} {
+		w, err := openEventOutput(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "first\nsecond\n" {
+		t.Errorf("file = %q, want both writes appended", got)
+	}
+}
+
+func TestOpenEventOutputUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- ""
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	w, err := openEventOutput(unixSocketPrefix + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("{\"event\":\"login\"}\n")); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+
+	if got := <-received; got != "{\"event\":\"login\"}\n" {
+		t.Errorf("socket received %q", got)
+	}
+}
+
+func TestOpenEventOutputMissingSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.sock")
+	if _, err := openEventOutput(unixSocketPrefix + path); err == nil {
+		t.Error("expected an error for a socket nobody listens on")
+	}
+}
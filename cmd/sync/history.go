@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kelsos/rotki-sync/internal/history"
+	"github.com/kelsos/rotki-sync/internal/services"
+)
+
+// historyTimeLayout renders run timestamps in local time for the history views.
+const historyTimeLayout = "2006-01-02 15:04:05"
+
+// historyCmd builds the `history` command tree over the local run history.
+// Without a subcommand it lists the most recent runs.
+func historyCmd() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "List past sync runs",
+		Long: "List past sync runs recorded in the local run history, newest first.\n" +
+			"Use `history show <id>` for one run's details and `history streaks` to\n" +
+			"see which steps keep failing.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runs, err := history.Default().Load()
+			if err != nil {
+				return err
+			}
+			if len(runs) == 0 {
+				fmt.Println("no runs recorded yet")
+				return nil
+			}
+			printRunList(runs, limit)
+			return nil
+		},
+	}
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Number of runs to list (0 lists all)")
+	cmd.AddCommand(historyShowCmd(), historyStreaksCmd())
+	return cmd
+}
+
+func historyShowCmd() *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "show <run-id>",
+		Short: "Show one recorded run in detail",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			run, ok, err := history.Default().Find(args[0])
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("no run %q in history (list runs with: rotki-sync history)", args[0])
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(run)
+			}
+			printRun(run)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the stored run report as JSON")
+	return cmd
+}
+
+func historyStreaksCmd() *cobra.Command {
+	var minRuns int
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "streaks",
+		Short: "Show steps that failed several runs in a row",
+		Long: "For every user and step of a data dir or backend, count how many of the most recent runs in a row\n" +
+			"ended the same way. A long failing streak is a persistent break; a short\n" +
+			"one among successes is flakiness. Skipped steps do not break a streak.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runs, err := history.Default().Load()
+			if err != nil {
+				return err
+			}
+
+			streaks := history.Streaks(runs)
+			// Name the scope only when the history covers more than one.
+			scoped := false
+			for _, streak := range streaks {
+				scoped = scoped || streak.Scope != streaks[0].Scope
+			}
+
+			shown := 0
+			for _, streak := range streaks {
+				if streak.Runs < minRuns || (!all && streak.Status == services.StatusOK) {
+					continue
+				}
+				shown++
+				verb := "has failed"
+				switch streak.Status {
+				case services.StatusOK:
+					verb = "has succeeded"
+				case services.StatusTimedOut:
+					verb = "has timed out"
+				}
+				user := streak.Username
+				if scoped {
+					user += " (" + scopeLabel(streak.Scope) + ")"
+				}
+				fmt.Printf("%s for user %s %s %d run(s) in a row (since %s)\n",
+					streak.StepName, user, verb, streak.Runs,
+					streak.Since.Local().Format(historyTimeLayout))
+				if streak.LastError != "" {
+					fmt.Printf("    last error: %s\n", streak.LastError)
+				}
+			}
+			if shown == 0 {
+				fmt.Printf("no streaks of %d or more run(s)\n", minRuns)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&minRuns, "min", 2, "Only show streaks of at least this many runs")
+	cmd.Flags().BoolVar(&all, "all", false, "Include success streaks, not just failures")
+	return cmd
+}
+
+// printRunList writes the newest limit runs as a table.
+func printRunList(runs []services.ReportDocument, limit int) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTARTED\tDURATION\tSTATUS\tUSERS\tSCOPE\tCORE")
+	for i, shown := len(runs)-1, 0; i >= 0 && (limit <= 0 || shown < limit); i, shown = i-1, shown+1 {
+		run := runs[i]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			run.ID,
+			run.StartedAt.Local().Format(historyTimeLayout),
+			formatSeconds(run.DurationSeconds),
+			run.Status,
+			len(run.Users),
+			scopeLabel(run.Scope),
+			run.CoreVersion)
+	}
+	_ = w.Flush()
+}
+
+// printRun writes one run's per-user, per-step outcome.
+func printRun(run services.ReportDocument) {
+	fmt.Printf("run %s: %s\n", run.ID, run.Status)
+	fmt.Printf("  started:  %s\n", run.StartedAt.Local().Format(historyTimeLayout))
+	fmt.Printf("  duration: %s\n", formatSeconds(run.DurationSeconds))
+	fmt.Printf("  scope:    %s\n", scopeLabel(run.Scope))
+	if run.CoreVersion != "" {
+		fmt.Printf("  core:     %s\n", run.CoreVersion)
+	}
+	if run.FatalError != "" {
+		fmt.Printf("  FATAL:    %s\n", run.FatalError)
+	}
+
+	for _, user := range run.Users {
+		fmt.Printf("\n  user %s: %s (%s)\n", user.Username, user.Status, formatSeconds(user.DurationSeconds))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, step := range user.Steps {
+			detail := ""
+			switch {
+			case step.Error != "":
+				detail = step.Error
+			case step.Ok+step.Failed > 0:
+				detail = fmt.Sprintf("%d ok / %d failed", step.Ok, step.Failed)
+			}
+			fmt.Fprintf(w, "    [%s]\t%s\t%s\t%s\n", step.Status, step.Name, formatSeconds(step.DurationSeconds), detail)
+		}
+		_ = w.Flush()
+	}
+}
+
+// scopeLabel renders a run's scope, which runs recorded before scopes were
+// kept do not have.
+func scopeLabel(scope string) string {
+	if scope == "" {
+		return "-"
+	}
+	return scope
+}
+
+// formatSeconds renders fractional seconds as a rounded duration (e.g. "1m32s").
+func formatSeconds(s float64) string {
+	return (time.Duration(s * float64(time.Second))).Round(time.Second).String()
+}
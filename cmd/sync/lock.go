@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/kelsos/rotki-sync/internal/config"
+	"github.com/kelsos/rotki-sync/internal/lock"
+)
+
+// waitForLock makes a command queue behind another run holding the data dir's
+// run lock instead of failing.
+var waitForLock bool
+
+// bindWaitFlag registers --wait on a command that takes the run lock.
+func bindWaitFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&waitForLock, "wait", false, "Wait for another run on the same data dir to finish instead of failing")
+}
+
+// acquireRunLock takes the run lock for cfg.DataDir (or the attached backend)
+// on behalf of command. The caller must Release it once rotki-core has been
+// stopped.
+func acquireRunLock(cfg *config.Config, command string) (*lock.Lock, error) {
+	path := lock.PathFor(cfg.DataDir)
+	if cfg.Attached() {
+		path = lock.PathForURL(cfg.BaseURL)
+	}
+	return lock.Acquire(path, command, waitForLock)
+}
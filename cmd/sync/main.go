@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
@@ -15,6 +14,7 @@ import (
 	"github.com/kelsos/rotki-sync/internal/config"
 	"github.com/kelsos/rotki-sync/internal/download"
 	"github.com/kelsos/rotki-sync/internal/logger"
+	"github.com/kelsos/rotki-sync/internal/models"
 	"github.com/kelsos/rotki-sync/internal/process"
 	"github.com/kelsos/rotki-sync/internal/services"
 	"github.com/kelsos/rotki-sync/internal/tui"
@@ -35,6 +35,8 @@ const (
 	exitOK            = 0 // all core steps did work
 	exitStepFailure   = 1 // a core step ran but had zero successes
 	exitContractBreak = 2 // a depended-on endpoint is gone (preflight or mid-run 404)
+	exitInterrupted   = 3 // stopped early by a signal or by closing the TUI
+	exitTimedOut      = 4 // nothing failed, but a step or item ran into its time limit
 )
 
 // backupProgressPrinter returns a ProgressFunc suitable for the backup
@@ -64,8 +66,19 @@ func backupProgressPrinter() backup.ProgressFunc {
 
 // runSync wires up rotki-core and runs the sync flow with or without the TUI.
 // It returns a process exit code so a non-interactive (cron) run can signal a
-// failed or aborted sync instead of always exiting 0.
-func runSync(cfg *config.Config, disableTUI, skipConfirm bool) int {
+// failed or aborted sync instead of always exiting 0. A dry run only prints
+// the plan and never uses the TUI. With --events the run's events are also
+// written as a stream (see openEventStream).
+func runSync(cfg *config.Config, disableTUI, skipConfirm, dryRun bool) int {
+	// An event stream on stdout leaves no room for the TUI.
+	disableTUI = disableTUI || dryRun || cfg.Events.ToStdout()
+	events, closeEvents, err := openEventStream(cfg.Events)
+	if err != nil {
+		// The logger is set up only after the stream took stdout over.
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitStepFailure
+	}
+
 	if !disableTUI {
 		if err := logger.InitFileOnly(); err != nil {
 			logger.Init()
@@ -75,85 +88,234 @@ func runSync(cfg *config.Config, disableTUI, skipConfirm bool) int {
 	} else {
 		logger.Init()
 	}
+	// Closed before the logger so its warnings about dropped events are kept.
+	defer closeEvents()
 
-	cfg.SetBaseURL()
+	validateSyncConfig(cfg)
 
-	if err := cfg.Validate(); err != nil {
-		logger.Fatal("Invalid configuration: %v", err)
+	runLock, err := acquireRunLock(cfg, "sync")
+	if err != nil {
+		logger.Error("%v", err)
+		return exitStepFailure
 	}
+	defer runLock.Release()
 
-	rotki, err := process.StartRotkiCore(cfg.BinPath, cfg.Port, cfg.APIReadyTimeout, cfg.DataDir)
+	session, err := startCoreSession(cfg)
 	if err != nil {
-		logger.Fatal("Failed to start rotki-core: %v", err)
+		// Returned rather than fatal so the deferred lock release runs.
+		logger.Error("%v", err)
+		return exitStepFailure
 	}
-
-	syncService := services.NewSyncService(cfg)
-	defer syncService.Cleanup()
-
-	if !syncService.WaitForAPIReady() {
-		logger.Fatal("API failed to become ready")
+	if events != nil {
+		session.service.Subscribe(events)
 	}
 
-	if !confirmRotkiVersion(syncService, skipConfirm) {
+	info, ok := confirmRotkiVersion(session.service, skipConfirm)
+	if !ok {
 		logger.Info("Sync canceled by user")
-		stopRotki(rotki)
+		session.close()
 		return exitOK
 	}
 
-	// Preflight: catch a removed/renamed endpoint before doing any work, so a
-	// contract break is an immediate, loud failure rather than a silent month
-	// of missing data.
-	if err := syncService.PreflightEndpoints(); err != nil {
-		logger.Error("Endpoint preflight failed: %v", err)
-		alert.Notify("rotki-sync: endpoint preflight failed", err.Error())
-		stopRotki(rotki)
-		return exitContractBreak
+	if dryRun {
+		exitCode := runDryRun(session.service)
+		session.close()
+		return exitCode
 	}
 
-	exitCode := exitOK
+	if disableTUI {
+		stopSignals := interruptOnSignal(session.service)
+		exitCode := runUsers(cfg, session.service, info.Version.OurVersion)
+		stopSignals()
 
-	if !disableTUI {
-		monitor := tui.NewSyncMonitor(syncService)
-		if err := monitor.Start(); err != nil {
-			logger.Fatal("Failed to start TUI monitor: %v", err)
-		}
-		if err := monitor.Run(); err != nil {
+		// The sync is done; stop rotki-core and return so the process exits.
+		// rotki-core does not exit on its own, so waiting on it would hang an
+		// unattended run (e.g. the systemd timer).
+		session.close()
+		return exitCode
+	}
+
+	if exitCode, ok := preflightRun(cfg, session.service, info.Version.OurVersion); !ok {
+		session.close()
+		return exitCode
+	}
+
+	monitor := tui.NewSyncMonitor(session.service)
+	if err := monitor.Start(); err != nil {
+		logger.Error("Failed to start TUI monitor: %v", err)
+		session.close()
+		return exitStepFailure
+	}
+	report, err := monitor.Run()
+	if report == nil {
+		if err != nil {
 			logger.Error("Error running TUI monitor: %v", err)
 		}
-		// The TUI has exited because the user pressed 'q' (or ctrl+c). Stop
-		// rotki-core and return immediately rather than waiting on it, so the
-		// process terminates completely. Any still-running sync work is in a
-		// background goroutine that ends when the process exits.
-		stopRotki(rotki)
+		// The user quit the TUI (bubbletea turns SIGINT/SIGTERM into a quit)
+		// before the sync finished. Interrupt the sync and wait for it to
+		// wind down; signals from here on work as in a non-interactive run.
+		logger.Warn("TUI closed before the sync finished; interrupting the run")
+		fmt.Fprintf(os.Stderr, "Stopping the sync (waiting up to %s for running tasks, Ctrl+C to cancel them)...\n",
+			cfg.ShutdownTimeout)
+		stopSignals := interruptOnSignal(session.service)
+		report, err = monitor.Interrupt()
+		stopSignals()
+	}
+	exitCode := finishRun(cfg, report, err, info.Version.OurVersion)
+	session.close()
+	return exitCode
+}
+
+// validateSyncConfig derives the base URL and exits on a configuration a sync
+// cannot run with.
+func validateSyncConfig(cfg *config.Config) {
+	cfg.SetBaseURL()
+
+	if err := cfg.Validate(); err != nil {
+		logger.Fatal("Invalid configuration: %v", err)
+	}
+	if err := services.ValidateStepSelection(cfg.Steps); err != nil {
+		logger.Fatal("Invalid step selection: %v", err)
+	}
+	if err := services.ValidateStepTimeouts(cfg.Timeouts); err != nil {
+		logger.Fatal("Invalid step timeouts: %v", err)
+	}
+	if err := services.ValidateStepRetries(cfg.Retries); err != nil {
+		logger.Fatal("Invalid step retries: %v", err)
+	}
+}
+
+// coreSession is a running rotki-core and the sync service talking to it.
+type coreSession struct {
+	// rotki is the process started for this session; nil when attached to a
+	// backend managed elsewhere.
+	rotki   *process.RotkiProcess
+	service *services.SyncService
+}
+
+// startCoreSession starts rotki-core, or with --attach connects to the running
+// one, and waits for its API to become ready.
+func startCoreSession(cfg *config.Config) (*coreSession, error) {
+	session := &coreSession{}
+	if cfg.Attached() {
+		logger.Info("Attaching to rotki-core at %s", cfg.BaseURL)
+	} else {
+		rotki, err := process.StartRotkiCore(cfg.BinPath, cfg.Port, cfg.APIReadyTimeout, cfg.DataDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start rotki-core: %w", err)
+		}
+		session.rotki = rotki
+	}
+
+	session.service = services.NewSyncService(cfg)
+	if !session.service.WaitForAPIReady() {
+		session.close()
+		return nil, fmt.Errorf("API failed to become ready")
+	}
+	return session, nil
+}
+
+// close stops the sync service and the rotki-core it started, if any. An
+// attached backend is left running.
+func (s *coreSession) close() {
+	s.service.Cleanup()
+	if s.rotki != nil {
+		stopRotki(s.rotki)
+	}
+}
+
+// runUsers performs one non-interactive sync run against a ready backend:
+// preflight, every selected user, then the run report, metrics and alerts. It
+// returns the run's exit code.
+func runUsers(cfg *config.Config, syncService *services.SyncService, coreVersion string) int {
+	if exitCode, ok := preflightRun(cfg, syncService, coreVersion); !ok {
 		return exitCode
 	}
 
 	report, err := syncService.ProcessAllUsers()
+	return finishRun(cfg, report, err, coreVersion)
+}
+
+// runDryRun plans a run against a ready backend and prints the async tasks it
+// would issue per user. Users are logged in and out, but nothing is fetched,
+// decoded or snapshotted, and no run report, history entry, metrics or alert
+// is written.
+func runDryRun(syncService *services.SyncService) int {
+	if err := syncService.PreflightEndpoints(); err != nil {
+		logger.Error("Endpoint preflight failed: %v", err)
+		return exitContractBreak
+	}
+
+	plan, err := syncService.PlanAllUsers()
 	if err != nil {
-		logger.Error("Error processing users: %v", err)
+		logger.Error("Error planning users: %v", err)
+		return exitStepFailure
+	}
+
+	fmt.Println(plan.Summary())
+	if plan.HasErrors() {
+		return exitStepFailure
 	}
-	exitCode = reportExitCode(report)
+	return exitOK
+}
+
+// preflightRun catches a removed/renamed endpoint before doing any work, so a
+// contract break is an immediate, loud failure rather than a silent month of
+// missing data. On failure it records an aborted run and returns its exit code
+// and false.
+func preflightRun(cfg *config.Config, syncService *services.SyncService, coreVersion string) (int, bool) {
+	if err := syncService.PreflightEndpoints(); err != nil {
+		logger.Error("Endpoint preflight failed: %v", err)
+		alert.Notify("rotki-sync: endpoint preflight failed", err.Error())
+		report := services.NewRunReport()
+		report.CoreVersion = coreVersion
+		report.FatalErr = err
+		report.Finish()
+		writeRunReport(cfg, report, exitContractBreak)
+		return exitContractBreak, false
+	}
+	return exitOK, true
+}
+
+// finishRun writes the report of a completed run, logs its summary and sends
+// the success or failure alerts. It returns the run's exit code. Interactive
+// and non-interactive runs both end here.
+func finishRun(cfg *config.Config, report *services.RunReport, processErr error, coreVersion string) int {
+	if processErr != nil {
+		logger.Error("Error processing users: %v", processErr)
+	}
+	report.CoreVersion = coreVersion
+	exitCode := reportExitCode(report)
+	writeRunReport(cfg, report, exitCode)
 	logger.Info("%s", report.Summary())
-	if exitCode == exitOK {
+	switch exitCode {
+	case exitOK:
 		logger.Info("Sync completed successfully")
 		alert.Desktop("rotki-sync", fmt.Sprintf("Sync completed successfully (%d user(s))", len(report.Users)), alert.UrgencyNormal)
-	} else {
+	case exitInterrupted:
+		// Stopping a run is deliberate (a shutdown, systemctl stop), so it
+		// does not page anyone.
+		logger.Warn("Sync interrupted (%s); continue with --resume", report.Interrupted)
+		alert.Desktop("rotki-sync", "Sync interrupted; continue with --resume", alert.UrgencyNormal)
+	case exitTimedOut:
+		logger.Warn("Sync completed, but some steps or items ran into their time limit (exit %d)", exitCode)
+		alert.Notify(
+			fmt.Sprintf("rotki-sync: run timed out (exit %d)", exitCode),
+			report.Summary())
+		alert.Desktop("rotki-sync", fmt.Sprintf("Sync timed out (exit %d) — see logs", exitCode), alert.UrgencyNormal)
+	default:
 		logger.Error("Sync completed with failures (exit %d)", exitCode)
 		alert.Notify(
 			fmt.Sprintf("rotki-sync: run failed (exit %d)", exitCode),
 			report.Summary())
 		alert.Desktop("rotki-sync", fmt.Sprintf("Sync failed (exit %d) — see logs", exitCode), alert.UrgencyCritical)
 	}
-
-	// The sync is done; stop rotki-core and return so the process exits. rotki-core
-	// does not exit on its own, so waiting on it would hang an unattended run (e.g.
-	// the systemd timer).
-	stopRotki(rotki)
 	return exitCode
 }
 
 // reportExitCode maps a run report to a process exit code: a contract break
-// takes priority, then any other step failure, otherwise success.
+// takes priority, then an interruption, then any other step failure, then a
+// time limit running out, otherwise success.
 func reportExitCode(report *services.RunReport) int {
 	if report == nil {
 		return exitStepFailure
@@ -161,9 +323,15 @@ func reportExitCode(report *services.RunReport) int {
 	if report.FatalErr != nil {
 		return exitContractBreak
 	}
+	if report.Interrupted != "" {
+		return exitInterrupted
+	}
 	if report.HasFailures() {
 		return exitStepFailure
 	}
+	if report.HasTimeouts() {
+		return exitTimedOut
+	}
 	return exitOK
 }
 
@@ -175,13 +343,13 @@ func stopRotki(rotki *process.RotkiProcess) {
 }
 
 // confirmRotkiVersion prompts the user to confirm the running rotki-core
-// version. Returns true when the user accepts. When skipPrompt is true the
-// version is logged and the function returns true without asking.
-func confirmRotkiVersion(syncService *services.SyncService, skipPrompt bool) bool {
+// version. It returns the backend info and true when the user accepts. When
+// skipPrompt is true the version is logged and it returns true without asking.
+func confirmRotkiVersion(syncService *services.SyncService, skipPrompt bool) (*models.Info, bool) {
 	info, err := syncService.GetInfo()
 	if err != nil {
 		logger.Error("Failed to fetch rotki-core version: %v", err)
-		return false
+		return nil, false
 	}
 
 	fmt.Printf("rotki-core version: %s\n", info.Version.OurVersion)
@@ -197,7 +365,7 @@ func confirmRotkiVersion(syncService *services.SyncService, skipPrompt bool) boo
 	}
 
 	if skipPrompt {
-		return true
+		return info, true
 	}
 
 	fmt.Print("Continue sync against this backend? [y/N]: ")
@@ -205,13 +373,13 @@ func confirmRotkiVersion(syncService *services.SyncService, skipPrompt bool) boo
 	answer, err := reader.ReadString('\n')
 	if err != nil {
 		logger.Error("Failed to read confirmation: %v", err)
-		return false
+		return info, false
 	}
 	switch strings.ToLower(strings.TrimSpace(answer)) {
 	case "y", "yes":
-		return true
+		return info, true
 	default:
-		return false
+		return info, false
 	}
 }
 
@@ -226,13 +394,19 @@ func main() {
 	// Initialize basic console logger (will be reconfigured later based on flags)
 	logger.Init()
 
-	// Initialize configuration with defaults
+	// Initialize configuration: defaults, then the config file, then the
+	// environment. Flags are bound below with the merged values as defaults, so
+	// they take precedence only when given.
 	cfg := config.NewConfig()
+	configPath, explicitConfig := configFileFromArgs(os.Args[1:])
+	if err := cfg.LoadFile(configPath, explicitConfig); err != nil {
+		logger.Fatal("Invalid config file: %v", err)
+	}
 	cfg.LoadFromEnvironment()
 
-	var backupDir string
 	var disableTUI bool
 	var skipConfirm bool
+	var dryRun bool
 
 	// exitCode is set by commands that need to control the process exit status
 	// (e.g. a sync that failed or aborted). It is applied after Execute so
@@ -244,10 +418,18 @@ func main() {
 		Short:   "A CLI tool for syncing rotki data",
 		Long:    `rotki-sync is a CLI tool for syncing rotki data from various sources.`,
 		Version: version,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			markFlagSources(cmd, cfg)
+			applyRuntimeConfig(cfg)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
-			exitCode = runSync(cfg, disableTUI, skipConfirm)
+			exitCode = runSync(cfg, disableTUI, skipConfirm, dryRun)
 		},
 	}
+	// The config file path is resolved before flag parsing (see
+	// configFileFromArgs); the flag is registered so cobra accepts it and
+	// documents it.
+	rootCmd.PersistentFlags().String("config", configPath, "Path to the TOML config file (env: "+configEnvVar+")")
 	// Richer `--version` output than cobra's default one-liner, and a matching
 	// `version` subcommand for callers that prefer it.
 	rootCmd.SetVersionTemplate(versionString() + "\n")
@@ -274,6 +456,8 @@ func main() {
 	preflightCmd.Flags().StringVarP(&cfg.BinPath, "bin-path", "b", cfg.BinPath, "Path to rotki-core binary")
 	preflightCmd.Flags().StringVarP(&cfg.DataDir, "data-dir", "", cfg.DataDir, "Directory where rotki's data resides")
 	preflightCmd.Flags().IntVarP(&cfg.APIReadyTimeout, "api-ready-timeout", "t", cfg.APIReadyTimeout, "Maximum attempts to check API readiness")
+	bindAttachFlag(preflightCmd, cfg)
+	bindWaitFlag(preflightCmd)
 
 	// Add a download command
 	downloadCmd := &cobra.Command{
@@ -293,41 +477,29 @@ func main() {
 		Short: "Create a backup of rotki's data directory",
 		Long:  `Create a backup of rotki's data directory, including specific files and directories.`,
 		Run: func(cmd *cobra.Command, args []string) {
-			logger.Init() // Always use console for subcommands
-			progress := backupProgressPrinter()
-			backupFile, err := backup.CreateBackup(cfg.DataDir, backupDir, progress)
-			if err != nil {
-				logger.Fatal("Failed to create backup: %v", err)
-			}
-			logger.Info("Backup created successfully: %s", backupFile)
+			exitCode = runBackup(cfg)
 		},
 	}
-	backupCmd.Flags().StringVarP(&backupDir, "backup-dir", "", cfg.BackupDir, "Directory where the backup will be stored")
+	backupCmd.Flags().StringVarP(&cfg.BackupDir, "backup-dir", "", cfg.BackupDir, "Directory where the backup will be stored")
+	bindWaitFlag(backupCmd)
 
 	// Add flags that bind to the configuration
-	rootCmd.Flags().IntVarP(&cfg.Port, "port", "p", cfg.Port, "Port to run rotki-core on")
-	rootCmd.Flags().StringVarP(&cfg.BinPath, "bin-path", "b", cfg.BinPath, "Path to rotki-core binary")
-	rootCmd.Flags().StringVarP(&cfg.DataDir, "data-dir", "", cfg.DataDir, "Directory where rotki's data resides")
-	rootCmd.Flags().IntVarP(&cfg.MaxRetries, "max-retries", "r", cfg.MaxRetries, "Maximum number of balance fetch retries")
-
-	var retryDelayMs int
-	rootCmd.Flags().IntVarP(&retryDelayMs, "retry-delay", "d", int(cfg.RetryDelay/time.Millisecond), "Delay between retries in milliseconds")
-	rootCmd.Flags().IntVarP(&cfg.APIReadyTimeout, "api-ready-timeout", "t", cfg.APIReadyTimeout, "Maximum attempts to check API readiness")
+	bindSyncFlags(rootCmd, cfg)
 	rootCmd.Flags().BoolVarP(&disableTUI, "no-tui", "", false, "Disable interactive TUI monitoring mode")
 	rootCmd.Flags().BoolVarP(&skipConfirm, "yes", "y", false, "Skip the rotki-core version confirmation prompt")
-
-	// Update retry delay from milliseconds to duration
-	rootCmd.PreRun = func(cmd *cobra.Command, args []string) {
-		cfg.RetryDelay = time.Duration(retryDelayMs) * time.Millisecond
-	}
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the async tasks a sync would issue per user without sending them")
+	bindWaitFlag(rootCmd)
 
 	// Add subcommands
 	rootCmd.AddCommand(downloadCmd)
 	rootCmd.AddCommand(backupCmd)
 	rootCmd.AddCommand(preflightCmd)
 	rootCmd.AddCommand(versionCmd)
-	rootCmd.AddCommand(secretCmd(cfg))
+	rootCmd.AddCommand(secretCmd(cfg, &exitCode))
 	rootCmd.AddCommand(serviceCmd())
+	rootCmd.AddCommand(configCmd(cfg))
+	rootCmd.AddCommand(historyCmd())
+	rootCmd.AddCommand(daemonCmd(cfg, &exitCode))
 
 	// Add an `install` subcommand under Cobra's auto-generated `completion`
 	// command (which only prints), so users can install/update completions in
@@ -351,7 +523,30 @@ func main() {
 	}
 }
 
-// runPreflight boots rotki-core, waits for the API, and verifies every required
+// runBackup backs up the data dir while holding its run lock, since a sync
+// writing the databases mid-copy would produce an inconsistent backup. It
+// returns an exit code.
+func runBackup(cfg *config.Config) int {
+	logger.Init() // Always use console for subcommands
+	cfg.SetBaseURL()
+
+	runLock, err := acquireRunLock(cfg, "backup")
+	if err != nil {
+		logger.Error("%v", err)
+		return exitStepFailure
+	}
+	defer runLock.Release()
+
+	backupFile, err := backup.CreateBackup(cfg.DataDir, cfg.BackupDir, backupProgressPrinter())
+	if err != nil {
+		logger.Error("Failed to create backup: %v", err)
+		return exitStepFailure
+	}
+	logger.Info("Backup created successfully: %s", backupFile)
+	return exitOK
+}
+
+// runPreflight boots (or attaches to) rotki-core, waits for the API, and verifies every required
 // endpoint is registered. It returns exitContractBreak when a route is missing
 // and exitOK when all are present.
 func runPreflight(cfg *config.Config) int {
@@ -362,20 +557,21 @@ func runPreflight(cfg *config.Config) int {
 		logger.Fatal("Invalid configuration: %v", err)
 	}
 
-	rotki, err := process.StartRotkiCore(cfg.BinPath, cfg.Port, cfg.APIReadyTimeout, cfg.DataDir)
+	runLock, err := acquireRunLock(cfg, "preflight")
 	if err != nil {
-		logger.Fatal("Failed to start rotki-core: %v", err)
+		logger.Error("%v", err)
+		return exitStepFailure
 	}
+	defer runLock.Release()
 
-	syncService := services.NewSyncService(cfg)
-	defer syncService.Cleanup()
-
-	if !syncService.WaitForAPIReady() {
-		logger.Fatal("API failed to become ready")
+	session, err := startCoreSession(cfg)
+	if err != nil {
+		logger.Error("%v", err)
+		return exitStepFailure
 	}
 
-	preflightErr := syncService.PreflightEndpoints()
-	stopRotki(rotki)
+	preflightErr := session.service.PreflightEndpoints()
+	session.close()
 
 	if preflightErr != nil {
 		logger.Error("Preflight failed: %v", preflightErr)
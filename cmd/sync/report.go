@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/kelsos/rotki-sync/internal/config"
+	"github.com/kelsos/rotki-sync/internal/history"
+	"github.com/kelsos/rotki-sync/internal/logger"
+	"github.com/kelsos/rotki-sync/internal/metrics"
+	"github.com/kelsos/rotki-sync/internal/paths"
+	"github.com/kelsos/rotki-sync/internal/services"
+)
+
+// writeRunReport persists the JSON run report to the reports directory and,
+// when configured, to the --report-json path, appends it to the run history
+// and exports it to the metrics file. Failures are logged but never change the
+// run outcome: the report describes the run, it is not part of it.
+func writeRunReport(cfg *config.Config, report *services.RunReport, exitCode int) {
+	report.Scope = cfg.ScopeKey()
+	doc := report.Document()
+	if err := history.Default().Append(doc); err != nil {
+		logger.Error("Failed to record run in history: %v", err)
+	}
+
+	if cfg.MetricsFile != "" {
+		if err := metrics.WriteFile(cfg.MetricsFile, doc, exitCode); err != nil {
+			logger.Error("Failed to export run metrics: %v", err)
+		}
+	}
+
+	dir := paths.ReportDir()
+	path := filepath.Join(dir, services.ReportFileName(report.ID))
+	if err := report.WriteJSON(path); err != nil {
+		logger.Error("Failed to write run report: %v", err)
+	} else {
+		logger.Info("Run report written to %s", path)
+		if err := services.PruneReports(dir, cfg.LogKeep); err != nil {
+			logger.Debug("Could not prune old run reports: %v", err)
+		}
+	}
+
+	if cfg.ReportJSON != "" {
+		if err := report.WriteJSON(cfg.ReportJSON); err != nil {
+			logger.Error("Failed to write run report: %v", err)
+		} else {
+			logger.Info("Run report written to %s", cfg.ReportJSON)
+		}
+	}
+}
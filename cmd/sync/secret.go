@@ -11,14 +11,13 @@ import (
 
 	"github.com/kelsos/rotki-sync/internal/config"
 	"github.com/kelsos/rotki-sync/internal/logger"
-	"github.com/kelsos/rotki-sync/internal/process"
 	"github.com/kelsos/rotki-sync/internal/secrets"
-	"github.com/kelsos/rotki-sync/internal/services"
 )
 
 // secretCmd builds the `secret` command tree for managing the age-encrypted
-// store that holds per-user login passwords.
-func secretCmd(cfg *config.Config) *cobra.Command {
+// store that holds per-user login passwords. The check subcommand sets
+// exitCode.
+func secretCmd(cfg *config.Config, exitCode *int) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "secret",
 		Short: "Manage the age-encrypted secret store (user login passwords)",
@@ -30,7 +29,7 @@ func secretCmd(cfg *config.Config) *cobra.Command {
 		secretSetCmd(),
 		secretRmCmd(),
 		secretListCmd(),
-		secretCheckCmd(cfg),
+		secretCheckCmd(cfg, exitCode),
 	)
 	return cmd
 }
@@ -134,21 +133,24 @@ func secretListCmd() *cobra.Command {
 	}
 }
 
-func secretCheckCmd(cfg *config.Config) *cobra.Command {
-	return &cobra.Command{
+func secretCheckCmd(cfg *config.Config, exitCode *int) *cobra.Command {
+	cmd := &cobra.Command{
 		Use:   "check",
 		Short: "Verify stored passwords authenticate against a live rotki-core",
 		Long: "Boot rotki-core and, for each user, log in then immediately log out using the\n" +
 			"stored password. No sync is performed. Exits non-zero if any user fails.",
 		Args: cobra.NoArgs,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			os.Exit(runSecretCheck(cfg))
-			return nil
+		Run: func(cmd *cobra.Command, args []string) {
+			*exitCode = runSecretCheck(cfg)
 		},
 	}
+	bindUserFlags(cmd, cfg)
+	bindAttachFlags(cmd, cfg)
+	bindWaitFlag(cmd)
+	return cmd
 }
 
-// runSecretCheck boots rotki-core, verifies every user's stored password via a
+// runSecretCheck boots (or attaches to) rotki-core, verifies every user's stored password via a
 // login/logout round-trip, prints a per-user report, and returns an exit code.
 func runSecretCheck(cfg *config.Config) int {
 	logger.Init()
@@ -158,20 +160,21 @@ func runSecretCheck(cfg *config.Config) int {
 		logger.Fatal("Invalid configuration: %v", err)
 	}
 
-	rotki, err := process.StartRotkiCore(cfg.BinPath, cfg.Port, cfg.APIReadyTimeout, cfg.DataDir)
+	runLock, err := acquireRunLock(cfg, "secret check")
 	if err != nil {
-		logger.Fatal("Failed to start rotki-core: %v", err)
+		logger.Error("%v", err)
+		return exitStepFailure
 	}
+	defer runLock.Release()
 
-	syncService := services.NewSyncService(cfg)
-	defer syncService.Cleanup()
-
-	if !syncService.WaitForAPIReady() {
-		logger.Fatal("API failed to become ready")
+	session, err := startCoreSession(cfg)
+	if err != nil {
+		logger.Error("%v", err)
+		return exitStepFailure
 	}
 
-	results, checkErr := syncService.CheckCredentials()
-	stopRotki(rotki)
+	results, checkErr := session.service.CheckCredentials()
+	session.close()
 
 	if checkErr != nil {
 		logger.Error("Credential check could not run: %v", checkErr)
@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 
 	"github.com/spf13/cobra"
+
+	"github.com/kelsos/rotki-sync/internal/config"
 )
 
 const (
@@ -14,7 +16,7 @@ const (
 	timerUnitName   = "rotki-sync.timer"
 	// defaultSchedule is a systemd OnCalendar expression. Daily at 09:30; with
 	// Persistent=true a run missed while logged out fires right after next login.
-	defaultSchedule = "*-*-* 09:30:00"
+	defaultSchedule = config.DefaultSchedule
 )
 
 // serviceCmd builds the `service` command tree for the systemd --user timer that
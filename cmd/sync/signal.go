@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/kelsos/rotki-sync/internal/services"
+)
+
+// interruptOnSignal interrupts the run on syncService when SIGINT or SIGTERM
+// arrives: the first signal stops it after the current step, a second one
+// also cancels the async tasks in flight (see services.SyncService.Interrupt).
+// The run still logs out, writes its report and stops rotki-core. The returned
+// function restores the default signal handling.
+func interruptOnSignal(syncService *services.SyncService) (stop func()) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				syncService.Interrupt(signalReason(sig))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// signalReason describes a signal the way the run report records it.
+func signalReason(sig os.Signal) string {
+	return fmt.Sprintf("signal: %s", sig)
+}
@@ -23,12 +23,31 @@ const (
 )
 
 // webhookEnvVar names the environment variable holding the alert webhook URL.
-// When unset, alerting is disabled and Notify is a no-op.
+// When unset (and no URL was set via SetWebhook), alerting is disabled and
+// Notify is a no-op.
 const webhookEnvVar = "ROTKI_SYNC_ALERT_WEBHOOK"
 
+// webhookOverride is the URL set from the config file; it takes precedence
+// over the environment variable.
+var webhookOverride string
+
+// SetWebhook sets the alert webhook URL, overriding ROTKI_SYNC_ALERT_WEBHOOK.
+// An empty URL restores the environment lookup.
+func SetWebhook(url string) {
+	webhookOverride = url
+}
+
+// webhookURL returns the configured webhook URL, or "" when alerting is off.
+func webhookURL() string {
+	if webhookOverride != "" {
+		return webhookOverride
+	}
+	return os.Getenv(webhookEnvVar)
+}
+
 // Enabled reports whether an alert destination is configured.
 func Enabled() bool {
-	return os.Getenv(webhookEnvVar) != ""
+	return webhookURL() != ""
 }
 
 // Notify posts a failure message to the configured webhook. It is a no-op when
@@ -38,7 +57,7 @@ func Enabled() bool {
 // The payload uses a {"text": ...} shape, which Slack, Mattermost and most
 // generic webhook receivers accept.
 func Notify(title, body string) {
-	webhook := os.Getenv(webhookEnvVar)
+	webhook := webhookURL()
 	if webhook == "" {
 		logger.Debug("Alerting disabled (%s not set); skipping notification", webhookEnvVar)
 		return
@@ -33,3 +33,15 @@ func TestEnabled(t *testing.T) {
 		t.Error("Enabled() should be true when webhook env is set")
 	}
 }
+
+func TestSetWebhookOverridesEnv(t *testing.T) {
+	t.Setenv(webhookEnvVar, "")
+	SetWebhook("https://example.com/from-config")
+	t.Cleanup(func() { SetWebhook("") })
+	if !Enabled() {
+		t.Fatal("Enabled() should be true when a webhook was set from config")
+	}
+	if got := webhookURL(); got != "https://example.com/from-config" {
+		t.Fatalf("webhookURL() = %q", got)
+	}
+}
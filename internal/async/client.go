@@ -1,6 +1,8 @@
 package async
 
 import (
+	"context"
+
 	"github.com/kelsos/rotki-sync/internal/models"
 )
 
@@ -35,3 +37,23 @@ func Put[T any](c *Client, endpoint string, body interface{}) (*models.APIRespon
 func Patch[T any](c *Client, endpoint string, body interface{}) (*models.APIResponse[T], error) {
 	return ExecuteAsync[T](c.manager, "PATCH", endpoint, body)
 }
+
+// GetContext is like Get but gives up when ctx is done.
+func GetContext[T any](ctx context.Context, c *Client, endpoint string) (*models.APIResponse[T], error) {
+	return ExecuteAsyncContext[T](ctx, c.manager, "GET", endpoint, nil)
+}
+
+// PostContext is like Post but gives up when ctx is done.
+func PostContext[T any](ctx context.Context, c *Client, endpoint string, body interface{}) (*models.APIResponse[T], error) {
+	return ExecuteAsyncContext[T](ctx, c.manager, "POST", endpoint, body)
+}
+
+// PutContext is like Put but gives up when ctx is done.
+func PutContext[T any](ctx context.Context, c *Client, endpoint string, body interface{}) (*models.APIResponse[T], error) {
+	return ExecuteAsyncContext[T](ctx, c.manager, "PUT", endpoint, body)
+}
+
+// PatchContext is like Patch but gives up when ctx is done.
+func PatchContext[T any](ctx context.Context, c *Client, endpoint string, body interface{}) (*models.APIResponse[T], error) {
+	return ExecuteAsyncContext[T](ctx, c.manager, "PATCH", endpoint, body)
+}
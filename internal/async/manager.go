@@ -1,7 +1,9 @@
 package async
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -20,23 +22,239 @@ type ProgressReporter interface {
 	Snapshot() string
 }
 
+// TaskNotifier is an optional push source of task completions, such as the
+// rotki-core websocket. It calls TaskManager.TasksChanged when rotki-core may
+// have finished a task; Connected reports whether it is able to right now.
+// Implementations must be safe for concurrent use and must not block.
+type TaskNotifier interface {
+	Connected() bool
+}
+
+// TaskObserver is told about every async task: once it is dispatched, on each
+// heartbeat while it runs (with the ProgressReporter's annotation, if any) and
+// once its wait ended, with the error it ended with. Implementations must be
+// safe for concurrent use and must not block.
+type TaskObserver interface {
+	TaskStarted(taskID models.TaskID, method, endpoint string)
+	TaskHeartbeat(taskID models.TaskID, endpoint string, elapsed time.Duration, annotation string)
+	TaskFinished(timing TaskTiming, err error)
+}
+
+const (
+	// minPollInterval and maxPollInterval bound how often /tasks is polled
+	// without a connected TaskNotifier: fast while a task is young, slower as
+	// it ages (see pollDelay).
+	minPollInterval = 250 * time.Millisecond
+	maxPollInterval = 10 * time.Second
+	// pollBackoffDivisor makes a task be polled every age/pollBackoffDivisor,
+	// e.g. every 10s once it has run for 40s.
+	pollBackoffDivisor = 4
+	// fallbackPollInterval is how often /tasks is polled for the tasks of an
+	// announced endpoint (see pollHints) while a TaskNotifier is connected, in
+	// case a notification is missed.
+	fallbackPollInterval = 15 * time.Second
+	// notifiedPollWindow is how long /tasks is polled at minPollInterval
+	// after a notification: rotki-core announces finished work shortly before
+	// the task's result is stored.
+	notifiedPollWindow = 5 * time.Second
+)
+
+// pollHints is how long tasks of an endpoint usually run at least, by
+// endpoint prefix, most specific first. A task is not polled for before its
+// hint has passed; endpoints without a hint are polled right away. announced
+// marks the endpoints whose work rotki-core reports finished over the
+// websocket (see progress.Tracker); only their tasks are left to the
+// TaskNotifier while it is connected.
+var pollHints = []struct {
+	prefix    string
+	hint      time.Duration
+	announced bool
+}{
+	{"/blockchains/transactions/decode", 5 * time.Second, true},
+	{"/blockchains/transactions", 2 * time.Second, true},
+	{"/history/events/query", 2 * time.Second, true},
+	{"/balances", 2 * time.Second, false},
+}
+
+// pollHint returns the poll hint for endpoint and whether rotki-core
+// announces its finished work (see pollHints).
+func pollHint(endpoint string) (hint time.Duration, announced bool) {
+	for _, h := range pollHints {
+		if strings.HasPrefix(endpoint, h.prefix) {
+			return h.hint, h.announced
+		}
+	}
+	return 0, false
+}
+
+// pollDelay returns how long to wait before polling for a task that has run
+// for age and whose endpoint has the given hint: until the hint has passed,
+// then a pollBackoffDivisor-th of its age, within [lo, hi].
+func pollDelay(age, hint, lo, hi time.Duration) time.Duration {
+	delay := age / pollBackoffDivisor
+	if age < hint {
+		delay = hint - age
+	}
+	return min(max(delay, lo), hi)
+}
+
+// watchedTask is a task whose result a caller of RegisterTask awaits.
+type watchedTask struct {
+	result     chan<- models.APIResponse[json.RawMessage]
+	registered time.Time
+	hint       time.Duration
+	// announced marks a task whose finished work rotki-core notifies about.
+	announced bool
+}
+
+// TaskTiming records how long one async task took, from dispatching the
+// request to receiving its result.
+type TaskTiming struct {
+	ID       models.TaskID
+	Method   string
+	Endpoint string
+	Duration time.Duration
+	Failed   bool
+	// TimedOut marks a task given up on at a time limit; it is not Failed.
+	TimedOut bool
+}
+
+// ErrCanceled is returned for async tasks refused by StopNewTasks or given up
+// on by CancelTasks.
+var ErrCanceled = errors.New("async task canceled")
+
+type taskTimeoutKey struct{}
+
+// WithTaskTimeout returns a context under which every async task is given up
+// on once it ran for limit; 0 waits as long as ctx allows. The error then
+// wraps context.DeadlineExceeded, like one for ctx's own deadline.
+func WithTaskTimeout(ctx context.Context, limit time.Duration) context.Context {
+	return context.WithValue(ctx, taskTimeoutKey{}, limit)
+}
+
+// taskContext bounds the wait for one task by the task time limit of ctx, if
+// any.
+func taskContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	limit, _ := ctx.Value(taskTimeoutKey{}).(time.Duration)
+	if limit <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, limit,
+		fmt.Errorf("task time limit of %s: %w", limit, context.DeadlineExceeded))
+}
+
 type TaskManager struct {
-	client        *client.APIClient
-	activeTasks   map[models.TaskID]chan<- models.APIResponse[json.RawMessage]
-	mu            sync.RWMutex
-	pollInterval  time.Duration
-	stopPolling   chan struct{}
-	pollingActive bool
-	progress      ProgressReporter
+	client *client.APIClient
+	// activeTasks maps each awaited task to its result channel. Whoever
+	// removes a task from the map delivers its result and closes the channel;
+	// a channel closed without a result means the wait was canceled.
+	activeTasks map[models.TaskID]watchedTask
+	mu          sync.RWMutex
+	// pollInterval and maxPollInterval bound the adaptive poll delay (see
+	// nextPoll).
+	pollInterval    time.Duration
+	maxPollInterval time.Duration
+	stopPolling     chan struct{}
+	pollingActive   bool
+	// registered makes the poller reconsider its delay for a new task.
+	registered chan struct{}
+	progress   ProgressReporter
+	observer   TaskObserver
+	// notifier, when connected, slows polling to fallbackInterval; wake
+	// makes the poller check right away and notifiedUntil ends the window of
+	// fast polling after a notification (see TasksChanged).
+	notifier         TaskNotifier
+	fallbackInterval time.Duration
+	wake             chan struct{}
+	notifiedUntil    time.Time
+	timings          []TaskTiming
+	// polls counts the /tasks requests made; pollsDrained is the count at
+	// the last DrainPolls.
+	polls        int
+	pollsDrained int
+	// refuseNew is set by StopNewTasks and canceled by CancelTasks.
+	refuseNew bool
+	canceled  bool
 }
 
 func NewTaskManager(apiClient *client.APIClient) *TaskManager {
 	return &TaskManager{
-		client:       apiClient,
-		activeTasks:  make(map[models.TaskID]chan<- models.APIResponse[json.RawMessage]),
-		pollInterval: time.Second,
-		stopPolling:  make(chan struct{}),
+		client:           apiClient,
+		activeTasks:      make(map[models.TaskID]watchedTask),
+		pollInterval:     minPollInterval,
+		maxPollInterval:  maxPollInterval,
+		fallbackInterval: fallbackPollInterval,
+		stopPolling:      make(chan struct{}),
+		registered:       make(chan struct{}, 1),
+		wake:             make(chan struct{}, 1),
+	}
+}
+
+// SetTaskNotifier installs an optional push source of task completions. While
+// it is connected, /tasks is polled only every fallbackPollInterval and right
+// after each TasksChanged. Passing nil polls at the adaptive delay again.
+func (tm *TaskManager) SetTaskNotifier(notifier TaskNotifier) {
+	tm.mu.Lock()
+	tm.notifier = notifier
+	tm.mu.Unlock()
+}
+
+// TasksChanged tells the manager that rotki-core may have finished a task,
+// so /tasks is checked right away and every minPollInterval for a short
+// while after. It never blocks.
+func (tm *TaskManager) TasksChanged() {
+	tm.mu.Lock()
+	tm.notifiedUntil = time.Now().Add(notifiedPollWindow)
+	tm.mu.Unlock()
+
+	select {
+	case tm.wake <- struct{}{}:
+	default:
+	}
+}
+
+// nextPoll returns how long the poller waits before checking /tasks again:
+// the shortest pollDelay of the watched tasks, so a new task resets the
+// backoff. While a TaskNotifier is connected, tasks of announced endpoints
+// wait at least fallbackInterval; the others keep their pollDelay.
+func (tm *TaskManager) nextPoll() time.Duration {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	now := time.Now()
+	if now.Before(tm.notifiedUntil) {
+		return tm.pollInterval
+	}
+
+	connected := tm.notifier != nil && tm.notifier.Connected()
+	delay := tm.maxPollInterval
+	if connected {
+		delay = max(delay, tm.fallbackInterval)
 	}
+	for _, task := range tm.activeTasks {
+		taskDelay := pollDelay(now.Sub(task.registered), task.hint, tm.pollInterval, tm.maxPollInterval)
+		if connected && task.announced {
+			taskDelay = max(taskDelay, tm.fallbackInterval)
+		}
+		delay = min(delay, taskDelay)
+	}
+	return delay
+}
+
+// DrainPolls returns the number of /tasks requests made since the previous
+// call, so a caller can attribute them to the step that caused them.
+func (tm *TaskManager) DrainPolls() int {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	polls := tm.polls - tm.pollsDrained
+	tm.pollsDrained = tm.polls
+	return polls
+}
+
+// Polls returns the number of /tasks requests made so far.
+func (tm *TaskManager) Polls() int {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.polls
 }
 
 // SetProgressReporter installs an optional reporter consulted on each heartbeat
@@ -53,17 +271,93 @@ func (tm *TaskManager) progressReporter() ProgressReporter {
 	return tm.progress
 }
 
-func (tm *TaskManager) RegisterTask(taskID models.TaskID) <-chan models.APIResponse[json.RawMessage] {
+// SetTaskObserver installs an optional observer of every task's dispatch,
+// heartbeats and end. Passing nil removes it.
+func (tm *TaskManager) SetTaskObserver(observer TaskObserver) {
+	tm.mu.Lock()
+	tm.observer = observer
+	tm.mu.Unlock()
+}
+
+func (tm *TaskManager) taskObserver() TaskObserver {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.observer
+}
+
+func (tm *TaskManager) recordTiming(timing TaskTiming) {
+	tm.mu.Lock()
+	tm.timings = append(tm.timings, timing)
+	tm.mu.Unlock()
+}
+
+// DrainTimings returns the task timings recorded since the previous call and
+// forgets them, so a caller can attribute tasks to the step that ran them.
+func (tm *TaskManager) DrainTimings() []TaskTiming {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	timings := tm.timings
+	tm.timings = nil
+	return timings
+}
+
+// StopNewTasks makes every later request fail with ErrCanceled without
+// dispatching it. Tasks already in flight are still awaited.
+func (tm *TaskManager) StopNewTasks() {
+	tm.mu.Lock()
+	tm.refuseNew = true
+	tm.mu.Unlock()
+}
+
+// CancelTasks stops waiting for every task in flight and refuses new ones (see
+// StopNewTasks), so a run being shut down is not held up by a slow task.
+// rotki-core has no way to cancel a task: it keeps working until it finishes
+// or is stopped, and its outcome is discarded.
+func (tm *TaskManager) CancelTasks() {
+	tm.mu.Lock()
+	tm.refuseNew = true
+	tm.canceled = true
+	tasks := tm.activeTasks
+	tm.activeTasks = make(map[models.TaskID]watchedTask)
+	tm.stopLocked()
+	tm.mu.Unlock()
+
+	for taskID, task := range tasks {
+		logger.Warn("Canceled waiting for async task %d", taskID)
+		close(task.result)
+	}
+}
+
+func (tm *TaskManager) refusingNew() bool {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.refuseNew
+}
+
+// RegisterTask watches taskID, a task started by a request to endpoint, and
+// returns the channel its result is delivered on.
+func (tm *TaskManager) RegisterTask(taskID models.TaskID, endpoint string) <-chan models.APIResponse[json.RawMessage] {
 	resultChan := make(chan models.APIResponse[json.RawMessage], 1)
 
 	tm.mu.Lock()
-	tm.activeTasks[taskID] = resultChan
+	if tm.canceled {
+		tm.mu.Unlock()
+		close(resultChan)
+		return resultChan
+	}
+	hint, announced := pollHint(endpoint)
+	tm.activeTasks[taskID] = watchedTask{result: resultChan, registered: time.Now(), hint: hint, announced: announced}
 
 	if !tm.pollingActive {
 		tm.pollingActive = true
 		// Recreate stopPolling channel if it was closed from previous stop
 		tm.stopPolling = make(chan struct{})
-		go tm.pollTasks()
+		go tm.pollTasks(tm.stopPolling)
+	} else {
+		select {
+		case tm.registered <- struct{}{}:
+		default:
+		}
 	}
 	tm.mu.Unlock()
 
@@ -71,31 +365,48 @@ func (tm *TaskManager) RegisterTask(taskID models.TaskID) <-chan models.APIRespo
 	return resultChan
 }
 
-func (tm *TaskManager) pollTasks() {
-	ticker := time.NewTicker(tm.pollInterval)
-	defer ticker.Stop()
+// pollTasks polls until stop is closed, waiting nextPoll between checks,
+// checking early when woken by TasksChanged and moving the next check closer
+// when a new task needs it sooner. Each poller watches the stop channel it
+// was started with, so a poller being stopped cannot affect one started after
+// it by a concurrent RegisterTask.
+func (tm *TaskManager) pollTasks(stop <-chan struct{}) {
+	delay := tm.nextPoll()
+	due := time.Now().Add(delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-tm.stopPolling:
-			tm.mu.Lock()
-			tm.pollingActive = false
-			tm.mu.Unlock()
+		case <-stop:
 			return
-		case <-ticker.C:
-			tm.checkTasks()
+		case <-tm.registered:
+			if delay := tm.nextPoll(); time.Now().Add(delay).Before(due) {
+				due = time.Now().Add(delay)
+				timer.Reset(delay)
+			}
+			continue
+		case <-tm.wake:
+		case <-timer.C:
 		}
+		tm.checkTasks()
+		delay := tm.nextPoll()
+		due = time.Now().Add(delay)
+		timer.Reset(delay)
 	}
 }
 
 func (tm *TaskManager) checkTasks() {
-	tm.mu.RLock()
+	// Check and stop under one lock so a task registered concurrently either
+	// is seen here or starts a new poller.
+	tm.mu.Lock()
 	if len(tm.activeTasks) == 0 {
-		tm.mu.RUnlock()
-		tm.Stop()
+		tm.stopLocked()
+		tm.mu.Unlock()
 		return
 	}
-	tm.mu.RUnlock()
+	tm.polls++
+	tm.mu.Unlock()
 
 	var tasksResponse models.APIResponse[models.TasksResponse]
 	if err := tm.client.Get("/tasks", &tasksResponse); err != nil {
@@ -105,51 +416,61 @@ func (tm *TaskManager) checkTasks() {
 
 	for _, completedTaskID := range tasksResponse.Result.Completed {
 		tm.mu.RLock()
-		resultChan, exists := tm.activeTasks[completedTaskID]
+		_, exists := tm.activeTasks[completedTaskID]
 		tm.mu.RUnlock()
 
 		if exists {
-			tm.fetchTaskResult(completedTaskID, resultChan)
+			tm.fetchTaskResult(completedTaskID)
 		}
 	}
 }
 
-func (tm *TaskManager) fetchTaskResult(taskID models.TaskID, resultChan chan<- models.APIResponse[json.RawMessage]) {
+func (tm *TaskManager) fetchTaskResult(taskID models.TaskID) {
 	endpoint := fmt.Sprintf("/tasks/%d", taskID)
 	var taskResult models.APIResponse[models.TaskResult]
+	var result models.APIResponse[json.RawMessage]
 
 	if err := tm.client.Get(endpoint, &taskResult); err != nil {
 		logger.Error("Failed to fetch result for task %d: %v", taskID, err)
-		resultChan <- models.APIResponse[json.RawMessage]{
-			Message: fmt.Sprintf("Failed to fetch task result: %v", err),
-		}
+		result.Message = fmt.Sprintf("Failed to fetch task result: %v", err)
+	} else if taskResult.Result.Status == models.TaskStatusNotFound {
+		logger.Error("Task %d not found", taskID)
+		result.Message = fmt.Sprintf("Task %d not found", taskID)
 	} else {
-		if taskResult.Result.Status == models.TaskStatusNotFound {
-			logger.Error("Task %d not found", taskID)
-			resultChan <- models.APIResponse[json.RawMessage]{
-				Message: fmt.Sprintf("Task %d not found", taskID),
-			}
-		} else {
-			resultChan <- models.APIResponse[json.RawMessage]{
-				Result:  taskResult.Result.Outcome,
-				Message: taskResult.Message,
-			}
-		}
+		result.Result = taskResult.Result.Outcome
+		result.Message = taskResult.Message
 	}
 
-	close(resultChan)
-
+	// The task may have been canceled while its result was fetched.
 	tm.mu.Lock()
+	task, exists := tm.activeTasks[taskID]
 	delete(tm.activeTasks, taskID)
 	tm.mu.Unlock()
+	if !exists {
+		return
+	}
 
+	task.result <- result
+	close(task.result)
 	logger.Debug("Task %d completed and removed from monitoring", taskID)
 }
 
+// abandon stops watching taskID, whose waiter gave up on it. rotki-core keeps
+// working on the task and its outcome is discarded.
+func (tm *TaskManager) abandon(taskID models.TaskID) {
+	tm.mu.Lock()
+	delete(tm.activeTasks, taskID)
+	tm.mu.Unlock()
+}
+
 func (tm *TaskManager) Stop() {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
+	tm.stopLocked()
+}
 
+// stopLocked stops the poller, if running. The caller must hold tm.mu.
+func (tm *TaskManager) stopLocked() {
 	if tm.pollingActive {
 		close(tm.stopPolling)
 		tm.pollingActive = false
@@ -192,17 +513,17 @@ func prepareRequestBody(body interface{}) (map[string]interface{}, error) {
 }
 
 // executeHTTPRequest performs the actual HTTP request based on method
-func executeHTTPRequest(tm *TaskManager, method, endpoint string, requestBody map[string]interface{}) (*models.APIResponse[models.AsyncTaskResponse], error) {
+func executeHTTPRequest(ctx context.Context, tm *TaskManager, method, endpoint string, requestBody map[string]interface{}) (*models.APIResponse[models.AsyncTaskResponse], error) {
 	var asyncResponse models.APIResponse[models.AsyncTaskResponse]
 	var err error
 
 	switch method {
 	case "POST":
-		err = tm.client.Post(endpoint, requestBody, &asyncResponse)
+		err = tm.client.PostContext(ctx, endpoint, requestBody, &asyncResponse)
 	case "PUT":
-		err = tm.client.Put(endpoint, requestBody, &asyncResponse)
+		err = tm.client.PutContext(ctx, endpoint, requestBody, &asyncResponse)
 	case "PATCH":
-		err = tm.client.Patch(endpoint, requestBody, &asyncResponse)
+		err = tm.client.PatchContext(ctx, endpoint, requestBody, &asyncResponse)
 	default:
 		return nil, fmt.Errorf("unsupported HTTP method: %s", method)
 	}
@@ -221,10 +542,20 @@ const taskHeartbeatInterval = 30 * time.Second
 // status_code/message is inspected before the result is treated as success.
 // While waiting it emits a periodic heartbeat with elapsed time so a slow or
 // rate-limited backend task is visible instead of looking hung. desc is a short
-// label (typically the endpoint) used in those heartbeat lines.
-func waitForTaskResult[T any](tm *TaskManager, taskID models.TaskID, desc string) (*models.APIResponse[T], error) {
-	resultChan := tm.RegisterTask(taskID)
-	rawResult := waitWithHeartbeat(resultChan, taskID, desc, tm.progressReporter())
+// label (typically the endpoint) used in those heartbeat lines. When ctx is
+// done, or the task ran into its time limit (see WithTaskTimeout), first the
+// task is abandoned and the cause returned.
+func waitForTaskResult[T any](ctx context.Context, tm *TaskManager, taskID models.TaskID, desc string) (*models.APIResponse[T], error) {
+	ctx, cancel := taskContext(ctx)
+	defer cancel()
+	resultChan := tm.RegisterTask(taskID, desc)
+	rawResult, err := waitWithHeartbeat(ctx, resultChan, taskID, desc, tm.progressReporter(), tm.taskObserver())
+	if err != nil {
+		if ctx.Err() != nil {
+			tm.abandon(taskID)
+		}
+		return nil, fmt.Errorf("async task %d: %w", taskID, err)
+	}
 
 	// rawResult.Result is the task outcome JSON; rawResult.Message carries
 	// fetch-level errors set by fetchTaskResult (task not found / fetch failed).
@@ -253,31 +584,47 @@ func waitForTaskResult[T any](tm *TaskManager, taskID models.TaskID, desc string
 
 // waitWithHeartbeat blocks until the task result arrives, logging an elapsed-time
 // heartbeat every taskHeartbeatInterval so a long-running backend task does not
-// look frozen. The final elapsed time is also logged once the result lands.
+// look frozen; observer, if set, is told about each one. The final elapsed
+// time is also logged once the result lands. It returns ErrCanceled when the
+// wait was canceled and the cause of ctx when it is done first.
 func waitWithHeartbeat(
+	ctx context.Context,
 	resultChan <-chan models.APIResponse[json.RawMessage],
 	taskID models.TaskID,
 	desc string,
 	reporter ProgressReporter,
-) models.APIResponse[json.RawMessage] {
+	observer TaskObserver,
+) (models.APIResponse[json.RawMessage], error) {
 	start := time.Now()
 	ticker := time.NewTicker(taskHeartbeatInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case rawResult := <-resultChan:
-			if elapsed := time.Since(start); elapsed >= taskHeartbeatInterval {
+		case rawResult, ok := <-resultChan:
+			if elapsed := time.Since(start); ok && elapsed >= taskHeartbeatInterval {
 				logger.Info("Async task %d (%s) finished after %s", taskID, desc, elapsed.Round(time.Second))
 			}
-			return rawResult
+			if !ok {
+				return rawResult, ErrCanceled
+			}
+			return rawResult, nil
+		case <-ctx.Done():
+			cause := context.Cause(ctx)
+			logger.Warn("Gave up waiting on async task %d (%s) after %s: %v",
+				taskID, desc, time.Since(start).Round(time.Second), cause)
+			return models.APIResponse[json.RawMessage]{}, cause
 		case <-ticker.C:
 			elapsed := time.Since(start).Round(time.Second)
-			if ann := annotation(reporter); ann != "" {
+			ann := annotation(reporter)
+			if ann != "" {
 				logger.Info("Async task %d (%s): %s (%s elapsed)", taskID, desc, ann, elapsed)
 			} else {
 				logger.Info("Still waiting on async task %d (%s); %s elapsed", taskID, desc, elapsed)
 			}
+			if observer != nil {
+				observer.TaskHeartbeat(taskID, desc, elapsed, ann)
+			}
 		}
 	}
 }
@@ -291,27 +638,48 @@ func annotation(reporter ProgressReporter) string {
 	return reporter.Snapshot()
 }
 
+// ExecuteAsync dispatches an async request and waits for its task's result.
 func ExecuteAsync[T any](
 	tm *TaskManager,
 	method string,
 	endpoint string,
 	body interface{},
 ) (*models.APIResponse[T], error) {
+	return ExecuteAsyncContext[T](context.Background(), tm, method, endpoint, body)
+}
+
+// ExecuteAsyncContext is like ExecuteAsync but gives up on the request, or on
+// waiting for its task, when ctx is done.
+func ExecuteAsyncContext[T any](
+	ctx context.Context,
+	tm *TaskManager,
+	method string,
+	endpoint string,
+	body interface{},
+) (*models.APIResponse[T], error) {
+	if tm.refusingNew() {
+		return nil, ErrCanceled
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	var asyncResponse *models.APIResponse[models.AsyncTaskResponse]
 	var err error
+	start := time.Now()
 
 	switch method {
 	case "GET":
 		asyncEndpoint := prepareAsyncEndpoint(endpoint)
 		var response models.APIResponse[models.AsyncTaskResponse]
-		err = tm.client.Get(asyncEndpoint, &response)
+		err = tm.client.GetContext(ctx, asyncEndpoint, &response)
 		asyncResponse = &response
 	case "POST", "PUT", "PATCH":
 		requestBody, prepErr := prepareRequestBody(body)
 		if prepErr != nil {
 			return nil, prepErr
 		}
-		asyncResponse, err = executeHTTPRequest(tm, method, endpoint, requestBody)
+		asyncResponse, err = executeHTTPRequest(ctx, tm, method, endpoint, requestBody)
 	default:
 		return nil, fmt.Errorf("unsupported HTTP method: %s", method)
 	}
@@ -320,5 +688,24 @@ func ExecuteAsync[T any](
 		return nil, fmt.Errorf("failed to initiate async request: %w", err)
 	}
 
-	return waitForTaskResult[T](tm, asyncResponse.Result.TaskID, endpoint)
+	taskID := asyncResponse.Result.TaskID
+	observer := tm.taskObserver()
+	if observer != nil {
+		observer.TaskStarted(taskID, method, endpoint)
+	}
+	result, err := waitForTaskResult[T](ctx, tm, taskID, endpoint)
+	timedOut := errors.Is(err, context.DeadlineExceeded)
+	timing := TaskTiming{
+		ID:       taskID,
+		Method:   method,
+		Endpoint: endpoint,
+		Duration: time.Since(start),
+		Failed:   err != nil && !timedOut,
+		TimedOut: timedOut,
+	}
+	tm.recordTiming(timing)
+	if observer != nil {
+		observer.TaskFinished(timing, err)
+	}
+	return result, err
 }
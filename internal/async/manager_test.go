@@ -0,0 +1,349 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/client"
+	"github.com/kelsos/rotki-sync/internal/config"
+	"github.com/kelsos/rotki-sync/internal/models"
+)
+
+// newPendingBackend starts every task as task 7 and never completes it. It
+// counts the tasks started.
+func newPendingBackend(started *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/1/tasks" {
+			_, _ = w.Write([]byte(`{"result": {"pending": [7], "completed": []}}`))
+			return
+		}
+		started.Add(1)
+		_, _ = w.Write([]byte(`{"result": {"task_id": 7}}`))
+	}))
+}
+
+func newTestManager(url string) *TaskManager {
+	tm := NewTaskManager(client.NewAPIClient(&config.Config{BaseURL: url}))
+	tm.pollInterval = 10 * time.Millisecond
+	return tm
+}
+
+func TestCancelTasksReleasesWaiters(t *testing.T) {
+	var started atomic.Int32
+	server := newPendingBackend(&started)
+	defer server.Close()
+	tm := newTestManager(server.URL)
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := Post[bool](NewClient(tm), "/history/events/query", nil)
+		result <- err
+	}()
+
+	// Wait for the task to be registered before canceling it.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tm.mu.RLock()
+		registered := len(tm.activeTasks) == 1
+		tm.mu.RUnlock()
+		if registered {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("task was never registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	tm.CancelTasks()
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrCanceled) {
+			t.Errorf("err = %v, want ErrCanceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("canceled task is still waited on")
+	}
+
+	if _, err := Post[bool](NewClient(tm), "/history/events/query", nil); !errors.Is(err, ErrCanceled) {
+		t.Errorf("request after CancelTasks: err = %v, want ErrCanceled", err)
+	}
+	if n := started.Load(); n != 1 {
+		t.Errorf("started %d tasks, want 1", n)
+	}
+}
+
+func TestStopNewTasksRefusesRequests(t *testing.T) {
+	var started atomic.Int32
+	server := newPendingBackend(&started)
+	defer server.Close()
+	tm := newTestManager(server.URL)
+
+	tm.StopNewTasks()
+	if _, err := Post[bool](NewClient(tm), "/history/events/query", nil); !errors.Is(err, ErrCanceled) {
+		t.Errorf("err = %v, want ErrCanceled", err)
+	}
+	if n := started.Load(); n != 0 {
+		t.Errorf("started %d tasks after StopNewTasks", n)
+	}
+}
+
+func TestPostContextGivesUpAtDeadline(t *testing.T) {
+	var started atomic.Int32
+	server := newPendingBackend(&started)
+	defer server.Close()
+	tm := newTestManager(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := PostContext[bool](ctx, NewClient(tm), "/blockchains/transactions/decode", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+
+	tm.mu.RLock()
+	watched := len(tm.activeTasks)
+	tm.mu.RUnlock()
+	if watched != 0 {
+		t.Errorf("%d tasks still watched after the deadline", watched)
+	}
+	if timings := tm.DrainTimings(); len(timings) != 1 || !timings[0].TimedOut || timings[0].Failed {
+		t.Errorf("timings = %+v, want one timed-out task", timings)
+	}
+
+	// A done context does not start another task.
+	if _, err := PostContext[bool](ctx, NewClient(tm), "/blockchains/transactions/decode", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if n := started.Load(); n != 1 {
+		t.Errorf("started %d tasks, want 1", n)
+	}
+}
+
+func TestTaskTimeoutGivesUpOnEachTask(t *testing.T) {
+	var started atomic.Int32
+	server := newPendingBackend(&started)
+	defer server.Close()
+	tm := newTestManager(server.URL)
+
+	ctx := WithTaskTimeout(context.Background(), 30*time.Millisecond)
+	for i := range 2 {
+		_, err := PostContext[bool](ctx, NewClient(tm), "/blockchains/transactions/decode", nil)
+		if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "task time limit of 30ms") {
+			t.Fatalf("task %d: err = %v, want the task time limit", i, err)
+		}
+	}
+	// The limit applies to each task, not to the context they share.
+	if ctx.Err() != nil {
+		t.Errorf("ctx.Err() = %v, want nil", ctx.Err())
+	}
+	if n := started.Load(); n != 2 {
+		t.Errorf("started %d tasks, want 2", n)
+	}
+}
+
+// connectedNotifier is a TaskNotifier that is always connected.
+type connectedNotifier struct{}
+
+func (connectedNotifier) Connected() bool { return true }
+
+func TestTasksChangedChecksRightAway(t *testing.T) {
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/1/tasks":
+			polls.Add(1)
+			_, _ = w.Write([]byte(`{"result": {"pending": [], "completed": [7]}}`))
+		case "/api/1/tasks/7":
+			_, _ = w.Write([]byte(`{"result": {"status": "completed", "outcome": {"result": true, "message": ""}}}`))
+		default:
+			_, _ = w.Write([]byte(`{"result": {"task_id": 7}}`))
+		}
+	}))
+	defer server.Close()
+	tm := newTestManager(server.URL)
+	tm.fallbackInterval = time.Hour
+	tm.SetTaskNotifier(connectedNotifier{})
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := Post[bool](NewClient(tm), "/blockchains/transactions/decode", nil)
+		result <- err
+	}()
+
+	// With the notifier connected, nothing polls before the notification.
+	time.Sleep(50 * time.Millisecond)
+	if n := polls.Load(); n != 0 {
+		t.Fatalf("polled /tasks %d times before the notification", n)
+	}
+
+	tm.TasksChanged()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("err = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("notified task was not picked up")
+	}
+}
+
+func TestPollDelay(t *testing.T) {
+	const lo, hi = 250 * time.Millisecond, 10 * time.Second
+	tests := []struct {
+		name      string
+		age, hint time.Duration
+		want      time.Duration
+	}{
+		{"new task polls fast", 0, 0, lo},
+		{"slows as the task ages", 8 * time.Second, 0, 2 * time.Second},
+		{"capped", 2 * time.Hour, 0, hi},
+		{"waits out the hint", time.Second, 5 * time.Second, 4 * time.Second},
+		{"backs off past the hint", 20 * time.Second, 5 * time.Second, 5 * time.Second},
+		{"hint nearly over", 4900 * time.Millisecond, 5 * time.Second, lo},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := pollDelay(tc.age, tc.hint, lo, hi); got != tc.want {
+				t.Errorf("pollDelay(%v, %v) = %v, want %v", tc.age, tc.hint, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPollHint(t *testing.T) {
+	tests := []struct {
+		endpoint  string
+		hint      time.Duration
+		announced bool
+	}{
+		{"/blockchains/transactions/decode", 5 * time.Second, true},
+		{"/blockchains/transactions", 2 * time.Second, true},
+		{"/history/events/query/exchange", 2 * time.Second, true},
+		{"/balances?save_data=true", 2 * time.Second, false},
+		{"/blockchains/eth/tokens/detect", 0, false},
+		{"/users/alice", 0, false},
+	}
+	for _, tc := range tests {
+		if hint, announced := pollHint(tc.endpoint); hint != tc.hint || announced != tc.announced {
+			t.Errorf("pollHint(%q) = %v, %v, want %v, %v", tc.endpoint, hint, announced, tc.hint, tc.announced)
+		}
+	}
+}
+
+func TestUnannouncedTaskPolledWhileNotifierConnected(t *testing.T) {
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/1/tasks":
+			polls.Add(1)
+			_, _ = w.Write([]byte(`{"result": {"pending": [], "completed": [7]}}`))
+		case "/api/1/tasks/7":
+			_, _ = w.Write([]byte(`{"result": {"status": "completed", "outcome": {"result": true, "message": ""}}}`))
+		default:
+			_, _ = w.Write([]byte(`{"result": {"task_id": 7}}`))
+		}
+	}))
+	defer server.Close()
+	tm := newTestManager(server.URL)
+	tm.fallbackInterval = time.Hour
+	tm.SetTaskNotifier(connectedNotifier{})
+
+	// rotki-core sends no notification for a token detection, so it must not
+	// wait for the fallback interval.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := PostContext[bool](ctx, NewClient(tm), "/blockchains/eth/tokens/detect", nil); err != nil {
+		t.Fatalf("err = %v", err)
+	}
+	if polls.Load() == 0 {
+		t.Error("the task was never polled for")
+	}
+}
+
+func TestPollsBackOffAsTaskAges(t *testing.T) {
+	var started atomic.Int32
+	server := newPendingBackend(&started)
+	defer server.Close()
+	tm := newTestManager(server.URL)
+	tm.maxPollInterval = time.Second
+
+	// At a fixed 10ms interval, 400ms would take about 40 polls.
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	if _, err := PostContext[bool](ctx, NewClient(tm), "/users/alice", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+
+	polls := tm.DrainPolls()
+	if polls == 0 || polls > 25 {
+		t.Errorf("polled %d times, want a backed-off count", polls)
+	}
+	if tm.DrainPolls() != 0 || tm.Polls() != polls {
+		t.Errorf("DrainPolls should reset the per-step count but not the total")
+	}
+}
+
+// recordingObserver is a TaskObserver that records the calls it gets.
+type recordingObserver struct {
+	mu       sync.Mutex
+	started  []string
+	finished []TaskTiming
+}
+
+func (o *recordingObserver) TaskStarted(taskID models.TaskID, method, endpoint string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.started = append(o.started, fmt.Sprintf("%d %s %s", taskID, method, endpoint))
+}
+
+func (o *recordingObserver) TaskHeartbeat(models.TaskID, string, time.Duration, string) {}
+
+func (o *recordingObserver) TaskFinished(timing TaskTiming, _ error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.finished = append(o.finished, timing)
+}
+
+func TestTaskObserver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/1/tasks":
+			_, _ = w.Write([]byte(`{"result": {"pending": [], "completed": [7]}}`))
+		case "/api/1/tasks/7":
+			_, _ = w.Write([]byte(`{"result": {"status": "completed", "outcome": {"result": true, "message": ""}}}`))
+		default:
+			_, _ = w.Write([]byte(`{"result": {"task_id": 7}}`))
+		}
+	}))
+	defer server.Close()
+	tm := newTestManager(server.URL)
+	observer := &recordingObserver{}
+	tm.SetTaskObserver(observer)
+
+	if _, err := Post[bool](NewClient(tm), "/blockchains/transactions/decode", nil); err != nil {
+		t.Fatalf("err = %v", err)
+	}
+
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if want := []string{"7 POST /blockchains/transactions/decode"}; !slices.Equal(observer.started, want) {
+		t.Errorf("started = %q, want %q", observer.started, want)
+	}
+	if len(observer.finished) != 1 || observer.finished[0].ID != 7 || observer.finished[0].Failed {
+		t.Errorf("finished = %+v, want task 7 without failure", observer.finished)
+	}
+}
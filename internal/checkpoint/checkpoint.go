@@ -0,0 +1,221 @@
+// Package checkpoint records how far a sync run got (finished users, steps
+// and items) so an interrupted run can be resumed instead of starting over.
+// The checkpoint is one JSON file per data dir or attached backend under
+// <home>/checkpoints, rewritten atomically after every finished unit and
+// removed once a run completes.
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/paths"
+	"github.com/kelsos/rotki-sync/internal/utils"
+)
+
+// schemaVersion is bumped when the file layout changes incompatibly; a file
+// with another version is ignored (nothing to resume).
+const schemaVersion = 1
+
+// document is the on-disk layout.
+type document struct {
+	SchemaVersion int       `json:"schema_version"`
+	RunID         string    `json:"run_id"`
+	StartedAt     time.Time `json:"started_at"`
+	// Target is the rotki data the run synced (see config.Config.Target).
+	Target string           `json:"target"`
+	Users  map[string]*user `json:"users,omitempty"`
+}
+
+// user is the progress of one user. Finished steps drop their items and a
+// finished user drops its steps, so the file stays small.
+type user struct {
+	Done  bool                `json:"done,omitempty"`
+	Steps []string            `json:"steps,omitempty"`
+	Items map[string][]string `json:"items,omitempty"`
+}
+
+// Checkpoint is the progress of one run. All methods are safe for concurrent
+// use.
+type Checkpoint struct {
+	path string
+
+	mu   sync.Mutex
+	data document
+}
+
+// New returns an empty checkpoint that will be written to path, replacing any
+// earlier one on its first save.
+func New(path string) *Checkpoint {
+	return &Checkpoint{path: path, data: document{SchemaVersion: schemaVersion}}
+}
+
+// Open loads the checkpoint at path. A missing file is an empty checkpoint.
+func Open(path string) (*Checkpoint, error) {
+	c := New(path)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint %s: %w", path, err)
+	}
+	if doc.SchemaVersion == schemaVersion {
+		c.data = doc
+	}
+	return c, nil
+}
+
+// Default opens the checkpoint of the rotki data named by scope at the data
+// home (paths.CheckpointFile).
+func Default(scope string) (*Checkpoint, error) {
+	return Open(paths.CheckpointFile(scope))
+}
+
+// Empty reports whether no progress is recorded, i.e. there is nothing to
+// resume.
+func (c *Checkpoint) Empty() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.data.Users) == 0
+}
+
+// RunID returns the id of the run the checkpoint belongs to.
+func (c *Checkpoint) RunID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.data.RunID
+}
+
+// Target returns the rotki data the run synced.
+func (c *Checkpoint) Target() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.data.Target
+}
+
+// Reset forgets all progress, removes the checkpoint file of an earlier run
+// and starts the checkpoint of a new run against target. Nothing is written
+// until progress is recorded, so a new run that records none leaves nothing
+// to resume.
+func (c *Checkpoint) Reset(runID string, startedAt time.Time, target string) error {
+	c.mu.Lock()
+	c.data = document{SchemaVersion: schemaVersion, RunID: runID, StartedAt: startedAt, Target: target}
+	c.mu.Unlock()
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return nil
+}
+
+// UserDone reports whether every step of username finished.
+func (c *Checkpoint) UserDone(username string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u := c.data.Users[username]
+	return u != nil && u.Done
+}
+
+// StepDone reports whether step finished for username.
+func (c *Checkpoint) StepDone(username, step string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u := c.data.Users[username]
+	return u != nil && (u.Done || slices.Contains(u.Steps, step))
+}
+
+// ItemDone reports whether item (an account or chain) of step finished for
+// username.
+func (c *Checkpoint) ItemDone(username, step, item string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u := c.data.Users[username]
+	return u != nil && slices.Contains(u.Items[step], item)
+}
+
+// MarkItem records that item of step finished for username and saves.
+func (c *Checkpoint) MarkItem(username, step, item string) error {
+	c.mu.Lock()
+	u := c.userLocked(username)
+	if u.Items == nil {
+		u.Items = make(map[string][]string)
+	}
+	if !slices.Contains(u.Items[step], item) {
+		u.Items[step] = append(u.Items[step], item)
+	}
+	c.mu.Unlock()
+	return c.save()
+}
+
+// MarkStep records that step finished for username and saves.
+func (c *Checkpoint) MarkStep(username, step string) error {
+	c.mu.Lock()
+	u := c.userLocked(username)
+	if !slices.Contains(u.Steps, step) {
+		u.Steps = append(u.Steps, step)
+	}
+	delete(u.Items, step)
+	c.mu.Unlock()
+	return c.save()
+}
+
+// MarkUser records that every step finished for username and saves.
+func (c *Checkpoint) MarkUser(username string) error {
+	c.mu.Lock()
+	*c.userLocked(username) = user{Done: true}
+	c.mu.Unlock()
+	return c.save()
+}
+
+// Remove deletes the checkpoint file and forgets all progress.
+func (c *Checkpoint) Remove() error {
+	c.mu.Lock()
+	c.data.Users = nil
+	c.mu.Unlock()
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return nil
+}
+
+// userLocked returns the progress of username, creating it. The caller must
+// hold c.mu.
+func (c *Checkpoint) userLocked(username string) *user {
+	if c.data.Users == nil {
+		c.data.Users = make(map[string]*user)
+	}
+	u := c.data.Users[username]
+	if u == nil {
+		u = &user{}
+		c.data.Users[username] = u
+	}
+	return u
+}
+
+// save writes the checkpoint atomically.
+func (c *Checkpoint) save() error {
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c.data, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	data = append(data, '\n')
+
+	if err := utils.WriteFileAtomic(c.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
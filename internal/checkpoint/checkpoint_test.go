@@ -0,0 +1,95 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	c, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open on a missing file: %v", err)
+	}
+	if !c.Empty() {
+		t.Fatal("a missing file should be an empty checkpoint")
+	}
+
+	if err := c.Reset("20261001T093000Z", time.Now(), "data dir /data/a"); err != nil {
+		t.Fatal(err)
+	}
+	for _, mark := range []func() error{
+		func() error { return c.MarkUser("alice") },
+		func() error { return c.MarkStep("bob", "snapshot") },
+		func() error { return c.MarkItem("bob", "evm-fetch", "eth 0xabc") },
+	} {
+		if err := mark(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if reopened.Empty() || reopened.RunID() != "20261001T093000Z" || reopened.Target() != "data dir /data/a" {
+		t.Fatalf("reopened checkpoint = %+v", reopened.data)
+	}
+	if !reopened.UserDone("alice") || !reopened.StepDone("alice", "evm-fetch") {
+		t.Error("alice should be done with every step")
+	}
+	if reopened.UserDone("bob") {
+		t.Error("bob is not done")
+	}
+	if !reopened.StepDone("bob", "snapshot") || reopened.StepDone("bob", "evm-fetch") {
+		t.Error("only bob's snapshot step is done")
+	}
+	if !reopened.ItemDone("bob", "evm-fetch", "eth 0xabc") || reopened.ItemDone("bob", "evm-fetch", "eth 0xdef") {
+		t.Error("only bob's eth 0xabc fetch is done")
+	}
+}
+
+func TestMarkStepDropsItems(t *testing.T) {
+	c := New(filepath.Join(t.TempDir(), "checkpoint.json"))
+	if err := c.MarkItem("bob", "evm-fetch", "eth 0xabc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MarkStep("bob", "evm-fetch"); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.data.Users["bob"].Items) != 0 {
+		t.Errorf("items of a finished step should be dropped, got %v", c.data.Users["bob"].Items)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	c := New(path)
+	if err := c.MarkUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Remove(); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("checkpoint file still exists: %v", err)
+	}
+	if !c.Empty() {
+		t.Error("a removed checkpoint should be empty")
+	}
+	if err := c.Remove(); err != nil {
+		t.Errorf("removing a missing checkpoint: %v", err)
+	}
+}
+
+func TestOpenRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Fatal("expected an error for a corrupt checkpoint")
+	}
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -83,7 +84,12 @@ func (c *APIClient) BuildURL(endpoint string) string {
 
 // Get makes a GET request to the specified endpoint
 func (c *APIClient) Get(endpoint string, result interface{}) error {
-	return c.request(http.MethodGet, endpoint, nil, result, false)
+	return c.GetContext(context.Background(), endpoint, result)
+}
+
+// GetContext is like Get but gives up when ctx is done.
+func (c *APIClient) GetContext(ctx context.Context, endpoint string, result interface{}) error {
+	return c.request(ctx, http.MethodGet, endpoint, nil, result, false)
 }
 
 // GetQuiet is like Get but does not log a non-2xx response at error level. Use
@@ -92,33 +98,59 @@ func (c *APIClient) Get(endpoint string, result interface{}) error {
 // error in the logs. The typed *HTTPError is still returned so the caller can
 // inspect the status code (see IsUnavailable).
 func (c *APIClient) GetQuiet(endpoint string, result interface{}) error {
-	return c.request(http.MethodGet, endpoint, nil, result, true)
+	return c.GetQuietContext(context.Background(), endpoint, result)
+}
+
+// GetQuietContext is like GetQuiet but gives up when ctx is done.
+func (c *APIClient) GetQuietContext(ctx context.Context, endpoint string, result interface{}) error {
+	return c.request(ctx, http.MethodGet, endpoint, nil, result, true)
 }
 
 // Post makes a POST request to the specified endpoint
 func (c *APIClient) Post(endpoint string, body interface{}, result interface{}) error {
-	return c.request(http.MethodPost, endpoint, body, result, false)
+	return c.PostContext(context.Background(), endpoint, body, result)
+}
+
+// PostContext is like Post but gives up when ctx is done.
+func (c *APIClient) PostContext(ctx context.Context, endpoint string, body interface{}, result interface{}) error {
+	return c.request(ctx, http.MethodPost, endpoint, body, result, false)
 }
 
 // Put makes a PUT request to the specified endpoint
 func (c *APIClient) Put(endpoint string, body interface{}, result interface{}) error {
-	return c.request(http.MethodPut, endpoint, body, result, false)
+	return c.PutContext(context.Background(), endpoint, body, result)
+}
+
+// PutContext is like Put but gives up when ctx is done.
+func (c *APIClient) PutContext(ctx context.Context, endpoint string, body interface{}, result interface{}) error {
+	return c.request(ctx, http.MethodPut, endpoint, body, result, false)
 }
 
 // Delete makes a DELETE request to the specified endpoint
 func (c *APIClient) Delete(endpoint string, result interface{}) error {
-	return c.request(http.MethodDelete, endpoint, nil, result, false)
+	return c.DeleteContext(context.Background(), endpoint, result)
+}
+
+// DeleteContext is like Delete but gives up when ctx is done.
+func (c *APIClient) DeleteContext(ctx context.Context, endpoint string, result interface{}) error {
+	return c.request(ctx, http.MethodDelete, endpoint, nil, result, false)
 }
 
 // Patch makes a PATCH request to the specified endpoint
 func (c *APIClient) Patch(endpoint string, body interface{}, result interface{}) error {
-	return c.request(http.MethodPatch, endpoint, body, result, false)
+	return c.PatchContext(context.Background(), endpoint, body, result)
+}
+
+// PatchContext is like Patch but gives up when ctx is done.
+func (c *APIClient) PatchContext(ctx context.Context, endpoint string, body interface{}, result interface{}) error {
+	return c.request(ctx, http.MethodPatch, endpoint, body, result, false)
 }
 
 // request is the core HTTP request method. When quiet is true a non-2xx
 // response is returned as a typed *HTTPError without being logged at error
-// level (the caller is expected to handle it).
-func (c *APIClient) request(method, endpoint string, body interface{}, result interface{}, quiet bool) error {
+// level (the caller is expected to handle it). The request is abandoned when
+// ctx is done.
+func (c *APIClient) request(ctx context.Context, method, endpoint string, body interface{}, result interface{}, quiet bool) error {
 	url := c.BuildURL(endpoint)
 	start := time.Now()
 	logger.Debug("Starting %s request to %s", method, url)
@@ -132,7 +164,7 @@ func (c *APIClient) request(method, endpoint string, body interface{}, result in
 		requestBody = bytes.NewBuffer(jsonBody)
 	}
 
-	req, err := http.NewRequest(method, url, requestBody)
+	req, err := http.NewRequestWithContext(ctx, method, url, requestBody)
 	if err != nil {
 		return fmt.Errorf("error creating request: %w", err)
 	}
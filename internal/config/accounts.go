@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/kelsos/rotki-sync/internal/models"
+)
+
+// AccountRules selects the accounts the transaction fetch, decode and token
+// detection steps work on. An empty Include selects every account; Exclude is
+// applied after it. Balances are not affected: rotki-core still tracks every
+// account.
+type AccountRules struct {
+	Include []AccountRule `toml:"include"`
+	Exclude []AccountRule `toml:"exclude"`
+}
+
+// AccountRule matches accounts. Every field that is set must match, so
+// { chain = "eth", tag = "cold" } only matches cold-tagged accounts on eth.
+type AccountRule struct {
+	// Chain is a path.Match glob against the chain id (e.g. "eth") or the EVM
+	// chain name (e.g. "ethereum").
+	Chain string `toml:"chain"`
+	// ChainType is a chain type such as "evm" or "solana".
+	ChainType string `toml:"chain_type"`
+	// Address matches the account address, ignoring case.
+	Address string `toml:"address"`
+	// Tag matches accounts carrying this rotki tag.
+	Tag string `toml:"tag"`
+	// Label is a path.Match glob against the account label.
+	Label string `toml:"label"`
+}
+
+// AccountRef is the part of an account that rules match against.
+type AccountRef struct {
+	ChainID   string
+	EvmChain  string
+	ChainType string
+	Address   string
+	Label     string
+	Tags      []string
+}
+
+// IsEmpty reports whether no rules are configured.
+func (r AccountRules) IsEmpty() bool {
+	return len(r.Include) == 0 && len(r.Exclude) == 0
+}
+
+// Selected reports whether the rules select account. Patterns are assumed
+// valid (see Validate).
+func (r AccountRules) Selected(account AccountRef) bool {
+	if len(r.Include) > 0 && !slices.ContainsFunc(r.Include, func(rule AccountRule) bool {
+		return rule.matches(account)
+	}) {
+		return false
+	}
+	return !slices.ContainsFunc(r.Exclude, func(rule AccountRule) bool {
+		return rule.matches(account)
+	})
+}
+
+// ChainSelected reports whether any account on the chain can be selected, for
+// steps that work on whole chains (decoding). A chain is dropped when an
+// exclude rule without account fields matches it, or when no include rule can
+// match it.
+func (r AccountRules) ChainSelected(chainID, evmChain, chainType string) bool {
+	chain := AccountRef{ChainID: chainID, EvmChain: evmChain, ChainType: chainType}
+	if len(r.Include) > 0 && !slices.ContainsFunc(r.Include, func(rule AccountRule) bool {
+		return rule.matchesChain(chain)
+	}) {
+		return false
+	}
+	return !slices.ContainsFunc(r.Exclude, func(rule AccountRule) bool {
+		return !rule.hasAccountFields() && rule.matchesChain(chain)
+	})
+}
+
+func (r AccountRule) matches(account AccountRef) bool {
+	if !r.matchesChain(account) {
+		return false
+	}
+	if r.Address != "" && !strings.EqualFold(r.Address, account.Address) {
+		return false
+	}
+	if r.Tag != "" && !slices.Contains(account.Tags, r.Tag) {
+		return false
+	}
+	if r.Label != "" {
+		if ok, _ := path.Match(r.Label, account.Label); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesChain checks only the chain fields of the rule.
+func (r AccountRule) matchesChain(account AccountRef) bool {
+	if r.Chain != "" {
+		id, _ := path.Match(r.Chain, account.ChainID)
+		name, _ := path.Match(r.Chain, account.EvmChain)
+		if !id && !(name && account.EvmChain != "") {
+			return false
+		}
+	}
+	return r.ChainType == "" || r.ChainType == account.ChainType
+}
+
+func (r AccountRule) hasAccountFields() bool {
+	return r.Address != "" || r.Tag != "" || r.Label != ""
+}
+
+// chainTypes are the chain types a rule may name.
+var chainTypes = []string{
+	models.ChainTypeEvm,
+	models.ChainTypeEvmLike,
+	models.ChainTypeBitcoin,
+	models.ChainTypeSolana,
+	models.ChainTypeSubstrate,
+}
+
+// validate rejects rules that match every account, unknown chain types and
+// malformed patterns.
+func (r AccountRules) validate() error {
+	for _, list := range []struct {
+		name  string
+		rules []AccountRule
+	}{{"include", r.Include}, {"exclude", r.Exclude}} {
+		for i, rule := range list.rules {
+			if rule == (AccountRule{}) {
+				return fmt.Errorf("accounts.%s rule %d is empty; set chain, chain_type, address, tag or label", list.name, i+1)
+			}
+			if rule.ChainType != "" && !slices.Contains(chainTypes, rule.ChainType) {
+				return fmt.Errorf("accounts.%s rule %d: unknown chain type %q (valid: %s)",
+					list.name, i+1, rule.ChainType, strings.Join(chainTypes, ", "))
+			}
+			for _, pattern := range []string{rule.Chain, rule.Label} {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("accounts.%s rule %d: invalid pattern %q: %w", list.name, i+1, pattern, err)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import "testing"
+
+func TestAccountRulesSelected(t *testing.T) {
+	cold := AccountRef{ChainID: "eth", EvmChain: "ethereum", ChainType: "evm", Address: "0xAbC", Label: "cold wallet", Tags: []string{"cold"}}
+	hot := AccountRef{ChainID: "optimism", EvmChain: "optimism", ChainType: "evm", Address: "0xdef", Label: "hot"}
+	sol := AccountRef{ChainID: "solana", ChainType: "solana", Address: "Sol1"}
+
+	tests := []struct {
+		name  string
+		rules AccountRules
+		want  []bool // cold, hot, sol
+	}{
+		{"no rules", AccountRules{}, []bool{true, true, true}},
+		{"exclude chain id", AccountRules{Exclude: []AccountRule{{Chain: "eth"}}}, []bool{false, true, true}},
+		{"exclude evm chain name", AccountRules{Exclude: []AccountRule{{Chain: "ethereum"}}}, []bool{false, true, true}},
+		{"exclude chain glob", AccountRules{Exclude: []AccountRule{{Chain: "*"}}}, []bool{false, false, false}},
+		{"exclude chain type", AccountRules{Exclude: []AccountRule{{ChainType: "solana"}}}, []bool{true, true, false}},
+		{"exclude address ignores case", AccountRules{Exclude: []AccountRule{{Address: "0xabc"}}}, []bool{false, true, true}},
+		{"exclude tag", AccountRules{Exclude: []AccountRule{{Tag: "cold"}}}, []bool{false, true, true}},
+		{"exclude label glob", AccountRules{Exclude: []AccountRule{{Label: "cold*"}}}, []bool{false, true, true}},
+		{"all fields must match", AccountRules{Exclude: []AccountRule{{Chain: "optimism", Tag: "cold"}}}, []bool{true, true, true}},
+		{"include tag", AccountRules{Include: []AccountRule{{Tag: "cold"}}}, []bool{true, false, false}},
+		{"include then exclude", AccountRules{
+			Include: []AccountRule{{ChainType: "evm"}},
+			Exclude: []AccountRule{{Label: "hot"}},
+		}, []bool{true, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, account := range []AccountRef{cold, hot, sol} {
+				if got := tt.rules.Selected(account); got != tt.want[i] {
+					t.Errorf("Selected(%s %s) = %v, want %v", account.ChainID, account.Address, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAccountRulesChainSelected(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules AccountRules
+		want  bool
+	}{
+		{"no rules", AccountRules{}, true},
+		{"excluded chain", AccountRules{Exclude: []AccountRule{{Chain: "eth"}}}, false},
+		{"excluded chain type", AccountRules{Exclude: []AccountRule{{ChainType: "evm"}}}, false},
+		{"account exclusion keeps the chain", AccountRules{Exclude: []AccountRule{{Chain: "eth", Tag: "cold"}}}, true},
+		{"included by account rule", AccountRules{Include: []AccountRule{{Tag: "cold"}}}, true},
+		{"included elsewhere", AccountRules{Include: []AccountRule{{Chain: "optimism"}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.ChainSelected("eth", "ethereum", "evm"); got != tt.want {
+				t.Errorf("ChainSelected = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAccountRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   AccountRules
+		wantErr bool
+	}{
+		{"valid", AccountRules{Exclude: []AccountRule{{Chain: "eth"}, {ChainType: "bitcoin"}}}, false},
+		{"empty rule", AccountRules{Include: []AccountRule{{}}}, true},
+		{"unknown chain type", AccountRules{Exclude: []AccountRule{{ChainType: "cosmos"}}}, true},
+		{"bad pattern", AccountRules{Exclude: []AccountRule{{Label: "["}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.Accounts = tt.rules
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,12 +2,17 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/kelsos/rotki-sync/internal/logger"
 	"github.com/kelsos/rotki-sync/internal/paths"
 )
 
@@ -22,23 +27,259 @@ func defaultBinPath() string {
 	return filepath.Join(paths.BinDir(), "rotki-core", exe)
 }
 
-// Config holds all application configuration
+// Config holds all application configuration. Values are layered with
+// increasing precedence: defaults, the config file (LoadFile), the environment
+// (LoadFromEnvironment) and command-line flags. The toml tags name the config
+// file keys.
 type Config struct {
 	// Server settings
-	Port            int
-	BinPath         string
-	DataDir         string
-	APIReadyTimeout int
+	Port            int    `toml:"port"`
+	BinPath         string `toml:"bin_path"`
+	DataDir         string `toml:"data_dir"`
+	APIReadyTimeout int    `toml:"api_ready_timeout"`
 
-	// Retry settings
-	MaxRetries int
-	RetryDelay time.Duration
+	// Retry settings: an item that failed transiently is retried up to
+	// MaxRetries times (see StepRetries), waiting RetryDelay before the first
+	// retry and twice as long before each later one.
+	MaxRetries int           `toml:"max_retries"`
+	RetryDelay time.Duration `toml:"retry_delay"`
+	// Retries overrides MaxRetries for individual steps.
+	Retries RetryConfig `toml:"retries"`
 
 	// API settings
-	BaseURL string
+	BaseURL string `toml:"-"`
+
+	// Attach is the URL of an already-running rotki-core (e.g. the desktop
+	// app's backend or a container sidecar) to use instead of starting one.
+	// Empty starts and stops rotki-core for each run.
+	Attach string `toml:"attach"`
+	// ForceLogout allows an attached run to log out users whose session it did
+	// not start.
+	ForceLogout bool `toml:"force_logout"`
+
+	// FullSync ignores the incremental fetch state for this run and queries
+	// the whole history of every account and exchange.
+	FullSync bool `toml:"-"`
+
+	// Resume continues the run recorded in the checkpoint file, skipping the
+	// users, steps and items it finished.
+	Resume bool `toml:"-"`
+
+	// ShutdownTimeout is how long an interrupted run waits for the async tasks
+	// in flight before it stops waiting for them (0 stops at once).
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout"`
 
 	// Backup settings
-	BackupDir string
+	BackupDir string `toml:"backup_dir"`
+
+	// AlertWebhook is the URL notified on a failed run (empty disables).
+	AlertWebhook string `toml:"alert_webhook"`
+
+	// LogKeep is the number of per-run logs and JSON run reports to retain
+	// (0 disables pruning).
+	LogKeep int `toml:"log_keep"`
+
+	// ReportJSON is an extra path the JSON run report is written to, besides
+	// the reports directory under the data home (empty disables).
+	ReportJSON string `toml:"report_json"`
+
+	// MetricsFile is where an OpenMetrics text file describing the last run is
+	// written, e.g. for the node_exporter textfile collector (empty disables).
+	MetricsFile string `toml:"metrics_file"`
+
+	// Users and ExcludeUsers select which rotki users are processed, as
+	// path.Match globs. An empty Users selects every user; ExcludeUsers is
+	// applied after it.
+	Users        []string `toml:"users"`
+	ExcludeUsers []string `toml:"exclude_users"`
+
+	// Steps selects which sync steps run.
+	Steps StepSelection `toml:"steps"`
+
+	// Daemon configures the long-running `daemon` mode.
+	Daemon DaemonConfig `toml:"daemon"`
+
+	// Concurrency bounds the parallel per-account transaction fetches.
+	Concurrency ConcurrencyConfig `toml:"concurrency"`
+
+	// RateLimits sets how the run reacts to rotki-core being rate-limited by
+	// a remote provider.
+	RateLimits RateLimitConfig `toml:"rate_limits"`
+
+	// Events configures the machine-readable event stream of a run.
+	Events EventsConfig `toml:"events"`
+
+	// Accounts selects which accounts transactions are fetched, decoded and
+	// tokens detected for.
+	Accounts AccountRules `toml:"accounts"`
+
+	// Timeouts bounds how long the sync steps may take.
+	Timeouts TimeoutConfig `toml:"timeouts"`
+
+	// file is the config file that was loaded, if any.
+	file string
+	// sources records where each non-default value came from, keyed by
+	// config file key (e.g. "port", "steps.only").
+	sources map[string]Source
+}
+
+// DaemonConfig configures the `daemon` command.
+type DaemonConfig struct {
+	// Schedule is an OnCalendar-style expression for when runs start.
+	Schedule string `toml:"schedule"`
+	// KeepCore keeps rotki-core running between runs instead of starting and
+	// stopping it for every run.
+	KeepCore bool `toml:"keep_core"`
+}
+
+// ConcurrencyConfig bounds how many per-account transaction fetches run at
+// once. Workers caps the whole run; ChainWorkers caps each chain, so the
+// parallelism comes from working on several chains at a time without bursting
+// a single chain's explorer API. BatchSize groups up to that many accounts of
+// a chain into one request (1 sends one request per account).
+type ConcurrencyConfig struct {
+	Workers      int `toml:"workers"`
+	ChainWorkers int `toml:"chain_workers"`
+	BatchSize    int `toml:"batch_size"`
+	// Chains overrides ChainWorkers for individual chain ids
+	// ([concurrency.chain.<id>]).
+	Chains map[string]ChainConcurrency `toml:"chain"`
+}
+
+// ChainConcurrency is the concurrency override for one chain.
+type ChainConcurrency struct {
+	Workers int `toml:"workers"`
+}
+
+// ChainLimit returns the maximum number of concurrent fetches for the chain
+// with the given id. It never exceeds Workers.
+func (c ConcurrencyConfig) ChainLimit(chainID string) int {
+	limit := c.ChainWorkers
+	if chain, ok := c.Chains[chainID]; ok && chain.Workers > 0 {
+		limit = chain.Workers
+	}
+	if limit <= 0 || limit > c.Workers {
+		limit = c.Workers
+	}
+	return max(limit, 1)
+}
+
+// RateLimitConfig sets how the run reacts to the rate-limit markers in the
+// rotki-core log. A new fetch, decode or token detection task for a chain
+// that was hit by a provider still rate-limited waits up to Pause for it to
+// clear (0 never waits). Reorder works on the chains no rate-limited provider
+// hit first.
+type RateLimitConfig struct {
+	Pause   time.Duration `toml:"pause"`
+	Reorder bool          `toml:"reorder"`
+}
+
+// EventsFormatNDJSON writes one JSON document per event and line.
+const EventsFormatNDJSON = "ndjson"
+
+// EventsConfig configures the event stream: every login, logout, step start
+// and finish, item result, async task start and finish, and heartbeat of a
+// run. An empty Format disables it. Output is "-" (or empty) for stdout,
+// "unix:" followed by the path of a listening unix socket, or a file the
+// events are appended to.
+type EventsConfig struct {
+	Format string `toml:"format"`
+	Output string `toml:"output"`
+}
+
+// Enabled reports whether an event stream is written.
+func (e EventsConfig) Enabled() bool {
+	return e.Format != ""
+}
+
+// ToStdout reports whether the event stream is written to stdout.
+func (e EventsConfig) ToStdout() bool {
+	return e.Enabled() && (e.Output == "" || e.Output == "-")
+}
+
+// DefaultRateLimitPause holds a new task back for at most a minute, about
+// two of rotki-core's own back-off rounds.
+const DefaultRateLimitPause = time.Minute
+
+// Default concurrency: one fetch at a time, one account per request.
+// Concurrent fetching is opt-in, so rotki-core and its rate-limited providers
+// see no more load than before unless a user asks for it.
+const (
+	DefaultWorkers      = 1
+	DefaultChainWorkers = 1
+	DefaultBatchSize    = 1
+)
+
+// DefaultShutdownTimeout leaves in-flight tasks enough time to finish within
+// systemd's default 90s stop timeout, with room for logging out and writing
+// the report.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// DefaultSchedule runs once a day at 09:30, matching the systemd timer.
+const DefaultSchedule = "*-*-* 09:30:00"
+
+// StepSelection enables or disables sync steps by id (e.g. "evm-fetch",
+// "token-detection"). An empty Only runs every step; Skip is applied after it.
+type StepSelection struct {
+	Only []string `toml:"only"`
+	Skip []string `toml:"skip"`
+	// Users refines the selection for individual users ([steps.user.<name>]).
+	Users map[string]StepFilter `toml:"user"`
+}
+
+// StepFilter is a per-user step selection. A non-empty Only replaces the global
+// Only for that user; Skip adds to the global Skip.
+type StepFilter struct {
+	Only []string `toml:"only"`
+	Skip []string `toml:"skip"`
+}
+
+// Enabled reports whether step should run for username.
+func (s StepSelection) Enabled(username, step string) bool {
+	only, skip := s.Only, s.Skip
+	if user, ok := s.Users[username]; ok {
+		if len(user.Only) > 0 {
+			only = user.Only
+		}
+		skip = append(append([]string{}, skip...), user.Skip...)
+	}
+	if len(only) > 0 && !slices.Contains(only, step) {
+		return false
+	}
+	return !slices.Contains(skip, step)
+}
+
+// Names returns every step id referenced by the selection, for validation.
+func (s StepSelection) Names() []string {
+	names := append(append([]string{}, s.Only...), s.Skip...)
+	for _, user := range s.Users {
+		names = append(names, user.Only...)
+		names = append(names, user.Skip...)
+	}
+	return names
+}
+
+// UserSelected reports whether username passes the Users/ExcludeUsers
+// selection. Patterns are assumed valid (see Validate).
+func (c *Config) UserSelected(username string) bool {
+	if len(c.Users) > 0 && !matchAny(c.Users, username) {
+		return false
+	}
+	return !matchAny(c.ExcludeUsers, username)
+}
+
+// HasUserSelection reports whether any user include or exclude pattern is set.
+func (c *Config) HasUserSelection() bool {
+	return len(c.Users) > 0 || len(c.ExcludeUsers) > 0
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
 }
 
 // NewConfig creates a new configuration with default values
@@ -47,9 +288,18 @@ func NewConfig() *Config {
 		Port:            59001,
 		BinPath:         defaultBinPath(),
 		APIReadyTimeout: 30,
-		MaxRetries:      10,
+		MaxRetries:      3,
 		RetryDelay:      2 * time.Second,
+		ShutdownTimeout: DefaultShutdownTimeout,
 		BackupDir:       "~/backups",
+		LogKeep:         logger.DefaultLogKeep,
+		Daemon:          DaemonConfig{Schedule: DefaultSchedule},
+		Concurrency: ConcurrencyConfig{
+			Workers:      DefaultWorkers,
+			ChainWorkers: DefaultChainWorkers,
+			BatchSize:    DefaultBatchSize,
+		},
+		RateLimits: RateLimitConfig{Pause: DefaultRateLimitPause},
 	}
 }
 
@@ -58,45 +308,237 @@ func (c *Config) LoadFromEnvironment() {
 	if port := os.Getenv("ROTKI_PORT"); port != "" {
 		if p, err := strconv.Atoi(port); err == nil {
 			c.Port = p
+			c.SetSource("port", SourceEnv)
 		}
 	}
 
 	if binPath := os.Getenv("ROTKI_BIN_PATH"); binPath != "" {
 		c.BinPath = binPath
+		c.SetSource("bin_path", SourceEnv)
 	}
 
 	if dataDir := os.Getenv("ROTKI_DATA_DIR"); dataDir != "" {
 		c.DataDir = dataDir
+		c.SetSource("data_dir", SourceEnv)
 	}
 
 	if timeout := os.Getenv("ROTKI_API_TIMEOUT"); timeout != "" {
 		if t, err := strconv.Atoi(timeout); err == nil {
 			c.APIReadyTimeout = t
+			c.SetSource("api_ready_timeout", SourceEnv)
 		}
 	}
 
 	if retries := os.Getenv("ROTKI_MAX_RETRIES"); retries != "" {
 		if r, err := strconv.Atoi(retries); err == nil {
 			c.MaxRetries = r
+			c.SetSource("max_retries", SourceEnv)
 		}
 	}
 
 	if delay := os.Getenv("ROTKI_RETRY_DELAY"); delay != "" {
 		if d, err := strconv.Atoi(delay); err == nil {
 			c.RetryDelay = time.Duration(d) * time.Millisecond
+			c.SetSource("retry_delay", SourceEnv)
+		}
+	}
+
+	if retries := os.Getenv("ROTKI_SYNC_STEP_RETRIES"); retries != "" {
+		if r, err := ParseRetries(retries); err == nil {
+			c.SetStepRetries(r, SourceEnv)
+		}
+	}
+
+	if timeout := os.Getenv("ROTKI_SYNC_SHUTDOWN_TIMEOUT"); timeout != "" {
+		if t, err := time.ParseDuration(timeout); err == nil {
+			c.ShutdownTimeout = t
+			c.SetSource("shutdown_timeout", SourceEnv)
+		}
+	}
+
+	if timeouts := os.Getenv("ROTKI_SYNC_STEP_TIMEOUTS"); timeouts != "" {
+		if t, err := ParseTimeouts(timeouts); err == nil {
+			c.SetStepTimeouts(t, SourceEnv)
+		}
+	}
+
+	if timeout := os.Getenv("ROTKI_SYNC_TASK_TIMEOUT"); timeout != "" {
+		if t, err := time.ParseDuration(timeout); err == nil {
+			c.Timeouts.Task = t
+			c.SetSource("timeouts.task", SourceEnv)
 		}
 	}
 
 	if backupDir := os.Getenv("ROTKI_BACKUP_DIR"); backupDir != "" {
 		c.BackupDir = backupDir
+		c.SetSource("backup_dir", SourceEnv)
+	}
+
+	if webhook := os.Getenv("ROTKI_SYNC_ALERT_WEBHOOK"); webhook != "" {
+		c.AlertWebhook = webhook
+		c.SetSource("alert_webhook", SourceEnv)
+	}
+
+	if reportJSON := os.Getenv("ROTKI_SYNC_REPORT_JSON"); reportJSON != "" {
+		c.ReportJSON = reportJSON
+		c.SetSource("report_json", SourceEnv)
+	}
+
+	if metricsFile := os.Getenv("ROTKI_SYNC_METRICS_FILE"); metricsFile != "" {
+		c.MetricsFile = metricsFile
+		c.SetSource("metrics_file", SourceEnv)
+	}
+
+	if schedule := os.Getenv("ROTKI_SYNC_SCHEDULE"); schedule != "" {
+		c.Daemon.Schedule = schedule
+		c.SetSource("daemon.schedule", SourceEnv)
+	}
+
+	if keepCore := os.Getenv("ROTKI_SYNC_KEEP_CORE"); keepCore != "" {
+		if k, err := strconv.ParseBool(keepCore); err == nil {
+			c.Daemon.KeepCore = k
+			c.SetSource("daemon.keep_core", SourceEnv)
+		}
+	}
+
+	if workers := os.Getenv("ROTKI_SYNC_WORKERS"); workers != "" {
+		if w, err := strconv.Atoi(workers); err == nil {
+			c.Concurrency.Workers = w
+			c.SetSource("concurrency.workers", SourceEnv)
+		}
+	}
+
+	if chainWorkers := os.Getenv("ROTKI_SYNC_CHAIN_WORKERS"); chainWorkers != "" {
+		if w, err := strconv.Atoi(chainWorkers); err == nil {
+			c.Concurrency.ChainWorkers = w
+			c.SetSource("concurrency.chain_workers", SourceEnv)
+		}
+	}
+
+	if batchSize := os.Getenv("ROTKI_SYNC_BATCH_SIZE"); batchSize != "" {
+		if b, err := strconv.Atoi(batchSize); err == nil {
+			c.Concurrency.BatchSize = b
+			c.SetSource("concurrency.batch_size", SourceEnv)
+		}
+	}
+
+	if pause := os.Getenv("ROTKI_SYNC_RATE_LIMIT_PAUSE"); pause != "" {
+		if p, err := time.ParseDuration(pause); err == nil {
+			c.RateLimits.Pause = p
+			c.SetSource("rate_limits.pause", SourceEnv)
+		}
+	}
+
+	if reorder := os.Getenv("ROTKI_SYNC_RATE_LIMIT_REORDER"); reorder != "" {
+		if r, err := strconv.ParseBool(reorder); err == nil {
+			c.RateLimits.Reorder = r
+			c.SetSource("rate_limits.reorder", SourceEnv)
+		}
+	}
+
+	if format := os.Getenv("ROTKI_SYNC_EVENTS"); format != "" {
+		c.Events.Format = format
+		c.SetSource("events.format", SourceEnv)
+	}
+
+	if output := os.Getenv("ROTKI_SYNC_EVENTS_OUTPUT"); output != "" {
+		c.Events.Output = output
+		c.SetSource("events.output", SourceEnv)
+	}
+
+	if users := os.Getenv("ROTKI_SYNC_USERS"); users != "" {
+		c.Users = splitList(users)
+		c.SetSource("users", SourceEnv)
+	}
+
+	if exclude := os.Getenv("ROTKI_SYNC_EXCLUDE_USERS"); exclude != "" {
+		c.ExcludeUsers = splitList(exclude)
+		c.SetSource("exclude_users", SourceEnv)
+	}
+
+	if only := os.Getenv("ROTKI_SYNC_ONLY"); only != "" {
+		c.Steps.Only = splitList(only)
+		c.SetSource("steps.only", SourceEnv)
+	}
+
+	if skip := os.Getenv("ROTKI_SYNC_SKIP"); skip != "" {
+		c.Steps.Skip = splitList(skip)
+		c.SetSource("steps.skip", SourceEnv)
+	}
+
+	if attach := os.Getenv("ROTKI_SYNC_ATTACH"); attach != "" {
+		c.Attach = attach
+		c.SetSource("attach", SourceEnv)
+	}
+
+	if force := os.Getenv("ROTKI_SYNC_FORCE_LOGOUT"); force != "" {
+		if f, err := strconv.ParseBool(force); err == nil {
+			c.ForceLogout = f
+			c.SetSource("force_logout", SourceEnv)
+		}
+	}
+
+	if keep := os.Getenv("ROTKI_SYNC_LOG_KEEP"); keep != "" {
+		if k, err := strconv.Atoi(keep); err == nil && k >= 0 {
+			c.LogKeep = k
+			c.SetSource("log_keep", SourceEnv)
+		}
 	}
 }
 
-// SetBaseURL sets the base URL based on the configured port
+// splitList parses a comma-separated environment value, dropping blanks.
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// SetBaseURL sets the base URL from the attach URL, or based on the configured
+// port when rotki-core is started locally.
 func (c *Config) SetBaseURL() {
+	if c.Attached() {
+		c.BaseURL = strings.TrimSuffix(strings.TrimRight(c.Attach, "/"), "/api/1")
+		return
+	}
 	c.BaseURL = fmt.Sprintf("http://localhost:%d", c.Port)
 }
 
+// Attached reports whether runs use an already-running rotki-core instead of
+// starting one.
+func (c *Config) Attached() bool {
+	return c.Attach != ""
+}
+
+// Target describes the rotki data a run syncs, in words: the attached
+// rotki-core's URL (see SetBaseURL) or the absolute data dir.
+func (c *Config) Target() string {
+	if c.Attached() {
+		return "rotki-core at " + c.BaseURL
+	}
+	if c.DataDir == "" {
+		return "the default data dir"
+	}
+	dir := c.DataDir
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return "data dir " + dir
+}
+
+// ScopeKey names the rotki data a run syncs, for the files rotki-sync keeps
+// per data dir: "backend-" and a key of the attached rotki-core's URL (see
+// SetBaseURL), or "data-" and a key of the data dir (see paths.DataDirKey).
+func (c *Config) ScopeKey() string {
+	if c.Attached() {
+		return "backend-" + paths.BackendKey(c.BaseURL)
+	}
+	return "data-" + paths.DataDirKey(c.DataDir)
+}
+
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
 	if c.Port < 1024 || c.Port > 65535 {
@@ -115,5 +557,68 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("max retries must be non-negative, got: %d", c.MaxRetries)
 	}
 
+	if c.RetryDelay < 0 {
+		return fmt.Errorf("retry delay must be non-negative, got: %s", c.RetryDelay)
+	}
+
+	if err := c.Retries.validate(); err != nil {
+		return err
+	}
+
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdown timeout must be non-negative, got: %s", c.ShutdownTimeout)
+	}
+
+	if c.Attached() {
+		u, err := url.Parse(c.Attach)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("attach URL must be an http(s) URL such as http://127.0.0.1:4242, got: %q", c.Attach)
+		}
+	}
+
+	if c.Concurrency.Workers < 1 {
+		return fmt.Errorf("workers must be at least 1, got: %d", c.Concurrency.Workers)
+	}
+
+	if c.Concurrency.ChainWorkers < 0 {
+		return fmt.Errorf("chain workers must be non-negative, got: %d", c.Concurrency.ChainWorkers)
+	}
+
+	if c.Concurrency.BatchSize < 1 {
+		return fmt.Errorf("batch size must be at least 1, got: %d", c.Concurrency.BatchSize)
+	}
+
+	for chain, limit := range c.Concurrency.Chains {
+		if limit.Workers < 0 {
+			return fmt.Errorf("workers for chain %s must be non-negative, got: %d", chain, limit.Workers)
+		}
+	}
+
+	if c.RateLimits.Pause < 0 {
+		return fmt.Errorf("rate limit pause must be non-negative, got: %s", c.RateLimits.Pause)
+	}
+
+	if c.Events.Enabled() && c.Events.Format != EventsFormatNDJSON {
+		return fmt.Errorf("events format must be %q, got: %q", EventsFormatNDJSON, c.Events.Format)
+	}
+
+	if err := c.Accounts.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Timeouts.validate(); err != nil {
+		return err
+	}
+
+	if c.LogKeep < 0 {
+		return fmt.Errorf("log keep must be non-negative, got: %d", c.LogKeep)
+	}
+
+	for _, pattern := range append(append([]string{}, c.Users...), c.ExcludeUsers...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid user pattern %q: %w", pattern, err)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStepSelectionEnabled(t *testing.T) {
+	sel := StepSelection{
+		Skip: []string{"token-detection"},
+		Users: map[string]StepFilter{
+			"hourly": {Only: []string{"exchange-trades"}},
+			"slow":   {Skip: []string{"evm-decode"}},
+		},
+	}
+
+	cases := []struct {
+		user, step string
+		want       bool
+	}{
+		{"alice", "evm-fetch", true},
+		{"alice", "token-detection", false},
+		{"hourly", "exchange-trades", true},
+		{"hourly", "evm-fetch", false},
+		{"slow", "evm-decode", false},
+		{"slow", "token-detection", false},
+		{"slow", "evm-fetch", true},
+	}
+	for _, tc := range cases {
+		if got := sel.Enabled(tc.user, tc.step); got != tc.want {
+			t.Errorf("Enabled(%q, %q) = %v, want %v", tc.user, tc.step, got, tc.want)
+		}
+	}
+
+	// Per-user skips must not leak into the shared global slice.
+	if len(sel.Skip) != 1 {
+		t.Errorf("global Skip mutated: %v", sel.Skip)
+	}
+}
+
+func TestStepSelectionOnlyLimitsEveryUser(t *testing.T) {
+	sel := StepSelection{Only: []string{"evm-fetch", "evm-decode"}}
+	if !sel.Enabled("alice", "evm-decode") {
+		t.Error("evm-decode should be enabled")
+	}
+	if sel.Enabled("alice", "snapshot") {
+		t.Error("snapshot should be disabled by only")
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	got := splitList(" evm-fetch, ,evm-decode ")
+	if want := []string{"evm-fetch", "evm-decode"}; !slices.Equal(got, want) {
+		t.Fatalf("splitList = %v, want %v", got, want)
+	}
+}
+
+func TestUserSelected(t *testing.T) {
+	cfg := NewConfig()
+	cfg.ExcludeUsers = []string{"test*", "archived"}
+
+	cases := []struct {
+		user string
+		want bool
+	}{
+		{"alice", true},
+		{"testing", false},
+		{"test", false},
+		{"archived", false},
+		{"archived-2019", true},
+	}
+	for _, tc := range cases {
+		if got := cfg.UserSelected(tc.user); got != tc.want {
+			t.Errorf("UserSelected(%q) = %v, want %v", tc.user, got, tc.want)
+		}
+	}
+
+	cfg.Users = []string{"a*"}
+	if cfg.UserSelected("bob") {
+		t.Error("bob should not match users a*")
+	}
+	if cfg.UserSelected("archived") {
+		t.Error("exclude must win over an include match")
+	}
+	if !cfg.UserSelected("alice") {
+		t.Error("alice should match users a*")
+	}
+}
+
+func TestValidateRejectsBadUserPattern(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Users = []string{"[alice"}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected malformed pattern to be rejected")
+	}
+}
+
+func TestSetBaseURLAttach(t *testing.T) {
+	tests := []struct {
+		attach string
+		want   string
+	}{
+		{attach: "", want: "http://localhost:59001"},
+		{attach: "http://127.0.0.1:4242", want: "http://127.0.0.1:4242"},
+		{attach: "http://rotki:4242/", want: "http://rotki:4242"},
+		{attach: "https://rotki.lan/api/1/", want: "https://rotki.lan"},
+	}
+	for _, tc := range tests {
+		cfg := NewConfig()
+		cfg.Attach = tc.attach
+		cfg.SetBaseURL()
+		if cfg.BaseURL != tc.want {
+			t.Errorf("Attach %q: BaseURL = %q, want %q", tc.attach, cfg.BaseURL, tc.want)
+		}
+	}
+}
+
+func TestScopeKey(t *testing.T) {
+	scope := func(dataDir, attach string) string {
+		cfg := NewConfig()
+		cfg.DataDir, cfg.Attach = dataDir, attach
+		cfg.SetBaseURL()
+		return cfg.ScopeKey()
+	}
+
+	if scope("", "") != "data-default" {
+		t.Errorf("default data dir scope = %q", scope("", ""))
+	}
+	if scope("/data/a", "") == scope("/data/b", "") {
+		t.Error("different data dirs must get different scopes")
+	}
+	if scope("/data/a", "http://rotki:4242") != scope("/data/b", "http://rotki:4242/") {
+		t.Error("an attached backend is scoped by its URL, not the data dir")
+	}
+	if scope("", "http://rotki:4242") == scope("", "http://other:4242") {
+		t.Error("different backends must get different scopes")
+	}
+}
+
+func TestValidateAttachURL(t *testing.T) {
+	for attach, ok := range map[string]bool{
+		"http://127.0.0.1:4242": true,
+		"https://rotki.lan":     true,
+		"127.0.0.1:4242":        false,
+		"ftp://rotki.lan":       false,
+		"http://":               false,
+	} {
+		cfg := NewConfig()
+		cfg.Attach = attach
+		if err := cfg.Validate(); (err == nil) != ok {
+			t.Errorf("Validate(attach %q) error = %v, want ok=%v", attach, err, ok)
+		}
+	}
+}
+
+func TestParseTimeouts(t *testing.T) {
+	got, err := ParseTimeouts(" evm-decode=2h, exchange-trades = 10m ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]time.Duration{"evm-decode": 2 * time.Hour, "exchange-trades": 10 * time.Minute}
+	if !maps.Equal(got, want) {
+		t.Fatalf("ParseTimeouts = %v, want %v", got, want)
+	}
+	if s := FormatTimeouts(got); s != "evm-decode=2h0m0s,exchange-trades=10m0s" {
+		t.Errorf("FormatTimeouts = %q", s)
+	}
+
+	for _, bad := range []string{"evm-decode", "=2h", "evm-decode=soon"} {
+		if _, err := ParseTimeouts(bad); err == nil {
+			t.Errorf("ParseTimeouts(%q) should fail", bad)
+		}
+	}
+}
+
+func TestValidateRejectsNegativeStepTimeout(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Timeouts.Steps = map[string]time.Duration{"evm-decode": -time.Minute}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected an error for a negative step timeout")
+	}
+}
+
+func TestValidateRejectsNegativeTaskTimeout(t *testing.T) {
+	for _, timeouts := range []TimeoutConfig{
+		{Task: -time.Second},
+		{Tasks: map[string]time.Duration{"evm-decode": -time.Minute}},
+	} {
+		cfg := NewConfig()
+		cfg.Timeouts = timeouts
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should reject a negative task timeout", timeouts)
+		}
+	}
+}
+
+func TestStepRetries(t *testing.T) {
+	t.Setenv("ROTKI_SYNC_STEP_RETRIES", "evm-decode=1, exchange-trades=0")
+	cfg := NewConfig()
+	cfg.LoadFromEnvironment()
+
+	if got := cfg.StepRetries("evm-decode"); got != 1 {
+		t.Errorf("StepRetries(evm-decode) = %d, want 1", got)
+	}
+	if got := cfg.StepRetries("exchange-trades"); got != 0 {
+		t.Errorf("StepRetries(exchange-trades) = %d, want 0", got)
+	}
+	if got := cfg.StepRetries("evm-fetch"); got != cfg.MaxRetries {
+		t.Errorf("StepRetries(evm-fetch) = %d, want max_retries %d", got, cfg.MaxRetries)
+	}
+	if got := cfg.Source("retries.steps.evm-decode"); got != SourceEnv {
+		t.Errorf("retries.steps.evm-decode source = %v, want env", got)
+	}
+	if s := FormatRetries(cfg.Retries.Steps); s != "evm-decode=1,exchange-trades=0" {
+		t.Errorf("FormatRetries = %q", s)
+	}
+
+	for _, bad := range []string{"evm-decode", "=1", "evm-decode=often"} {
+		if _, err := ParseRetries(bad); err == nil {
+			t.Errorf("ParseRetries(%q) should fail", bad)
+		}
+	}
+
+	cfg.Retries.Steps["evm-fetch"] = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for negative step retries")
+	}
+}
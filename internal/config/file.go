@@ -0,0 +1,218 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Source identifies which configuration layer a value came from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// LoadFile merges the TOML config file at path over the current values. Keys
+// absent from the file keep their current value. A missing file is only an
+// error when required is set (an explicit --config), so the default location
+// is optional. Unknown keys are rejected so a typo does not silently fall back
+// to a default, and so are bare numbers for durations, which TOML would read
+// as nanoseconds where the matching flags and variables mean milliseconds.
+func (c *Config) LoadFile(path string, required bool) error {
+	md, err := toml.DecodeFile(path, c)
+	if err != nil {
+		if !required && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to load config file %s: %w", path, err)
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		return fmt.Errorf("unknown keys in config file %s: %s", path, strings.Join(keys, ", "))
+	}
+	if err := c.checkDurations(md); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	for _, key := range md.Keys() {
+		// Only values are attributed; a table header alone sets nothing.
+		if md.Type(key...) == "Hash" {
+			continue
+		}
+		c.SetSource(key.String(), SourceFile)
+	}
+	c.file = path
+	return nil
+}
+
+// checkDurations rejects a duration key that md decoded from anything but a
+// string such as "2s".
+func (c *Config) checkDurations(md toml.MetaData) error {
+	durations := make(map[string]bool)
+	walkConfig(reflect.ValueOf(c).Elem(), "", func(key string, v reflect.Value) {
+		if v.Type() == durationType {
+			durations[key] = true
+		}
+	})
+
+	for _, key := range md.Keys() {
+		if durations[key.String()] && md.Type(key...) != "String" {
+			return fmt.Errorf("%s must be a duration string such as \"2s\", not a bare number", key)
+		}
+	}
+	return nil
+}
+
+// File returns the path of the loaded config file, or "" when none was loaded.
+func (c *Config) File() string {
+	return c.file
+}
+
+// SetSource records that the value for key came from src. Later layers call it
+// after earlier ones, so the last writer wins.
+func (c *Config) SetSource(key string, src Source) {
+	if c.sources == nil {
+		c.sources = make(map[string]Source)
+	}
+	c.sources[key] = src
+}
+
+// Source reports where the value for key came from. A nested key without its
+// own record inherits from its closest recorded parent (e.g. a whole table set
+// from one environment variable), falling back to SourceDefault.
+func (c *Config) Source(key string) Source {
+	for k := key; k != ""; {
+		if src, ok := c.sources[k]; ok {
+			return src
+		}
+		i := strings.LastIndexByte(k, '.')
+		if i < 0 {
+			break
+		}
+		k = k[:i]
+	}
+	return SourceDefault
+}
+
+// Entry is one effective configuration value, rendered as a TOML value, with
+// the layer it came from.
+type Entry struct {
+	Key    string
+	Value  string
+	Source Source
+}
+
+// Entries lists every config file key with its effective value and source, in
+// declaration order. Nested tables are flattened into dotted keys, so the
+// output can be pasted back into a config file.
+func (c *Config) Entries() []Entry {
+	var entries []Entry
+	walkConfig(reflect.ValueOf(c).Elem(), "", func(key string, v reflect.Value) {
+		entries = append(entries, Entry{Key: key, Value: formatValue(v), Source: c.Source(key)})
+	})
+	return entries
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// walkConfig calls leaf for every tagged field below v. Structs and maps are
+// descended into, so each map entry keeps its own source; an empty map of
+// values and everything else is a leaf.
+func walkConfig(v reflect.Value, prefix string, leaf func(key string, v reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("toml")
+		if !field.IsExported() || tag == "" || tag == "-" {
+			continue
+		}
+		key := joinKey(prefix, tag)
+		fv := v.Field(i)
+
+		switch {
+		case fv.Kind() == reflect.Struct && fv.Type() != durationType:
+			walkConfig(fv, key, leaf)
+		case fv.Kind() == reflect.Map && fv.Type().Elem().Kind() == reflect.Struct:
+			for _, mk := range sortedMapKeys(fv) {
+				walkConfig(fv.MapIndex(mk), joinKey(key, mk.String()), leaf)
+			}
+		case fv.Kind() == reflect.Map && fv.Len() > 0:
+			for _, mk := range sortedMapKeys(fv) {
+				leaf(joinKey(key, mk.String()), fv.MapIndex(mk))
+			}
+		default:
+			leaf(key, fv)
+		}
+	}
+}
+
+func sortedMapKeys(m reflect.Value) []reflect.Value {
+	mapKeys := m.MapKeys()
+	sort.Slice(mapKeys, func(a, b int) bool { return mapKeys[a].String() < mapKeys[b].String() })
+	return mapKeys
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// formatValue renders a leaf config value in TOML syntax.
+func formatValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return strconv.Quote(time.Duration(v.Int()).String())
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Slice:
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = formatValue(v.Index(i))
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case reflect.Map:
+		mapKeys := sortedMapKeys(v)
+		if len(mapKeys) == 0 {
+			return "{}"
+		}
+		parts := make([]string, len(mapKeys))
+		for i, mk := range mapKeys {
+			parts[i] = strconv.Quote(mk.String()) + " = " + formatValue(v.MapIndex(mk))
+		}
+		return "{ " + strings.Join(parts, ", ") + " }"
+	case reflect.Struct:
+		// Table array entries render as inline tables of their set fields.
+		var parts []string
+		for i := 0; i < v.NumField(); i++ {
+			tag := v.Type().Field(i).Tag.Get("toml")
+			if tag == "" || tag == "-" || v.Field(i).IsZero() {
+				continue
+			}
+			parts = append(parts, tag+" = "+formatValue(v.Field(i)))
+		}
+		if len(parts) == 0 {
+			return "{}"
+		}
+		return "{ " + strings.Join(parts, ", ") + " }"
+	default:
+		return fmt.Sprintf("%v", v.Interface())
+	}
+}
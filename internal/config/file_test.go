@@ -0,0 +1,285 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFilePrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+port = 60000
+retry_delay = "5s"
+shutdown_timeout = "1m"
+alert_webhook = "https://example.com/hook"
+
+[steps]
+skip = ["token-detection"]
+`)
+	t.Setenv("ROTKI_PORT", "61000")
+	t.Setenv("ROTKI_SYNC_SHUTDOWN_TIMEOUT", "45s")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFile(path, true); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	cfg.LoadFromEnvironment()
+
+	if cfg.Port != 61000 {
+		t.Errorf("Port = %d, want env value 61000", cfg.Port)
+	}
+	if got := cfg.Source("port"); got != SourceEnv {
+		t.Errorf("Source(port) = %q, want env", got)
+	}
+	if cfg.RetryDelay != 5*time.Second {
+		t.Errorf("RetryDelay = %v, want 5s from file", cfg.RetryDelay)
+	}
+	if got := cfg.Source("retry_delay"); got != SourceFile {
+		t.Errorf("Source(retry_delay) = %q, want file", got)
+	}
+	if cfg.ShutdownTimeout != 45*time.Second {
+		t.Errorf("ShutdownTimeout = %v, want env value 45s", cfg.ShutdownTimeout)
+	}
+	if len(cfg.Steps.Skip) != 1 || cfg.Steps.Skip[0] != "token-detection" {
+		t.Errorf("Steps.Skip = %v", cfg.Steps.Skip)
+	}
+	if got := cfg.Source("steps.only"); got != SourceDefault {
+		t.Errorf("Source(steps.only) = %q, want default (only the table was present)", got)
+	}
+	if got := cfg.Source("bin_path"); got != SourceDefault {
+		t.Errorf("Source(bin_path) = %q, want default", got)
+	}
+	if cfg.File() != path {
+		t.Errorf("File() = %q, want %q", cfg.File(), path)
+	}
+}
+
+func TestLoadFileMissing(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "absent.toml")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFile(missing, false); err != nil {
+		t.Fatalf("optional missing file should not error: %v", err)
+	}
+	if cfg.File() != "" {
+		t.Errorf("File() = %q, want empty", cfg.File())
+	}
+	if err := cfg.LoadFile(missing, true); err == nil {
+		t.Fatal("required missing file should error")
+	}
+}
+
+func TestLoadFileRejectsUnknownKeys(t *testing.T) {
+	path := writeConfigFile(t, "prot = 1\n")
+
+	err := NewConfig().LoadFile(path, false)
+	if err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Fatalf("expected unknown key error naming prot, got %v", err)
+	}
+}
+
+func TestLoadFileRejectsBareDurations(t *testing.T) {
+	for _, content := range []string{
+		"retry_delay = 2000\n",
+		"[timeouts.steps]\nevm-decode = 7200\n",
+	} {
+		path := writeConfigFile(t, content)
+		err := NewConfig().LoadFile(path, false)
+		if err == nil || !strings.Contains(err.Error(), "duration string") {
+			t.Errorf("%q: expected a duration string error, got %v", content, err)
+		}
+	}
+}
+
+func TestEntries(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SetSource("port", SourceFlag)
+
+	entries := make(map[string]Entry)
+	for _, e := range cfg.Entries() {
+		entries[e.Key] = e
+	}
+
+	if _, ok := entries["base_url"]; ok {
+		t.Error("derived BaseURL must not be listed")
+	}
+	if e := entries["port"]; e.Value != "59001" || e.Source != SourceFlag {
+		t.Errorf("port entry = %+v", e)
+	}
+	if e := entries["retry_delay"]; e.Value != `"2s"` {
+		t.Errorf("retry_delay entry = %+v", e)
+	}
+	if e := entries["steps.only"]; e.Value != "[]" || e.Source != SourceDefault {
+		t.Errorf("steps.only entry = %+v", e)
+	}
+}
+
+func TestLoadFileAccountRules(t *testing.T) {
+	path := writeConfigFile(t, `
+[[accounts.exclude]]
+chain = "eth"
+tag = "cold"
+
+[[accounts.exclude]]
+chain_type = "solana"
+`)
+
+	cfg := NewConfig()
+	if err := cfg.LoadFile(path, true); err != nil {
+		t.Fatal(err)
+	}
+	want := []AccountRule{{Chain: "eth", Tag: "cold"}, {ChainType: "solana"}}
+	if !reflect.DeepEqual(cfg.Accounts.Exclude, want) {
+		t.Fatalf("Accounts.Exclude = %+v, want %+v", cfg.Accounts.Exclude, want)
+	}
+
+	for _, e := range cfg.Entries() {
+		if e.Key != "accounts.exclude" {
+			continue
+		}
+		if e.Value != `[{ chain = "eth", tag = "cold" }, { chain_type = "solana" }]` || e.Source != SourceFile {
+			t.Errorf("accounts.exclude entry = %+v", e)
+		}
+		return
+	}
+	t.Error("accounts.exclude not listed")
+}
+
+func TestLoadFileStepTimeouts(t *testing.T) {
+	path := writeConfigFile(t, `
+[timeouts.steps]
+evm-decode = "2h"
+exchange-trades = "10m"
+`)
+	t.Setenv("ROTKI_SYNC_STEP_TIMEOUTS", "exchange-trades=5m")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFile(path, true); err != nil {
+		t.Fatal(err)
+	}
+	cfg.LoadFromEnvironment()
+
+	want := map[string]time.Duration{"evm-decode": 2 * time.Hour, "exchange-trades": 5 * time.Minute}
+	if !reflect.DeepEqual(cfg.Timeouts.Steps, want) {
+		t.Fatalf("Timeouts.Steps = %v, want %v", cfg.Timeouts.Steps, want)
+	}
+
+	entries := make(map[string]Entry)
+	for _, e := range cfg.Entries() {
+		entries[e.Key] = e
+	}
+	if e := entries["timeouts.steps.evm-decode"]; e.Value != `"2h0m0s"` || e.Source != SourceFile {
+		t.Errorf("timeouts.steps.evm-decode entry = %+v", e)
+	}
+	if e := entries["timeouts.steps.exchange-trades"]; e.Value != `"5m0s"` || e.Source != SourceEnv {
+		t.Errorf("timeouts.steps.exchange-trades entry = %+v", e)
+	}
+}
+
+func TestLoadFileTaskTimeouts(t *testing.T) {
+	path := writeConfigFile(t, `
+[timeouts]
+task = "30m"
+
+[timeouts.tasks]
+evm-decode = "2h"
+`)
+	t.Setenv("ROTKI_SYNC_TASK_TIMEOUT", "45m")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFile(path, true); err != nil {
+		t.Fatal(err)
+	}
+	cfg.LoadFromEnvironment()
+
+	if got := cfg.Timeouts.TaskLimit("evm-decode"); got != 2*time.Hour {
+		t.Errorf("TaskLimit(evm-decode) = %v, want the per-step override", got)
+	}
+	if got := cfg.Timeouts.TaskLimit("evm-fetch"); got != 45*time.Minute {
+		t.Errorf("TaskLimit(evm-fetch) = %v, want the env default", got)
+	}
+	if got := cfg.Source("timeouts.task"); got != SourceEnv {
+		t.Errorf("timeouts.task source = %v, want env", got)
+	}
+}
+
+func TestLoadFileRateLimits(t *testing.T) {
+	path := writeConfigFile(t, `
+[rate_limits]
+pause = "2m"
+reorder = true
+`)
+	t.Setenv("ROTKI_SYNC_RATE_LIMIT_PAUSE", "0s")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFile(path, true); err != nil {
+		t.Fatal(err)
+	}
+	cfg.LoadFromEnvironment()
+
+	if cfg.RateLimits.Pause != 0 {
+		t.Errorf("RateLimits.Pause = %v, want the env value 0s", cfg.RateLimits.Pause)
+	}
+	if !cfg.RateLimits.Reorder {
+		t.Error("RateLimits.Reorder = false, want true from file")
+	}
+	if got := cfg.Source("rate_limits.reorder"); got != SourceFile {
+		t.Errorf("rate_limits.reorder source = %v, want file", got)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	cfg.RateLimits.Pause = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate should reject a negative rate limit pause")
+	}
+}
+
+func TestLoadFileEvents(t *testing.T) {
+	path := writeConfigFile(t, `
+[events]
+format = "ndjson"
+output = "/tmp/events.ndjson"
+`)
+	t.Setenv("ROTKI_SYNC_EVENTS_OUTPUT", "unix:/run/rotki-sync.sock")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFile(path, true); err != nil {
+		t.Fatal(err)
+	}
+	cfg.LoadFromEnvironment()
+
+	if cfg.Events.Format != EventsFormatNDJSON {
+		t.Errorf("Events.Format = %q, want %q from file", cfg.Events.Format, EventsFormatNDJSON)
+	}
+	if cfg.Events.Output != "unix:/run/rotki-sync.sock" {
+		t.Errorf("Events.Output = %q, want the env value", cfg.Events.Output)
+	}
+	if got := cfg.Source("events.output"); got != SourceEnv {
+		t.Errorf("events.output source = %v, want env", got)
+	}
+	if cfg.Events.ToStdout() {
+		t.Error("ToStdout = true for a unix socket output")
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	cfg.Events.Format = "json"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate should reject an unknown events format")
+	}
+}
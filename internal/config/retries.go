@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RetryConfig overrides how often the items of individual steps are retried.
+type RetryConfig struct {
+	// Steps overrides MaxRetries by step id ([retries.steps], e.g.
+	// evm-decode = 1); 0 never retries the step's items.
+	Steps map[string]int `toml:"steps"`
+}
+
+// StepRetries returns how often an item of the step with the given id is
+// retried after a transient failure.
+func (c *Config) StepRetries(id string) int {
+	if retries, ok := c.Retries.Steps[id]; ok {
+		return retries
+	}
+	return c.MaxRetries
+}
+
+// SetStepRetries merges retries into the per-step retry counts, replacing the
+// counts of the steps it names, and records src as their source.
+func (c *Config) SetStepRetries(retries map[string]int, src Source) {
+	if c.Retries.Steps == nil {
+		c.Retries.Steps = make(map[string]int, len(retries))
+	}
+	for id, n := range retries {
+		c.Retries.Steps[id] = n
+		c.SetSource("retries.steps."+id, src)
+	}
+}
+
+func (r RetryConfig) validate() error {
+	for _, id := range sortedKeys(r.Steps) {
+		if r.Steps[id] < 0 {
+			return fmt.Errorf("retries for step %s must be non-negative, got: %d", id, r.Steps[id])
+		}
+	}
+	return nil
+}
+
+// ParseRetries parses comma-separated id=count pairs (e.g.
+// "evm-decode=1,exchange-trades=5"), as given to --step-retries and
+// ROTKI_SYNC_STEP_RETRIES.
+func ParseRetries(v string) (map[string]int, error) {
+	retries := make(map[string]int)
+	for _, pair := range splitList(v) {
+		id, value, ok := strings.Cut(pair, "=")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid retries %q, expected id=count", pair)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid retries for %s: %w", id, err)
+		}
+		retries[id] = n
+	}
+	return retries, nil
+}
+
+// FormatRetries renders retries the way ParseRetries reads them, sorted by id.
+func FormatRetries(retries map[string]int) string {
+	pairs := make([]string, 0, len(retries))
+	for _, id := range sortedKeys(retries) {
+		pairs = append(pairs, id+"="+strconv.Itoa(retries[id]))
+	}
+	return strings.Join(pairs, ",")
+}
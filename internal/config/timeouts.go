@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TimeoutConfig bounds how long the sync steps of a run, and the rotki-core
+// tasks they wait on, may take.
+type TimeoutConfig struct {
+	// Steps caps the wall-clock time of individual steps by step id
+	// ([timeouts.steps], e.g. evm-decode = "2h"). A step without an entry, or
+	// with 0, runs until it is done.
+	Steps map[string]time.Duration `toml:"steps"`
+	// Task caps the wait for any one async task of a step (e.g. one chain's
+	// decode); the item is then given up on and the step moves on. 0 waits as
+	// long as the step may run.
+	Task time.Duration `toml:"task"`
+	// Tasks overrides Task for the tasks of individual steps by step id
+	// ([timeouts.tasks]).
+	Tasks map[string]time.Duration `toml:"tasks"`
+}
+
+// Step returns the time limit for the step with the given id, 0 for none.
+func (t TimeoutConfig) Step(id string) time.Duration {
+	return t.Steps[id]
+}
+
+// TaskLimit returns the time limit for each async task of the step with the
+// given id, 0 for none.
+func (t TimeoutConfig) TaskLimit(id string) time.Duration {
+	if limit, ok := t.Tasks[id]; ok {
+		return limit
+	}
+	return t.Task
+}
+
+// SetStepTimeouts merges timeouts into the step time limits, replacing the
+// limits of the steps it names, and records src as their source.
+func (c *Config) SetStepTimeouts(timeouts map[string]time.Duration, src Source) {
+	if c.Timeouts.Steps == nil {
+		c.Timeouts.Steps = make(map[string]time.Duration, len(timeouts))
+	}
+	for id, d := range timeouts {
+		c.Timeouts.Steps[id] = d
+		c.SetSource("timeouts.steps."+id, src)
+	}
+}
+
+func (t TimeoutConfig) validate() error {
+	for _, id := range sortedKeys(t.Steps) {
+		if t.Steps[id] < 0 {
+			return fmt.Errorf("timeout for step %s must be non-negative, got: %s", id, t.Steps[id])
+		}
+	}
+	if t.Task < 0 {
+		return fmt.Errorf("task timeout must be non-negative, got: %s", t.Task)
+	}
+	for _, id := range sortedKeys(t.Tasks) {
+		if t.Tasks[id] < 0 {
+			return fmt.Errorf("task timeout for step %s must be non-negative, got: %s", id, t.Tasks[id])
+		}
+	}
+	return nil
+}
+
+// ParseTimeouts parses comma-separated id=duration pairs (e.g.
+// "evm-decode=2h,exchange-trades=10m"), as given to --step-timeout and
+// ROTKI_SYNC_STEP_TIMEOUTS.
+func ParseTimeouts(v string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, pair := range splitList(v) {
+		id, value, ok := strings.Cut(pair, "=")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid timeout %q, expected id=duration", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout for %s: %w", id, err)
+		}
+		timeouts[id] = d
+	}
+	return timeouts, nil
+}
+
+// FormatTimeouts renders timeouts the way ParseTimeouts reads them, sorted by
+// id.
+func FormatTimeouts(timeouts map[string]time.Duration) string {
+	pairs := make([]string, 0, len(timeouts))
+	for _, id := range sortedKeys(timeouts) {
+		pairs = append(pairs, id+"="+timeouts[id].String())
+	}
+	return strings.Join(pairs, ",")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,226 @@
+// Package history keeps a local record of past sync runs so a persistent break
+// can be told apart from a flaky step. Each run's report document is appended
+// as one JSON line to <home>/history.jsonl; the file is only ever appended to,
+// so a crash mid-write can at worst leave a truncated last line, which Load
+// skips and the next Append starts a new line after. The file is never pruned:
+// at a few kilobytes per run it grows slowly, and it can be deleted or trimmed
+// by hand between runs.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/logger"
+	"github.com/kelsos/rotki-sync/internal/paths"
+	"github.com/kelsos/rotki-sync/internal/services"
+)
+
+// maxLineSize bounds a single history record; a run report for many users and
+// steps stays well below it.
+const maxLineSize = 16 << 20
+
+// Store is a handle to a JSONL run-history file.
+type Store struct {
+	path string
+}
+
+// New returns a Store backed by the file at path (used by tests).
+func New(path string) *Store {
+	return &Store{path: path}
+}
+
+// Default returns the Store at the data home (paths.HistoryFile()).
+func Default() *Store {
+	return New(paths.HistoryFile())
+}
+
+// Path returns the history file path.
+func (s *Store) Path() string { return s.path }
+
+// Append records a run at the end of the history, on a line of its own even
+// when the previous write was cut short.
+func (s *Store) Append(run services.ReportDocument) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode run %s: %w", run.ID, err)
+	}
+	data = append(data, '\n')
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open run history: %w", err)
+	}
+	terminated, err := endsWithNewline(f)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to read run history: %w", err)
+	}
+	if !terminated {
+		data = append([]byte{'\n'}, data...)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to append to run history: %w", err)
+	}
+	return f.Close()
+}
+
+// endsWithNewline reports whether f is empty or its last byte is a newline.
+func endsWithNewline(f *os.File) (bool, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if info.Size() == 0 {
+		return true, nil
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		return false, err
+	}
+	return last[0] == '\n', nil
+}
+
+// Load returns every recorded run, oldest first. A missing file is an empty
+// history. Lines that do not decode (e.g. a write cut short by a crash) are
+// skipped with a warning rather than making the whole history unreadable.
+func (s *Store) Load() ([]services.ReportDocument, error) {
+	f, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open run history: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var runs []services.ReportDocument
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var run services.ReportDocument
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			logger.Warn("Skipping unreadable run history line %d: %v", line, err)
+			continue
+		}
+		runs = append(runs, run)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read run history: %w", err)
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].StartedAt.Before(runs[j].StartedAt) })
+	return runs, nil
+}
+
+// Find returns the run with the given id.
+func (s *Store) Find(id string) (services.ReportDocument, bool, error) {
+	runs, err := s.Load()
+	if err != nil {
+		return services.ReportDocument{}, false, err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].ID == id {
+			return runs[i], true, nil
+		}
+	}
+	return services.ReportDocument{}, false, nil
+}
+
+// Streak is a run of consecutive identical outcomes for one user's step,
+// ending at the most recent run in which the step ran.
+type Streak struct {
+	// Scope is the run's services.ReportDocument Scope: the same username on
+	// another data dir or backend is another user.
+	Scope    string
+	Username string
+	StepID   string
+	StepName string
+	// Status is the repeated step status (services.StatusOK, StatusFailed or
+	// StatusTimedOut).
+	Status string
+	// Runs is the number of consecutive runs with Status.
+	Runs int
+	// Since is the start of the oldest run in the streak.
+	Since time.Time
+	// LastError is the error of the most recent run, when it had one.
+	LastError string
+}
+
+// Streaks computes, for every scope, user and step in runs (oldest first), how many
+// of the most recent runs in a row ended with the same status. Runs where the
+// step did not execute (skipped, or the run aborted before it) or was
+// interrupted neither extend nor break a streak. Results are sorted longest
+// first.
+func Streaks(runs []services.ReportDocument) []Streak {
+	type key struct{ scope, user, step string }
+	streaks := make(map[key]*Streak)
+	closed := make(map[key]bool)
+
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := runs[i]
+		for _, user := range run.Users {
+			for _, step := range user.Steps {
+				if step.Status == services.StatusSkipped || step.Status == services.StatusInterrupted {
+					continue
+				}
+				k := key{run.Scope, user.Username, step.ID}
+				if closed[k] {
+					continue
+				}
+				streak, ok := streaks[k]
+				if !ok {
+					streaks[k] = &Streak{
+						Scope:     run.Scope,
+						Username:  user.Username,
+						StepID:    step.ID,
+						StepName:  step.Name,
+						Status:    step.Status,
+						Runs:      1,
+						Since:     run.StartedAt,
+						LastError: step.Error,
+					}
+					continue
+				}
+				if step.Status != streak.Status {
+					closed[k] = true
+					continue
+				}
+				streak.Runs++
+				streak.Since = run.StartedAt
+			}
+		}
+	}
+
+	out := make([]Streak, 0, len(streaks))
+	for _, streak := range streaks {
+		out = append(out, *streak)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Runs != out[j].Runs {
+			return out[i].Runs > out[j].Runs
+		}
+		if out[i].Scope != out[j].Scope {
+			return out[i].Scope < out[j].Scope
+		}
+		if out[i].Username != out[j].Username {
+			return out[i].Username < out[j].Username
+		}
+		return out[i].StepID < out[j].StepID
+	})
+	return out
+}
@@ -0,0 +1,159 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/services"
+)
+
+// run builds a one-user run document whose steps have the given statuses.
+func run(id string, day int, steps map[string]string) services.ReportDocument {
+	doc := services.ReportDocument{
+		ID:        id,
+		StartedAt: time.Date(2026, 1, day, 9, 30, 0, 0, time.UTC),
+		Status:    services.StatusOK,
+	}
+	user := services.UserDocument{Username: "alice"}
+	for _, id := range services.StepIDs {
+		if status, ok := steps[id]; ok {
+			user.Steps = append(user.Steps, services.StepDocument{ID: id, Name: id, Status: status})
+		}
+	}
+	doc.Users = []services.UserDocument{user}
+	return doc
+}
+
+func TestStoreAppendLoadFind(t *testing.T) {
+	store := New(filepath.Join(t.TempDir(), "history.jsonl"))
+
+	runs, err := store.Load()
+	if err != nil || len(runs) != 0 {
+		t.Fatalf("empty history Load = %v, %v", runs, err)
+	}
+
+	for _, r := range []services.ReportDocument{
+		run("b", 2, nil),
+		run("a", 1, nil),
+	} {
+		if err := store.Append(r); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	runs, err = store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != "a" || runs[1].ID != "b" {
+		t.Fatalf("Load order = %+v, want a then b", runs)
+	}
+
+	got, ok, err := store.Find("b")
+	if err != nil || !ok || got.ID != "b" {
+		t.Fatalf("Find(b) = %+v, %v, %v", got, ok, err)
+	}
+	if _, ok, _ := store.Find("missing"); ok {
+		t.Error("Find(missing) should not find a run")
+	}
+}
+
+func TestLoadSkipsTruncatedLine(t *testing.T) {
+	store := New(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err := store.Append(run("a", 1, nil)); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(store.Path(), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"id":"b","started_at":`)
+	_ = f.Close()
+
+	runs, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(runs) != 1 || runs[0].ID != "a" {
+		t.Fatalf("runs = %+v, want only a", runs)
+	}
+}
+
+func TestAppendAfterTruncatedLine(t *testing.T) {
+	store := New(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err := os.WriteFile(store.Path(), []byte(`{"id":"a","started_at":`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Append(run("b", 2, nil)); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	runs, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(runs) != 1 || runs[0].ID != "b" {
+		t.Fatalf("runs = %+v, want only b", runs)
+	}
+}
+
+func TestStreaks(t *testing.T) {
+	failed, ok, skipped := services.StatusFailed, services.StatusOK, services.StatusSkipped
+	runs := []services.ReportDocument{
+		run("1", 1, map[string]string{services.StepEvmFetch: ok, services.StepEvmDecode: failed}),
+		run("2", 2, map[string]string{services.StepEvmFetch: failed, services.StepEvmDecode: ok}),
+		run("3", 3, map[string]string{services.StepEvmFetch: failed, services.StepEvmDecode: failed}),
+		// Skipped, interrupted and absent steps neither extend nor break a
+		// streak.
+		run("4", 4, map[string]string{services.StepEvmFetch: skipped, services.StepEvmDecode: services.StatusInterrupted}),
+		run("5", 5, map[string]string{services.StepEvmFetch: failed, services.StepEvmDecode: failed}),
+	}
+
+	streaks := Streaks(runs)
+	byStep := make(map[string]Streak)
+	for _, s := range streaks {
+		byStep[s.StepID] = s
+	}
+
+	fetch := byStep[services.StepEvmFetch]
+	if fetch.Status != failed || fetch.Runs != 3 || !fetch.Since.Equal(runs[1].StartedAt) {
+		t.Errorf("evm-fetch streak = %+v, want 3 failed since run 2", fetch)
+	}
+	decode := byStep[services.StepEvmDecode]
+	if decode.Status != failed || decode.Runs != 2 {
+		t.Errorf("evm-decode streak = %+v, want 2 failed", decode)
+	}
+	if streaks[0].StepID != services.StepEvmFetch {
+		t.Errorf("streaks not sorted longest first: %+v", streaks)
+	}
+}
+
+func TestStreaksPerScope(t *testing.T) {
+	failed, ok := services.StatusFailed, services.StatusOK
+	scoped := func(id string, day int, scope, status string) services.ReportDocument {
+		doc := run(id, day, map[string]string{services.StepEvmFetch: status})
+		doc.Scope = scope
+		return doc
+	}
+	// The same username on two data dirs, interleaved: neither breaks the
+	// other's streak.
+	runs := []services.ReportDocument{
+		scoped("1", 1, "data-a", failed),
+		scoped("2", 2, "data-b", ok),
+		scoped("3", 3, "data-a", failed),
+		scoped("4", 4, "data-b", ok),
+	}
+
+	streaks := Streaks(runs)
+	if len(streaks) != 2 {
+		t.Fatalf("streaks = %+v, want one per scope", streaks)
+	}
+	for _, s := range streaks {
+		want := map[string]string{"data-a": failed, "data-b": ok}[s.Scope]
+		if s.Status != want || s.Runs != 2 {
+			t.Errorf("%s streak = %+v, want 2 %s", s.Scope, s, want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockRange is the byte range LockFileEx locks. It lies far past the owner
+// record, which other processes must still be able to read.
+var lockRange = windows.Overlapped{OffsetHigh: 0x7fffffff}
+
+// lockFile takes an exclusive LockFileEx lock on f without blocking.
+func lockFile(f *os.File) error {
+	ol := lockRange
+	err := windows.LockFileEx(windows.Handle(f.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &ol)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, windows.ERROR_LOCK_VIOLATION):
+		return errLocked
+	default:
+		return fmt.Errorf("LockFileEx: %w", err)
+	}
+}
+
+// unlockFile releases the lock taken by lockFile.
+func unlockFile(f *os.File) {
+	ol := lockRange
+	_ = windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &ol)
+}
@@ -0,0 +1,150 @@
+// Package lock provides an advisory run lock so two rotki-sync processes never
+// drive rotki-core against the same data directory at once (e.g. a manual run
+// while the timer's run is mid-flight). The lock is an OS file lock (flock,
+// LockFileEx) on a file recording the owner's PID and start time for
+// messages. The OS releases it when the owner exits, however it exits, so a
+// crashed run never leaves a lock behind.
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/logger"
+	"github.com/kelsos/rotki-sync/internal/paths"
+)
+
+// pollInterval is how often a waiting Acquire retries.
+var pollInterval = 2 * time.Second
+
+// Owner describes the process holding a lock.
+type Owner struct {
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"started_at"`
+	Command   string    `json:"command"`
+}
+
+// HeldError reports that another process holds the lock.
+type HeldError struct {
+	Path  string
+	Owner Owner
+}
+
+func (e *HeldError) Error() string {
+	if e.Owner.PID == 0 {
+		// The owner has locked the file but not recorded itself yet.
+		return fmt.Sprintf("another rotki-sync is running (lock %s); use --wait to queue behind it", e.Path)
+	}
+	return fmt.Sprintf("another rotki-sync %s (pid %d) has been running since %s (lock %s); use --wait to queue behind it",
+		e.Owner.Command, e.Owner.PID, e.Owner.StartedAt.Local().Format(time.DateTime), e.Path)
+}
+
+// Lock is a held run lock.
+type Lock struct {
+	path string
+	file *os.File
+}
+
+// errLocked is returned by lockFile when another process holds the lock.
+var errLocked = errors.New("lock is held")
+
+// PathFor returns the lock file guarding dataDir. An empty dataDir (rotki's
+// default location) gets its own lock.
+func PathFor(dataDir string) string {
+	return filepath.Join(paths.LockDir(), "run-"+paths.DataDirKey(dataDir)+".lock")
+}
+
+// PathForURL returns the lock file guarding an externally managed rotki-core
+// reached at baseURL, whose data dir rotki-sync cannot see.
+func PathForURL(baseURL string) string {
+	return filepath.Join(paths.LockDir(), "backend-"+paths.BackendKey(baseURL)+".lock")
+}
+
+// Acquire takes the lock at path for command. When another process holds it,
+// Acquire returns a *HeldError, or with wait set, polls until it is released.
+func Acquire(path, command string, wait bool) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	owner := Owner{PID: os.Getpid(), StartedAt: time.Now().UTC(), Command: command}
+	data, err := json.Marshal(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	logged := false
+	for {
+		l, err := tryLock(path, data)
+		if err == nil {
+			return l, nil
+		}
+		if !errors.Is(err, errLocked) {
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+
+		held := &HeldError{Path: path, Owner: readOwner(path)}
+		if !wait {
+			return nil, held
+		}
+		if !logged {
+			logger.Info("Waiting for rotki-sync %s (pid %d) to finish...", held.Owner.Command, held.Owner.PID)
+			logged = true
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// tryLock opens the lock file, creating it if needed, takes the OS lock on it
+// without blocking and records data as its owner. It returns an error wrapping
+// errLocked when another process holds the lock.
+func tryLock(path string, data []byte) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	// Whatever a previous owner recorded is left over from a run that ended.
+	if err := f.Truncate(0); err == nil {
+		_, err = f.WriteAt(data, 0)
+	}
+	if err != nil {
+		unlockFile(f)
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to record lock owner: %w", err)
+	}
+	return &Lock{path: path, file: f}, nil
+}
+
+// readOwner returns the owner recorded in the lock file at path, or a zero
+// Owner when there is none yet, e.g. while the owner is still writing it.
+func readOwner(path string) Owner {
+	var owner Owner
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &owner)
+	}
+	return owner
+}
+
+// Release releases the lock. It is safe to call more than once. The lock file
+// is kept: removing it would let a process that opened it just before lock
+// the removed file while the next one creates and locks a new file.
+func (l *Lock) Release() {
+	if l == nil || l.file == nil {
+		return
+	}
+	_ = l.file.Truncate(0)
+	unlockFile(l.file)
+	if err := l.file.Close(); err != nil {
+		logger.Warn("Failed to release run lock %s: %v", l.path, err)
+	}
+	l.file = nil
+}
@@ -0,0 +1,133 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcquireHeldRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.lock")
+
+	first, err := Acquire(path, "sync", false)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	_, err = Acquire(path, "backup", false)
+	var held *HeldError
+	if !errors.As(err, &held) {
+		t.Fatalf("second Acquire error = %v, want *HeldError", err)
+	}
+	if held.Owner.PID != os.Getpid() || held.Owner.Command != "sync" {
+		t.Errorf("owner = %+v, want this process running sync", held.Owner)
+	}
+
+	first.Release()
+	first.Release()
+	second, err := Acquire(path, "backup", false)
+	if err != nil {
+		t.Fatalf("Acquire after Release: %v", err)
+	}
+	second.Release()
+}
+
+func TestAcquireTakesOverStaleLock(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{name: "dead owner", contents: `{"pid":2147483646,"started_at":"2026-01-01T09:30:00Z","command":"sync"}`},
+		// A container restarted as the same PID finds its own leftover file.
+		{name: "own pid", contents: fmt.Sprintf(`{"pid":%d,"started_at":"2026-01-01T09:30:00Z","command":"daemon"}`, os.Getpid())},
+		{name: "garbage", contents: "not json"},
+		{name: "empty", contents: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "run.lock")
+			if err := os.WriteFile(path, []byte(tc.contents), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			l, err := Acquire(path, "sync", false)
+			if err != nil {
+				t.Fatalf("Acquire over stale lock: %v", err)
+			}
+			l.Release()
+		})
+	}
+}
+
+func TestAcquireIsExclusive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.lock")
+
+	const contenders = 20
+	var acquired atomic.Int32
+	var wg sync.WaitGroup
+	locks := make(chan *Lock, contenders)
+	for range contenders {
+		wg.Go(func() {
+			l, err := Acquire(path, "sync", false)
+			var held *HeldError
+			switch {
+			case err == nil:
+				acquired.Add(1)
+				locks <- l
+			case !errors.As(err, &held):
+				t.Errorf("Acquire: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+	close(locks)
+
+	if n := acquired.Load(); n != 1 {
+		t.Errorf("%d contenders acquired the lock, want exactly 1", n)
+	}
+	for l := range locks {
+		l.Release()
+	}
+}
+
+func TestAcquireWaits(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { pollInterval = 2 * time.Second })
+
+	path := filepath.Join(t.TempDir(), "run.lock")
+	first, err := Acquire(path, "sync", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		first.Release()
+	}()
+
+	second, err := Acquire(path, "preflight", true)
+	if err != nil {
+		t.Fatalf("waiting Acquire: %v", err)
+	}
+	second.Release()
+}
+
+func TestPathFor(t *testing.T) {
+	t.Setenv("ROTKI_SYNC_HOME", "/base")
+	if got, want := PathFor(""), filepath.Join("/base", "locks", "run-default.lock"); got != want {
+		t.Errorf("PathFor(\"\") = %q, want %q", got, want)
+	}
+	if PathFor("/data/a") == PathFor("/data/b") {
+		t.Error("different data dirs must get different locks")
+	}
+	if PathFor("/data/a") != PathFor("/data/a/") {
+		t.Error("equivalent data dirs must share a lock")
+	}
+	if PathForURL("http://rotki:4242") == PathForURL("http://other:4242") {
+		t.Error("different backends must get different locks")
+	}
+}
@@ -14,13 +14,17 @@ import (
 	"github.com/kelsos/rotki-sync/internal/paths"
 )
 
-// defaultLogKeep is the number of most-recent per-run rotki-sync_*.log files
-// kept when pruning. Overridable via ROTKI_SYNC_LOG_KEEP.
-const defaultLogKeep = 20
+// DefaultLogKeep is the number of most-recent per-run rotki-sync_*.log files
+// kept when pruning. Overridable via ROTKI_SYNC_LOG_KEEP or SetLogKeep.
+const DefaultLogKeep = 20
 
 var log zerolog.Logger
 var logFile *os.File
 
+// keepOverride, when non-negative, is the retention set from the config file
+// and takes precedence over ROTKI_SYNC_LOG_KEEP.
+var keepOverride = -1
+
 func Init() {
 	output := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
 	output.FormatLevel = func(i interface{}) string {
@@ -74,16 +78,26 @@ func InitFileOnly() error {
 	return nil
 }
 
-// logKeepCount returns how many recent per-run log files to keep, from
-// ROTKI_SYNC_LOG_KEEP when set to a valid non-negative integer, else the
-// default. A value of 0 disables pruning.
+// SetLogKeep sets how many recent per-run log files to keep, overriding
+// ROTKI_SYNC_LOG_KEEP. A negative value restores the environment/default
+// behavior; 0 disables pruning.
+func SetLogKeep(n int) {
+	keepOverride = n
+}
+
+// logKeepCount returns how many recent per-run log files to keep: the
+// SetLogKeep value when set, else ROTKI_SYNC_LOG_KEEP when set to a valid
+// non-negative integer, else the default. A value of 0 disables pruning.
 func logKeepCount() int {
+	if keepOverride >= 0 {
+		return keepOverride
+	}
 	if v := os.Getenv("ROTKI_SYNC_LOG_KEEP"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
 			return n
 		}
 	}
-	return defaultLogKeep
+	return DefaultLogKeep
 }
 
 // pruneOldLogs deletes all but the newest keep rotki-sync_*.log files in dir.
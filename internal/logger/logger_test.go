@@ -9,8 +9,8 @@ import (
 func TestLogKeepCount(t *testing.T) {
 	t.Run("default when unset", func(t *testing.T) {
 		t.Setenv("ROTKI_SYNC_LOG_KEEP", "")
-		if got := logKeepCount(); got != defaultLogKeep {
-			t.Fatalf("logKeepCount() = %d, want %d", got, defaultLogKeep)
+		if got := logKeepCount(); got != DefaultLogKeep {
+			t.Fatalf("logKeepCount() = %d, want %d", got, DefaultLogKeep)
 		}
 	})
 	t.Run("honors valid override", func(t *testing.T) {
@@ -27,8 +27,16 @@ func TestLogKeepCount(t *testing.T) {
 	})
 	t.Run("invalid falls back to default", func(t *testing.T) {
 		t.Setenv("ROTKI_SYNC_LOG_KEEP", "-3")
-		if got := logKeepCount(); got != defaultLogKeep {
-			t.Fatalf("logKeepCount() = %d, want %d", got, defaultLogKeep)
+		if got := logKeepCount(); got != DefaultLogKeep {
+			t.Fatalf("logKeepCount() = %d, want %d", got, DefaultLogKeep)
+		}
+	})
+	t.Run("SetLogKeep wins over env", func(t *testing.T) {
+		t.Setenv("ROTKI_SYNC_LOG_KEEP", "5")
+		SetLogKeep(3)
+		t.Cleanup(func() { SetLogKeep(-1) })
+		if got := logKeepCount(); got != 3 {
+			t.Fatalf("logKeepCount() = %d, want 3", got)
 		}
 	})
 }
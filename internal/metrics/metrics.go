@@ -0,0 +1,120 @@
+// Package metrics renders a sync run as an OpenMetrics text file for the
+// Prometheus node_exporter textfile collector. The file is replaced atomically
+// after every run so the collector never scrapes a half-written file.
+//
+// Only gauges are emitted, and the output is also valid Prometheus text
+// exposition format, so either parser accepts it.
+package metrics
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kelsos/rotki-sync/internal/services"
+	"github.com/kelsos/rotki-sync/internal/utils"
+)
+
+// Render formats the run and its process exit code as OpenMetrics text.
+func Render(run services.ReportDocument, exitCode int) []byte {
+	var b strings.Builder
+
+	gauge(&b, "rotki_sync_last_run_timestamp_seconds", "Unix time the last sync run finished.")
+	sample(&b, "rotki_sync_last_run_timestamp_seconds", nil, float64(run.FinishedAt.UnixMilli())/1000)
+
+	gauge(&b, "rotki_sync_last_run_duration_seconds", "Wall-clock duration of the last sync run.")
+	sample(&b, "rotki_sync_last_run_duration_seconds", nil, run.DurationSeconds)
+
+	gauge(&b, "rotki_sync_last_run_exit_code", "Process exit code of the last sync run (0 = success).")
+	sample(&b, "rotki_sync_last_run_exit_code", nil, float64(exitCode))
+
+	gauge(&b, "rotki_sync_last_run_users", "Number of users processed by the last sync run.")
+	sample(&b, "rotki_sync_last_run_users", nil, float64(len(run.Users)))
+
+	gauge(&b, "rotki_sync_last_run_task_polls", "Number of /tasks requests made by the last sync run.")
+	sample(&b, "rotki_sync_last_run_task_polls", nil, float64(run.Polls))
+
+	gauge(&b, "rotki_sync_last_run_rate_limited_seconds", "Time rotki-core was rate-limited by a remote provider during the last sync run.")
+	sample(&b, "rotki_sync_last_run_rate_limited_seconds", nil, run.RateLimitedSeconds)
+
+	if run.CoreVersion != "" {
+		gauge(&b, "rotki_sync_core_info", "rotki-core version the last sync run ran against.")
+		sample(&b, "rotki_sync_core_info", []string{"version", run.CoreVersion}, 1)
+	}
+
+	steps := []struct {
+		name, help string
+		value      func(services.StepDocument) float64
+	}{
+		{"rotki_sync_step_ok", "Items a step completed successfully in the last run.",
+			func(s services.StepDocument) float64 { return float64(s.Ok) }},
+		{"rotki_sync_step_failed", "Items a step failed in the last run.",
+			func(s services.StepDocument) float64 { return float64(s.Failed) }},
+		{"rotki_sync_step_timed_out", "Items a step gave up on at their time limit in the last run.",
+			func(s services.StepDocument) float64 { return float64(s.TimedOut) }},
+		{"rotki_sync_step_success", "Whether a step succeeded in the last run (1) or failed (0).",
+			func(s services.StepDocument) float64 { return boolValue(s.Status == services.StatusOK) }},
+		{"rotki_sync_step_duration_seconds", "Wall-clock duration of a step in the last run.",
+			func(s services.StepDocument) float64 { return s.DurationSeconds }},
+		{"rotki_sync_step_task_polls", "Number of /tasks requests made while a step ran in the last run.",
+			func(s services.StepDocument) float64 { return float64(s.Polls) }},
+		{"rotki_sync_step_rate_limited_seconds", "Time rotki-core was rate-limited by a remote provider while a step ran in the last run.",
+			func(s services.StepDocument) float64 { return s.RateLimitedSeconds }},
+	}
+	for _, metric := range steps {
+		gauge(&b, metric.name, metric.help)
+		for _, user := range run.Users {
+			for _, step := range user.Steps {
+				// A skipped step did not run; omitting it keeps the previous
+				// value from looking like a fresh zero.
+				if step.Status == services.StatusSkipped {
+					continue
+				}
+				sample(&b, metric.name, []string{"user", user.Username, "step", step.ID}, metric.value(step))
+			}
+		}
+	}
+
+	b.WriteString("# EOF\n")
+	return []byte(b.String())
+}
+
+// WriteFile renders the run to path, replacing it atomically.
+func WriteFile(path string, run services.ReportDocument, exitCode int) error {
+	if err := utils.WriteFileAtomic(path, Render(run, exitCode), 0o644); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	return nil
+}
+
+func gauge(b *strings.Builder, name, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+// sample writes one sample line. labels alternates names and values.
+func sample(b *strings.Builder, name string, labels []string, value float64) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(b, " %g\n", value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func boolValue(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/services"
+)
+
+func testRun() services.ReportDocument {
+	return services.ReportDocument{
+		FinishedAt:         time.Unix(1767346200, 0),
+		DurationSeconds:    92.5,
+		Polls:              40,
+		RateLimitedSeconds: 75,
+		CoreVersion:        "1.43.2",
+		Users: []services.UserDocument{{
+			Username: `al"ice`,
+			Steps: []services.StepDocument{
+				{ID: services.StepEvmFetch, Status: services.StatusFailed, Ok: 0, Failed: 3, DurationSeconds: 12.5, Polls: 17, RateLimitedSeconds: 30},
+				{ID: services.StepSnapshot, Status: services.StatusSkipped},
+			},
+		}},
+	}
+}
+
+func TestRender(t *testing.T) {
+	out := string(Render(testRun(), 1))
+
+	for _, want := range []string{
+		"# TYPE rotki_sync_last_run_timestamp_seconds gauge\n",
+		"rotki_sync_last_run_timestamp_seconds 1.7673462e+09\n",
+		"rotki_sync_last_run_exit_code 1\n",
+		"rotki_sync_last_run_duration_seconds 92.5\n",
+		`rotki_sync_core_info{version="1.43.2"} 1` + "\n",
+		`rotki_sync_step_failed{user="al\"ice",step="evm-fetch"} 3` + "\n",
+		`rotki_sync_step_success{user="al\"ice",step="evm-fetch"} 0` + "\n",
+		`rotki_sync_step_duration_seconds{user="al\"ice",step="evm-fetch"} 12.5` + "\n",
+		"rotki_sync_last_run_task_polls 40\n",
+		"rotki_sync_last_run_rate_limited_seconds 75\n",
+		`rotki_sync_step_rate_limited_seconds{user="al\"ice",step="evm-fetch"} 30` + "\n",
+		`rotki_sync_step_task_polls{user="al\"ice",step="evm-fetch"} 17` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `step="snapshot"`) {
+		t.Error("skipped steps must not be exported")
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Error("OpenMetrics output must end with # EOF")
+	}
+}
+
+func TestWriteFileReplaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rotki_sync.prom")
+	if err := os.WriteFile(path, []byte("stale"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, testRun(), 0); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "rotki_sync_last_run_exit_code 0\n") {
+		t.Errorf("file not replaced:\n%s", data)
+	}
+}
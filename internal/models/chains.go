@@ -54,6 +54,10 @@ type TransactionAccount struct {
 // TransactionsRequest represents a request to fetch transactions via generic endpoint
 type TransactionsRequest struct {
 	Accounts []TransactionAccount `json:"accounts"`
+	// FromTimestamp and ToTimestamp limit the query to a time range; zero
+	// values query the whole history.
+	FromTimestamp int64 `json:"from_timestamp,omitempty"`
+	ToTimestamp   int64 `json:"to_timestamp,omitempty"`
 }
 
 // TransactionDecodeRequest represents a request to decode transactions via generic endpoint
@@ -40,7 +40,21 @@ type TaskOutcome struct {
 	StatusCode int             `json:"status_code"`
 }
 
-// Err reports a non-nil error when the outcome describes a failed operation.
+// TaskError is the failure a completed async task reported in its outcome.
+// StatusCode is 0 when the task signaled failure without one.
+type TaskError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *TaskError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("async task reported failure: %s", e.Message)
+	}
+	return fmt.Sprintf("async task failed (status %d): %s", e.StatusCode, e.Message)
+}
+
+// Err reports a *TaskError when the outcome describes a failed operation.
 // It treats a non-2xx status_code as a failure, and also a literal
 // result==false paired with a message (some endpoints omit status_code but
 // still signal failure this way). A zero status_code is treated as "not
@@ -51,13 +65,13 @@ func (o TaskOutcome) Err() error {
 		if msg == "" {
 			msg = "operation failed"
 		}
-		return fmt.Errorf("async task failed (status %d): %s", o.StatusCode, msg)
+		return &TaskError{StatusCode: o.StatusCode, Message: msg}
 	}
 
 	if o.Message != "" && len(o.Result) > 0 {
 		var ok bool
 		if err := json.Unmarshal(o.Result, &ok); err == nil && !ok {
-			return fmt.Errorf("async task reported failure: %s", o.Message)
+			return &TaskError{Message: o.Message}
 		}
 	}
 
@@ -1,10 +1,13 @@
 // Package paths resolves the per-user base directory where rotki-sync keeps the
-// files it manages: the downloaded rotki-core bundle and the core log. Anchoring
+// files it manages: the downloaded rotki-core bundle, the core log, run reports
+// and the config file. Anchoring
 // these to a stable location instead of the current working directory lets a
 // binary installed in ~/.local/bin run from any directory.
 package paths
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
 	"path/filepath"
 )
@@ -41,3 +44,63 @@ func BinDir() string {
 func LogDir() string {
 	return filepath.Join(Home(), "logs")
 }
+
+// ReportDir is the directory where per-run JSON reports are written
+// (<home>/reports).
+func ReportDir() string {
+	return filepath.Join(Home(), "reports")
+}
+
+// LockDir is the directory holding the per-data-dir run locks (<home>/locks).
+func LockDir() string {
+	return filepath.Join(Home(), "locks")
+}
+
+// HistoryFile is the append-only run history (<home>/history.jsonl).
+func HistoryFile() string {
+	return filepath.Join(Home(), "history.jsonl")
+}
+
+// StateFile holds the per-user incremental fetch state of the rotki data
+// named by scope (see DataDirKey and BackendKey), so two data dirs with the
+// same username never share a fetch window (<home>/state/<scope>.json).
+func StateFile(scope string) string {
+	return filepath.Join(Home(), "state", scope+".json")
+}
+
+// CheckpointFile holds the progress of an unfinished run for --resume against
+// the rotki data named by scope (see DataDirKey and BackendKey)
+// (<home>/checkpoints/<scope>.json).
+func CheckpointFile(scope string) string {
+	return filepath.Join(Home(), "checkpoints", scope+".json")
+}
+
+// ConfigFile is the default location of the declarative config file
+// (<home>/config.toml).
+func ConfigFile() string {
+	return filepath.Join(Home(), "config.toml")
+}
+
+// DataDirKey returns a short, stable key for the rotki data dir dataDir, for
+// naming the files kept per data dir: "default" for rotki's default location
+// (an empty dataDir), otherwise a hash of its absolute path.
+func DataDirKey(dataDir string) string {
+	if dataDir == "" {
+		return "default"
+	}
+	if abs, err := filepath.Abs(dataDir); err == nil {
+		dataDir = abs
+	}
+	return hash(dataDir)
+}
+
+// BackendKey returns a short, stable key for an externally managed rotki-core
+// reached at baseURL, whose data dir rotki-sync cannot see.
+func BackendKey(baseURL string) string {
+	return hash(baseURL)
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:6])
+}
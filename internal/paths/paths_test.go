@@ -41,4 +41,37 @@ func TestBinAndLogDirsAreUnderHome(t *testing.T) {
 	if got, want := LogDir(), filepath.Join("/base", "logs"); got != want {
 		t.Errorf("LogDir() = %q, want %q", got, want)
 	}
+	if got, want := ReportDir(), filepath.Join("/base", "reports"); got != want {
+		t.Errorf("ReportDir() = %q, want %q", got, want)
+	}
+	if got, want := LockDir(), filepath.Join("/base", "locks"); got != want {
+		t.Errorf("LockDir() = %q, want %q", got, want)
+	}
+	if got, want := HistoryFile(), filepath.Join("/base", "history.jsonl"); got != want {
+		t.Errorf("HistoryFile() = %q, want %q", got, want)
+	}
+	if got, want := StateFile("default"), filepath.Join("/base", "state", "default.json"); got != want {
+		t.Errorf("StateFile() = %q, want %q", got, want)
+	}
+	if got, want := CheckpointFile("default"), filepath.Join("/base", "checkpoints", "default.json"); got != want {
+		t.Errorf("CheckpointFile() = %q, want %q", got, want)
+	}
+	if got, want := ConfigFile(), filepath.Join("/base", "config.toml"); got != want {
+		t.Errorf("ConfigFile() = %q, want %q", got, want)
+	}
+}
+
+func TestDataDirKey(t *testing.T) {
+	if got := DataDirKey(""); got != "default" {
+		t.Errorf("DataDirKey(\"\") = %q, want default", got)
+	}
+	if DataDirKey("/data/a") == DataDirKey("/data/b") {
+		t.Error("different data dirs must get different keys")
+	}
+	if DataDirKey("/data/a") != DataDirKey("/data/a/") {
+		t.Error("equivalent data dirs must share a key")
+	}
+	if BackendKey("http://rotki:4242") == BackendKey("http://other:4242") {
+		t.Error("different backends must get different keys")
+	}
 }
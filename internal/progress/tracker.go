@@ -12,14 +12,20 @@
 // Both sources are strictly best-effort: if the websocket never connects or the
 // log cannot be read, Snapshot returns less detail (or an empty string). It
 // never errors and never blocks the heartbeat.
+//
+// The rate-limit markers also feed the scheduling of new tasks: RateLimits
+// tells when each provider was last seen rate-limited, and RateLimitedTime
+// adds up how long rotki-core was.
 package progress
 
 import (
 	"io"
+	"maps"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/kelsos/rotki-sync/internal/logger"
 )
@@ -28,6 +34,14 @@ import (
 // huge, fast-growing debug log cannot make the heartbeat expensive.
 const maxLogScanBytes = 512 * 1024
 
+// RateLimitHold is how long a provider counts as rate-limited after its last
+// rate-limit marker; rotki-core logs one each time it backs off.
+const RateLimitHold = 30 * time.Second
+
+// minRateLimitScan is the least time between two log scans for RateLimits,
+// which the scheduler may call before every task.
+const minRateLimitScan = time.Second
+
 // Tracker aggregates websocket progress and log-tail rate-limit causes. The
 // zero value is not usable; construct it with NewTracker. All exported methods
 // are safe for concurrent use.
@@ -50,22 +64,57 @@ type Tracker struct {
 	logOffset  int64
 	logStarted bool
 	logErr     bool
+	lastScan   time.Time
+
+	// cause is the source of the latest rate-limit marker not yet reported
+	// by Snapshot.
+	cause string
+	// limitedAt is when each provider was last seen rate-limited.
+	limitedAt map[string]time.Time
+	// limitedTotal adds up the closed windows of rate limiting; the open one
+	// runs from limitedSince to limitedUntil.
+	limitedTotal time.Duration
+	limitedSince time.Time
+	limitedUntil time.Time
 
 	// websocket lifecycle
-	stop     chan struct{}
-	stopOnce sync.Once
-	wsOnce   sync.Once
+	stop      chan struct{}
+	stopOnce  sync.Once
+	wsOnce    sync.Once
+	connected bool
+
+	// onFinished is called when a websocket message announces finished work
+	// (see finishedWork).
+	onFinished func()
 }
 
 // NewTracker returns a Tracker that reads rate-limit causes from logPath (the
 // rotki-core log). The websocket is not started until StartWebsocket is called.
 func NewTracker(logPath string) *Tracker {
 	return &Tracker{
-		logPath: logPath,
-		stop:    make(chan struct{}),
+		logPath:   logPath,
+		stop:      make(chan struct{}),
+		limitedAt: make(map[string]time.Time),
 	}
 }
 
+// SetFinishedHandler installs fn to be called whenever a websocket message
+// announces that rotki-core finished a piece of work (a transaction query, a
+// decode or an event query), which usually means an async task is about to
+// complete. It must be called before StartWebsocket; fn must not block.
+func (t *Tracker) SetFinishedHandler(fn func()) {
+	t.mu.Lock()
+	t.onFinished = fn
+	t.mu.Unlock()
+}
+
+// Connected reports whether the websocket is currently connected.
+func (t *Tracker) Connected() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.connected
+}
+
 // Snapshot returns a short human annotation describing the current task state,
 // or "" when nothing is known. It combines the websocket "what" with the
 // log-tail "why", e.g. "decoding ethereum 250/1000 — coingecko rate-limited".
@@ -73,7 +122,9 @@ func (t *Tracker) Snapshot() string {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	cause := t.scanLogForCauseLocked()
+	t.scanLogForCauseLocked()
+	cause := t.cause
+	t.cause = ""
 
 	var what string
 	switch {
@@ -100,19 +151,70 @@ func (t *Tracker) Snapshot() string {
 	}
 }
 
+// RateLimits returns when each provider was last seen rate-limited, scanning
+// the log when it was not scanned in the last minRateLimitScan. A provider
+// counts as rate-limited for RateLimitHold after that.
+func (t *Tracker) RateLimits() map[string]time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if time.Since(t.lastScan) >= minRateLimitScan {
+		t.scanLogForCauseLocked()
+	}
+	return maps.Clone(t.limitedAt)
+}
+
+// RateLimitedTime returns how long rotki-core has been rate-limited by any
+// provider so far, counting RateLimitHold after each marker.
+func (t *Tracker) RateLimitedTime() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rateLimitedTimeLocked(time.Now())
+}
+
+func (t *Tracker) rateLimitedTimeLocked(now time.Time) time.Duration {
+	total := t.limitedTotal
+	if !t.limitedSince.IsZero() && now.After(t.limitedSince) {
+		end := t.limitedUntil
+		if now.Before(end) {
+			end = now
+		}
+		total += end.Sub(t.limitedSince)
+	}
+	return total
+}
+
+// noteRateLimitLocked records that provider was rate-limited at at. The
+// caller must hold t.mu.
+func (t *Tracker) noteRateLimitLocked(provider string, at time.Time) {
+	t.limitedAt[provider] = at
+	t.cause = provider
+	if !t.limitedSince.IsZero() && !at.After(t.limitedUntil) {
+		t.limitedUntil = at.Add(RateLimitHold)
+		return
+	}
+	if !t.limitedSince.IsZero() {
+		t.limitedTotal += t.limitedUntil.Sub(t.limitedSince)
+	}
+	t.limitedSince = at
+	t.limitedUntil = at.Add(RateLimitHold)
+}
+
 // scanLogForCauseLocked reads the log bytes appended since the last call and
-// returns the source of the most recent rate-limit marker found in that window
-// (or "" if none). Scoping to the new window means a stale rate-limit from an
-// earlier step is not reported as the current cause. The caller must hold t.mu.
-func (t *Tracker) scanLogForCauseLocked() string {
+// notes the rate-limit markers found in that window (see
+// noteRateLimitLocked). Scoping to the new window means a stale rate-limit
+// from an earlier step is not reported as the current cause. The caller must
+// hold t.mu.
+func (t *Tracker) scanLogForCauseLocked() {
+	t.lastScan = time.Now()
 	if t.logPath == "" || t.logErr {
-		return ""
+		return
 	}
 
 	info, err := os.Stat(t.logPath)
 	if err != nil {
 		// The log may not exist yet (core still starting); not fatal.
-		return ""
+		return
 	}
 	size := info.Size()
 
@@ -120,7 +222,7 @@ func (t *Tracker) scanLogForCauseLocked() string {
 		// First observation: only consider markers emitted from here forward.
 		t.logStarted = true
 		t.logOffset = size
-		return ""
+		return
 	}
 
 	readFrom := t.logOffset
@@ -132,39 +234,41 @@ func (t *Tracker) scanLogForCauseLocked() string {
 		readFrom = size - maxLogScanBytes
 	}
 	if size <= readFrom {
-		return "" // nothing new
+		return // nothing new
 	}
 
 	f, err := os.Open(t.logPath) // #nosec G304 - path is the configured core log
 	if err != nil {
 		t.logErr = true
 		logger.Debug("Progress tracker: cannot open log %s: %v", t.logPath, err)
-		return ""
+		return
 	}
 	defer func() { _ = f.Close() }()
 
 	if _, err := f.Seek(readFrom, io.SeekStart); err != nil {
-		return ""
+		return
 	}
 	data, err := io.ReadAll(f)
 	if err != nil {
-		return ""
+		return
 	}
 	t.logOffset = readFrom + int64(len(data))
 
-	return causeFromLogChunk(data)
+	for _, provider := range rateLimitsInLogChunk(data) {
+		t.noteRateLimitLocked(provider, t.lastScan)
+	}
 }
 
-// causeFromLogChunk returns the rate-limited source named in the last
-// rate-limit line of chunk, or "" if there is none.
-func causeFromLogChunk(chunk []byte) string {
-	cause := ""
+// rateLimitsInLogChunk returns the rate-limited sources named in the
+// rate-limit lines of chunk, in log order.
+func rateLimitsInLogChunk(chunk []byte) []string {
+	var sources []string
 	for _, line := range strings.Split(string(chunk), "\n") {
 		if strings.Contains(strings.ToLower(line), "rate limit") {
-			cause = rateLimitSource(line)
+			sources = append(sources, rateLimitSource(line))
 		}
 	}
-	return cause
+	return sources
 }
 
 // rateLimitSource extracts the external-API name from a rotki-core log line such
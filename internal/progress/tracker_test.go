@@ -1,9 +1,12 @@
 package progress
 
 import (
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestRateLimitSource(t *testing.T) {
@@ -43,22 +46,23 @@ func TestRateLimitSource(t *testing.T) {
 	}
 }
 
-func TestCauseFromLogChunk(t *testing.T) {
+func TestRateLimitsInLogChunk(t *testing.T) {
 	t.Run("no rate-limit lines", func(t *testing.T) {
 		chunk := []byte("[..] DEBUG web3 Greenlet-1: ordinary line\n[..] INFO another line\n")
-		if got := causeFromLogChunk(chunk); got != "" {
-			t.Fatalf("expected empty cause, got %q", got)
+		if got := rateLimitsInLogChunk(chunk); len(got) != 0 {
+			t.Fatalf("expected no sources, got %q", got)
 		}
 	})
 
-	t.Run("returns last marker source", func(t *testing.T) {
+	t.Run("returns marker sources in log order", func(t *testing.T) {
 		chunk := []byte(
 			"[..] WARNING rotkehlchen.externalapis.coingecko Greenlet-1: Got rate limited by coingecko\n" +
 				"[..] DEBUG web3 Greenlet-1: unrelated\n" +
 				"[..] DEBUG rotkehlchen.externalapis.blockscout Greenlet-1: request got rate limited\n",
 		)
-		if got := causeFromLogChunk(chunk); got != "blockscout" {
-			t.Fatalf("expected last source blockscout, got %q", got)
+		got := rateLimitsInLogChunk(chunk)
+		if want := []string{"coingecko", "blockscout"}; !slices.Equal(got, want) {
+			t.Fatalf("rateLimitsInLogChunk = %q, want %q", got, want)
 		}
 	})
 }
@@ -137,3 +141,115 @@ func TestCloseIsSafeWithoutWebsocket(t *testing.T) {
 	tr.Close()
 	tr.Close() // idempotent
 }
+
+func TestWebsocketURL(t *testing.T) {
+	tests := map[string]string{
+		"http://127.0.0.1:59001": "ws://127.0.0.1:59001/ws",
+		"http://rotki:4242/":     "ws://rotki:4242/ws",
+		"https://rotki.lan":      "wss://rotki.lan/ws",
+	}
+	for base, want := range tests {
+		if got := websocketURL(base); got != want {
+			t.Errorf("websocketURL(%q) = %q, want %q", base, got, want)
+		}
+	}
+}
+
+func TestFinishedHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want bool
+	}{
+		{"transaction query finished", `{"type":"transaction_status","data":{"chain":"optimism","subtype":"evm","status":"querying_transactions_finished"}}`, true},
+		{"transaction query started", `{"type":"transaction_status","data":{"chain":"optimism","subtype":"evm","status":"querying_transactions_started"}}`, false},
+		{"decode reached its total", `{"type":"progress_updates","data":{"chain":"ethereum","subtype":"undecoded_transactions","total":1000,"processed":1000}}`, true},
+		{"decode in progress", `{"type":"progress_updates","data":{"chain":"ethereum","subtype":"undecoded_transactions","total":1000,"processed":250}}`, false},
+		{"other progress reached its total", `{"type":"progress_updates","data":{"subtype":"protocol_cache_updates","total":5,"processed":5}}`, true},
+		{"event query finished", `{"type":"history_events_status","data":{"status":"querying_events_finished","location":"kraken"}}`, true},
+		{"event query update", `{"type":"history_events_status","data":{"status":"querying_events_status_update","location":"kraken"}}`, false},
+		{"unrelated type", `{"type":"some_other_type","data":{"status":"x_finished"}}`, false},
+		{"malformed", `{"type":"transaction_status","data":"oops"}`, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tr := NewTracker("")
+			called := false
+			tr.SetFinishedHandler(func() { called = true })
+			tr.handleMessage([]byte(tc.msg))
+			if called != tc.want {
+				t.Fatalf("finished handler called = %v, want %v", called, tc.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitedTime(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	tr := NewTracker("")
+	if got := tr.rateLimitedTimeLocked(at(0)); got != 0 {
+		t.Fatalf("rate-limited time before any marker = %s, want 0", got)
+	}
+
+	tr.noteRateLimitLocked("coingecko", at(0))
+	if got := tr.rateLimitedTimeLocked(at(10)); got != 10*time.Second {
+		t.Fatalf("rate-limited time inside the hold = %s, want 10s", got)
+	}
+
+	// A marker inside the hold extends the window instead of opening a new one.
+	tr.noteRateLimitLocked("blockscout", at(20))
+	if got := tr.rateLimitedTimeLocked(at(100)); got != 50*time.Second {
+		t.Fatalf("rate-limited time after an extended window = %s, want 50s", got)
+	}
+
+	// A marker after the hold opens a new window; the gap is not counted.
+	tr.noteRateLimitLocked("coingecko", at(200))
+	if got := tr.rateLimitedTimeLocked(at(205)); got != 55*time.Second {
+		t.Fatalf("rate-limited time in a second window = %s, want 55s", got)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "rotki-core.log")
+	if err := os.WriteFile(logPath, []byte("startup line\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := NewTracker(logPath)
+	if got := tr.RateLimits(); len(got) != 0 {
+		t.Fatalf("RateLimits before any marker = %v, want none", got)
+	}
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("[..] DEBUG rotkehlchen.externalapis.blockscout Greenlet-1: request got rate limited\n" +
+		"[..] WARNING rotkehlchen.externalapis.coingecko Greenlet-1: Got rate limited by coingecko\n"); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	tr.mu.Lock()
+	tr.lastScan = time.Time{} // skip the scan throttle
+	tr.mu.Unlock()
+	limits := tr.RateLimits()
+	if got, want := slices.Sorted(maps.Keys(limits)), []string{"blockscout", "coingecko"}; !slices.Equal(got, want) {
+		t.Fatalf("RateLimits providers = %q, want %q", got, want)
+	}
+	if at := limits["coingecko"]; time.Since(at) > RateLimitHold {
+		t.Fatalf("coingecko last seen rate-limited at %s, want just now", at)
+	}
+
+	// The markers also reach the next heartbeat.
+	if got, want := tr.Snapshot(), "coingecko rate-limited"; got != want {
+		t.Fatalf("Snapshot = %q, want %q", got, want)
+	}
+	if got := tr.RateLimitedTime(); got <= 0 {
+		t.Fatalf("RateLimitedTime = %s, want > 0", got)
+	}
+}
@@ -2,7 +2,7 @@ package progress
 
 import (
 	"encoding/json"
-	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -36,16 +36,40 @@ type txStatusData struct {
 	Status string `json:"status"`
 }
 
-// StartWebsocket connects to the rotki-core websocket on the given port and
-// keeps the latest decode/transaction status updated in the background. It is
-// idempotent and must be called after the API is ready. A connection failure is
-// non-fatal: the tracker simply degrades to log-only (or empty) snapshots.
-func (t *Tracker) StartWebsocket(port int) {
+// eventsStatusData is the payload of a history_events_status message, sent
+// while exchange and online events are queried.
+type eventsStatusData struct {
+	Status string `json:"status"`
+}
+
+// finishedStatus reports whether a transaction or event query status marks
+// the end of the query, e.g. "querying_transactions_finished" or
+// "querying_events_finished".
+func finishedStatus(status string) bool {
+	return strings.HasSuffix(status, "_finished")
+}
+
+// StartWebsocket connects to the websocket of the rotki-core serving baseURL
+// (e.g. "http://127.0.0.1:59001") and keeps the latest decode/transaction
+// status updated in the background. It is idempotent and must be called after
+// the API is ready. A connection failure is non-fatal: the tracker simply
+// degrades to log-only (or empty) snapshots.
+func (t *Tracker) StartWebsocket(baseURL string) {
 	t.wsOnce.Do(func() {
-		go t.runWebsocket(fmt.Sprintf("ws://127.0.0.1:%d%s", port, wsPath))
+		go t.runWebsocket(websocketURL(baseURL))
 	})
 }
 
+// websocketURL maps a REST base URL onto the websocket endpoint served next to
+// it: http becomes ws and https becomes wss.
+func websocketURL(baseURL string) string {
+	base := strings.TrimRight(baseURL, "/")
+	if rest, ok := strings.CutPrefix(base, "https://"); ok {
+		return "wss://" + rest + wsPath
+	}
+	return "ws://" + strings.TrimPrefix(base, "http://") + wsPath
+}
+
 // runWebsocket dials the websocket and, on disconnect, reconnects with a capped
 // backoff until Close is called.
 func (t *Tracker) runWebsocket(url string) {
@@ -75,10 +99,18 @@ func (t *Tracker) runWebsocket(url string) {
 
 		logger.Debug("Progress websocket connected to %s", url)
 		backoff = time.Second
+		t.setConnected(true)
 		t.readLoop(conn)
+		t.setConnected(false)
 	}
 }
 
+func (t *Tracker) setConnected(connected bool) {
+	t.mu.Lock()
+	t.connected = connected
+	t.mu.Unlock()
+}
+
 // readLoop consumes messages until the connection errors or Close is called.
 func (t *Tracker) readLoop(conn *websocket.Conn) {
 	// Close the connection when stop fires so a blocked ReadMessage unblocks.
@@ -104,7 +136,8 @@ func (t *Tracker) readLoop(conn *websocket.Conn) {
 	}
 }
 
-// handleMessage parses one websocket frame and updates the tracker state. Frames
+// handleMessage parses one websocket frame, updates the tracker state and
+// calls the finished handler when the frame announces finished work. Frames
 // of other types, or malformed frames, are ignored.
 func (t *Tracker) handleMessage(raw []byte) {
 	var env wsEnvelope
@@ -112,14 +145,29 @@ func (t *Tracker) handleMessage(raw []byte) {
 		return
 	}
 
+	if t.updateFromMessage(env) {
+		t.mu.Lock()
+		onFinished := t.onFinished
+		t.mu.Unlock()
+		if onFinished != nil {
+			onFinished()
+		}
+	}
+}
+
+// updateFromMessage applies one message to the tracker state and reports
+// whether it announces finished work: a query status ending in "_finished" or
+// a progress update that reached its total.
+func (t *Tracker) updateFromMessage(env wsEnvelope) (finished bool) {
 	switch env.Type {
 	case "progress_updates":
 		var d progressData
 		if err := json.Unmarshal(env.Data, &d); err != nil {
-			return
+			return false
 		}
+		finished = d.Total > 0 && d.Processed >= d.Total
 		if d.Subtype != "undecoded_transactions" {
-			return
+			return finished
 		}
 		t.mu.Lock()
 		t.decodeChain = d.Chain
@@ -127,15 +175,25 @@ func (t *Tracker) handleMessage(raw []byte) {
 		t.decodeTotal = d.Total
 		t.haveDecode = true
 		t.mu.Unlock()
+		return finished
 
 	case "transaction_status":
 		var d txStatusData
 		if err := json.Unmarshal(env.Data, &d); err != nil {
-			return
+			return false
 		}
 		t.mu.Lock()
 		t.statusChain = d.Chain
 		t.statusStep = d.Status
 		t.mu.Unlock()
+		return finishedStatus(d.Status)
+
+	case "history_events_status":
+		var d eventsStatusData
+		if err := json.Unmarshal(env.Data, &d); err != nil {
+			return false
+		}
+		return finishedStatus(d.Status)
 	}
+	return false
 }
@@ -0,0 +1,293 @@
+// Package schedule parses a practical subset of systemd OnCalendar expressions
+// (the syntax `service install --schedule` already takes) and computes the next
+// time one fires, so the daemon mode can share schedules with the timer.
+//
+// Supported forms:
+//
+//	[DayOfWeek] [Year-Month-Day] Hour:Minute[:Second]
+//	minutely, hourly, daily, weekly, monthly, yearly
+//
+// Each numeric field accepts *, a value, a comma list, a range (a..b) and a
+// repetition (a/n or */n). Day-of-week accepts names (Mon, Tuesday), lists and
+// ranges (Mon..Fri). An omitted date is *-*-*; omitted seconds are 00. Times
+// are interpreted in the local time zone.
+package schedule
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearchDays bounds Next's search so an expression that can never fire
+// (e.g. 2020-*-*) ends instead of looping forever.
+const maxSearchDays = 5 * 366
+
+// Schedule is a parsed calendar expression.
+type Schedule struct {
+	expr                    string
+	weekdays                []time.Weekday // empty means any
+	years, months, days     field
+	hours, minutes, seconds []int
+}
+
+// field is a set of allowed values; nil means any.
+type field []int
+
+func (f field) matches(v int) bool {
+	return f == nil || slices.Contains(f, v)
+}
+
+var shorthands = map[string]string{
+	"minutely": "*-*-* *:*:00",
+	"hourly":   "*-*-* *:00:00",
+	"daily":    "*-*-* 00:00:00",
+	"weekly":   "Mon *-*-* 00:00:00",
+	"monthly":  "*-*-01 00:00:00",
+	"yearly":   "*-01-01 00:00:00",
+	"annually": "*-01-01 00:00:00",
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// Parse parses a calendar expression.
+func Parse(expr string) (*Schedule, error) {
+	s := &Schedule{expr: expr}
+	normalized := strings.TrimSpace(expr)
+	if full, ok := shorthands[strings.ToLower(normalized)]; ok {
+		normalized = full
+	}
+
+	parts := strings.Fields(normalized)
+	if len(parts) == 0 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid schedule %q: expected [weekday] [date] time", expr)
+	}
+
+	// The time is always last; a date contains '-', a weekday does not.
+	timePart := parts[len(parts)-1]
+	rest := parts[:len(parts)-1]
+	datePart := "*-*-*"
+	if len(rest) > 0 && strings.Contains(rest[len(rest)-1], "-") {
+		datePart = rest[len(rest)-1]
+		rest = rest[:len(rest)-1]
+	}
+	if len(rest) > 1 {
+		return nil, fmt.Errorf("invalid schedule %q: unexpected %q", expr, rest[0])
+	}
+	if len(rest) == 1 {
+		weekdays, err := parseWeekdays(rest[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", expr, err)
+		}
+		s.weekdays = weekdays
+	}
+
+	if err := s.parseDate(datePart); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", expr, err)
+	}
+	if err := s.parseTime(timePart); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", expr, err)
+	}
+	return s, nil
+}
+
+// String returns the expression the schedule was parsed from.
+func (s *Schedule) String() string { return s.expr }
+
+func (s *Schedule) parseDate(part string) error {
+	fields := strings.Split(part, "-")
+	if len(fields) != 3 {
+		return fmt.Errorf("date %q must be Year-Month-Day", part)
+	}
+	var err error
+	if s.years, err = parseField(fields[0], 1970, 2199, true); err != nil {
+		return fmt.Errorf("year: %w", err)
+	}
+	if s.months, err = parseField(fields[1], 1, 12, true); err != nil {
+		return fmt.Errorf("month: %w", err)
+	}
+	if s.days, err = parseField(fields[2], 1, 31, true); err != nil {
+		return fmt.Errorf("day: %w", err)
+	}
+	return nil
+}
+
+func (s *Schedule) parseTime(part string) error {
+	fields := strings.Split(part, ":")
+	if len(fields) == 2 {
+		fields = append(fields, "00")
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("time %q must be Hour:Minute[:Second]", part)
+	}
+	var err error
+	if s.hours, err = parseField(fields[0], 0, 23, false); err != nil {
+		return fmt.Errorf("hour: %w", err)
+	}
+	if s.minutes, err = parseField(fields[1], 0, 59, false); err != nil {
+		return fmt.Errorf("minute: %w", err)
+	}
+	if s.seconds, err = parseField(fields[2], 0, 59, false); err != nil {
+		return fmt.Errorf("second: %w", err)
+	}
+	return nil
+}
+
+// parseField parses one numeric component into its sorted allowed values.
+// When anyIsNil is set, * yields nil (match anything) instead of the full
+// range, which keeps open-ended fields like the year cheap.
+func parseField(spec string, lo, hi int, anyIsNil bool) (field, error) {
+	if spec == "*" {
+		if anyIsNil {
+			return nil, nil
+		}
+		return rangeValues(lo, hi, 1), nil
+	}
+
+	var values []int
+	for _, item := range strings.Split(spec, ",") {
+		base, step := item, 1
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid repetition in %q", item)
+			}
+			base, step = item[:i], n
+		}
+
+		from, to := lo, hi
+		switch {
+		case base == "*":
+		case strings.Contains(base, ".."):
+			bounds := strings.SplitN(base, "..", 2)
+			var err error
+			if from, err = parseValue(bounds[0], lo, hi); err != nil {
+				return nil, err
+			}
+			if to, err = parseValue(bounds[1], lo, hi); err != nil {
+				return nil, err
+			}
+			if from > to {
+				return nil, fmt.Errorf("empty range %q", base)
+			}
+		default:
+			v, err := parseValue(base, lo, hi)
+			if err != nil {
+				return nil, err
+			}
+			from = v
+			if step == 1 {
+				to = v
+			}
+		}
+		values = append(values, rangeValues(from, to, step)...)
+	}
+
+	slices.Sort(values)
+	return slices.Compact(values), nil
+}
+
+func parseValue(s string, lo, hi int) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < lo || v > hi {
+		return 0, fmt.Errorf("value %d out of range %d..%d", v, lo, hi)
+	}
+	return v, nil
+}
+
+func rangeValues(from, to, step int) []int {
+	var values []int
+	for v := from; v <= to; v += step {
+		values = append(values, v)
+	}
+	return values
+}
+
+func parseWeekdays(spec string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, item := range strings.Split(spec, ",") {
+		if from, to, ok := strings.Cut(item, ".."); ok {
+			start, err := parseWeekday(from)
+			if err != nil {
+				return nil, err
+			}
+			end, err := parseWeekday(to)
+			if err != nil {
+				return nil, err
+			}
+			// Ranges may wrap the week (e.g. Sat..Mon).
+			for d := start; ; d = (d + 1) % 7 {
+				days = append(days, d)
+				if d == end {
+					break
+				}
+			}
+			continue
+		}
+		d, err := parseWeekday(item)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	d, ok := weekdayNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown weekday %q", name)
+	}
+	return d, nil
+}
+
+// Next returns the first time strictly after after at which the schedule
+// fires, and false when it never fires again within the search horizon.
+func (s *Schedule) Next(after time.Time) (time.Time, bool) {
+	after = after.Truncate(time.Second)
+	loc := after.Location()
+	day := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, loc)
+
+	for i := 0; i < maxSearchDays; i++ {
+		d := day.AddDate(0, 0, i)
+		if !s.matchesDay(d) {
+			continue
+		}
+		for _, h := range s.hours {
+			for _, m := range s.minutes {
+				for _, sec := range s.seconds {
+					t := time.Date(d.Year(), d.Month(), d.Day(), h, m, sec, 0, loc)
+					// Skip wall-clock times that a DST change moved onto
+					// another hour or day.
+					if t.Hour() != h || t.Day() != d.Day() {
+						continue
+					}
+					if t.After(after) {
+						return t, true
+					}
+				}
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func (s *Schedule) matchesDay(d time.Time) bool {
+	if len(s.weekdays) > 0 && !slices.Contains(s.weekdays, d.Weekday()) {
+		return false
+	}
+	return s.years.matches(d.Year()) && s.months.matches(int(d.Month())) && s.days.matches(d.Day())
+}
@@ -0,0 +1,70 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// 2026-01-02 is a Friday.
+	base := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*-*-* 09:30:00", time.Date(2026, 1, 3, 9, 30, 0, 0, time.UTC)},
+		{"*-*-* 10:00:00", time.Date(2026, 1, 3, 10, 0, 0, 0, time.UTC)}, // strictly after
+		{"*-*-* 10:15", time.Date(2026, 1, 2, 10, 15, 0, 0, time.UTC)},
+		{"daily", time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"hourly", time.Date(2026, 1, 2, 11, 0, 0, 0, time.UTC)},
+		{"weekly", time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"monthly", time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"Mon..Wed 06:00", time.Date(2026, 1, 5, 6, 0, 0, 0, time.UTC)},
+		{"Sat,Sun *-*-* 08:00:00", time.Date(2026, 1, 3, 8, 0, 0, 0, time.UTC)},
+		{"*-*-* *:0/20:00", time.Date(2026, 1, 2, 10, 20, 0, 0, time.UTC)},
+		{"*-*-* 06,18:00", time.Date(2026, 1, 2, 18, 0, 0, 0, time.UTC)},
+		{"*-*-* 08..11:30", time.Date(2026, 1, 2, 10, 30, 0, 0, time.UTC)},
+		{"*-03-01 00:00", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"2027-*-* 12:00", time.Date(2027, 1, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			s, err := Parse(tc.expr)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			got, ok := s.Next(base)
+			if !ok || !got.Equal(tc.want) {
+				t.Errorf("Next = %v (%v), want %v", got, ok, tc.want)
+			}
+		})
+	}
+}
+
+func TestNextNeverFires(t *testing.T) {
+	s, err := Parse("2020-*-* 00:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Next(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)); ok {
+		t.Error("a schedule in the past must not fire")
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"25:00",
+		"*-13-* 00:00",
+		"Funday 10:00",
+		"*-*-* 10",
+		"*-*-* 10:00:00 extra",
+		"*-*-* */0:00",
+		"*-*-* 12..10:00",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) should fail", expr)
+		}
+	}
+}
@@ -1,16 +1,20 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"sort"
 	"strconv"
 	"time"
 
 	"github.com/kelsos/rotki-sync/internal/async"
 	"github.com/kelsos/rotki-sync/internal/client"
+	"github.com/kelsos/rotki-sync/internal/config"
 	"github.com/kelsos/rotki-sync/internal/logger"
 	"github.com/kelsos/rotki-sync/internal/models"
+	"github.com/kelsos/rotki-sync/internal/state"
 )
 
 // excludedChains contains chains that should be excluded from EVM operations
@@ -31,10 +35,68 @@ func isChainExcluded(chainName string) bool {
 	return excludedChains[chainName]
 }
 
+// SetAccountRules sets the user's account inclusion/exclusion rules, applied on
+// top of excludedChains to transaction fetch, decode and token detection.
+func (s *BlockchainService) SetAccountRules(rules config.AccountRules) {
+	s.rules = rules
+}
+
+// accountSelected reports whether transactions and tokens of account are
+// processed.
+func (s *BlockchainService) accountSelected(account models.ChainAccount) bool {
+	if isChainExcluded(account.EvmChain) {
+		return false
+	}
+	ref := config.AccountRef{
+		ChainID:   account.ChainID,
+		EvmChain:  account.EvmChain,
+		ChainType: account.ChainType,
+		Address:   account.Address,
+		Tags:      account.Tags,
+	}
+	if account.Label != nil {
+		ref.Label = *account.Label
+	}
+	return s.rules.Selected(ref)
+}
+
+// chainSelected reports whether chain's transactions are decoded.
+func (s *BlockchainService) chainSelected(chain models.Blockchain) bool {
+	return !isChainExcluded(chain.EvmChainName) && s.rules.ChainSelected(chain.ID, chain.EvmChainName, chain.Type)
+}
+
+// selectAccounts drops the accounts the rules exclude, logging how many.
+func (s *BlockchainService) selectAccounts(accounts []models.ChainAccount) []models.ChainAccount {
+	selected := make([]models.ChainAccount, 0, len(accounts))
+	for _, account := range accounts {
+		if s.accountSelected(account) {
+			selected = append(selected, account)
+		}
+	}
+	if skipped := len(accounts) - len(selected); skipped > 0 {
+		logger.Info("Skipping %d of %d accounts excluded by chain or account rules", skipped, len(accounts))
+	}
+	return selected
+}
+
 // BlockchainService handles blockchain-related operations
 type BlockchainService struct {
 	client      *client.APIClient
 	asyncClient *async.Client
+	// events receives per-item results; nil outside a SyncService.
+	events *eventBus
+	// concurrency bounds parallel transaction fetches (see SetConcurrency).
+	concurrency config.ConcurrencyConfig
+	// window limits transaction fetches to what is new; nil fetches everything.
+	window *fetchWindow
+	// rules select the accounts to work on (see SetAccountRules).
+	rules config.AccountRules
+	// checkpoint records finished items and, on a resumed run, skips them;
+	// nil outside a SyncService.
+	checkpoint *runCheckpoint
+	// limits holds back tasks for rate-limited chains (see SetRateLimits);
+	// nil holds nothing back.
+	limits *rateLimitGate
 }
 
 // NewBlockchainServiceWithAsyncClient creates a new blockchain service with an async client
@@ -45,6 +107,31 @@ func NewBlockchainServiceWithAsyncClient(client *client.APIClient, asyncClient *
 	}
 }
 
+// record counts one attempted item into stats, publishes its result and
+// checkpoints it when it succeeded.
+func (s *BlockchainService) record(stats *OpStats, name string, start time.Time, err error) {
+	stats.record(name, start, err)
+	s.events.item(stats.Items[len(stats.Items)-1], err)
+	if err == nil {
+		s.checkpoint.itemDone(name)
+	}
+}
+
+// unfinished drops the accounts whose transactions were fetched before the
+// interruption of a resumed run.
+func (s *BlockchainService) unfinished(accounts []models.ChainAccount) []models.ChainAccount {
+	pending := make([]models.ChainAccount, 0, len(accounts))
+	for _, account := range accounts {
+		if s.checkpoint.pending(account.Blockchain + " " + account.Address) {
+			pending = append(pending, account)
+		}
+	}
+	if done := len(accounts) - len(pending); done > 0 {
+		logger.Info("Skipping %d accounts fetched before the interruption", done)
+	}
+	return pending
+}
+
 // nonDecodableChainTypes contains chain types that don't support transaction decoding
 var nonDecodableChainTypes = map[string]bool{
 	models.ChainTypeBitcoin: true,
@@ -58,9 +145,9 @@ var nonEvmChainTypes = []string{
 }
 
 // GetSupportedChainsByType retrieves supported chains filtered by type
-func (s *BlockchainService) GetSupportedChainsByType(chainType string) ([]models.Blockchain, error) {
+func (s *BlockchainService) GetSupportedChainsByType(ctx context.Context, chainType string) ([]models.Blockchain, error) {
 	var response models.BlockchainResponse
-	if err := s.client.Get("/blockchains/supported", &response); err != nil {
+	if err := s.client.GetContext(ctx, "/blockchains/supported", &response); err != nil {
 		return nil, fmt.Errorf("failed to get supported chains for type %s: %w", chainType, err)
 	}
 
@@ -75,12 +162,14 @@ func (s *BlockchainService) GetSupportedChainsByType(chainType string) ([]models
 }
 
 // GetSupportedEvmChains retrieves supported EVM chains
-func (s *BlockchainService) GetSupportedEvmChains() ([]models.Blockchain, error) {
-	return s.GetSupportedChainsByType(models.ChainTypeEvm)
+func (s *BlockchainService) GetSupportedEvmChains(ctx context.Context) ([]models.Blockchain, error) {
+	return s.GetSupportedChainsByType(ctx, models.ChainTypeEvm)
 }
 
-// FetchAccountsForChains retrieves accounts for the given chains
-func (s *BlockchainService) FetchAccountsForChains(chains []models.Blockchain) ([]models.ChainAccount, error) {
+// FetchAccountsForChains retrieves accounts for the given chains. A chain
+// whose accounts cannot be read is skipped; once ctx is done ctx's error is
+// returned instead.
+func (s *BlockchainService) FetchAccountsForChains(ctx context.Context, chains []models.Blockchain) ([]models.ChainAccount, error) {
 	var allAccounts []models.ChainAccount
 
 	for _, chain := range chains {
@@ -89,7 +178,10 @@ func (s *BlockchainService) FetchAccountsForChains(chains []models.Blockchain) (
 		endpoint := fmt.Sprintf("/blockchains/%s/accounts", chain.ID)
 		var response models.AccountsResponse
 
-		if err := s.client.Get(endpoint, &response); err != nil {
+		if err := s.client.GetContext(ctx, endpoint, &response); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
 			logger.Error("Failed to fetch accounts for chain %s: %v", chain.Name, err)
 			continue
 		}
@@ -101,6 +193,11 @@ func (s *BlockchainService) FetchAccountsForChains(chains []models.Blockchain) (
 				ChainID:    chain.ID,
 				Blockchain: chain.ID,
 				ChainType:  chain.Type,
+				Tags:       account.Tags,
+			}
+			if account.Label != "" {
+				label := account.Label
+				chainAccount.Label = &label
 			}
 			allAccounts = append(allAccounts, chainAccount)
 		}
@@ -112,13 +209,13 @@ func (s *BlockchainService) FetchAccountsForChains(chains []models.Blockchain) (
 }
 
 // FetchAccounts retrieves accounts for all EVM chains
-func (s *BlockchainService) FetchAccounts() ([]models.ChainAccount, error) {
-	evmChains, err := s.GetSupportedEvmChains()
+func (s *BlockchainService) FetchAccounts(ctx context.Context) ([]models.ChainAccount, error) {
+	evmChains, err := s.GetSupportedEvmChains(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.FetchAccountsForChains(evmChains)
+	return s.FetchAccountsForChains(ctx, evmChains)
 }
 
 // evmTransactionsEndpoint is the unified transactions route the desktop app
@@ -127,85 +224,102 @@ func (s *BlockchainService) FetchAccounts() ([]models.ChainAccount, error) {
 const evmTransactionsEndpoint = "/blockchains/transactions"
 
 // FetchEvmTransactions fetches EVM transactions for all accounts through the
-// unified transactions endpoint. It returns per-account ok/failed counts; a
-// removed endpoint (404) aborts the run with a ContractBreakError rather than
-// being retried once per account.
-func (s *BlockchainService) FetchEvmTransactions() (OpStats, error) {
+// unified transactions endpoint, several accounts at a time within the
+// configured concurrency. It returns per-account ok/failed counts; a removed
+// endpoint (404) aborts the run with a ContractBreakError rather than being
+// retried once per account. No request is started once ctx is done.
+func (s *BlockchainService) FetchEvmTransactions(ctx context.Context) (OpStats, error) {
 	logger.Info("Starting EVM transaction fetch...")
 
-	var stats OpStats
+	accountsByChain, err := s.evmFetchAccounts(ctx)
+	if err != nil {
+		return OpStats{}, err
+	}
 
-	chainAccounts, err := s.FetchAccounts()
+	stats, err := s.fetchConcurrently(ctx, "EVM transaction fetch", accountsByChain, s.GetAccountsTransactions)
 	if err != nil {
-		return stats, fmt.Errorf("failed to fetch accounts: %w", err)
+		return stats, err
 	}
 
-	logger.Info("Found %d total accounts across all chains", len(chainAccounts))
+	logger.Info("Completed EVM transaction fetch (%d ok / %d failed)", stats.Ok, stats.Failed)
+	return stats, nil
+}
 
-	// Group accounts by chain for efficient processing (exclude problematic chains)
-	accountsByChain := make(map[string][]models.ChainAccount)
-	for _, account := range chainAccounts {
-		if !isChainExcluded(account.EvmChain) {
-			accountsByChain[account.EvmChain] = append(accountsByChain[account.EvmChain], account)
-		}
+// evmFetchAccounts returns the selected accounts of every EVM chain, grouped by
+// chain id.
+func (s *BlockchainService) evmFetchAccounts(ctx context.Context) (map[string][]models.ChainAccount, error) {
+	chainAccounts, err := s.FetchAccounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch accounts: %w", err)
 	}
-	logger.Debug("Grouped accounts into %d unique chains (excluding problematic chains)", len(accountsByChain))
 
-	for chainID, accounts := range accountsByChain {
-		logger.Info("Processing %d accounts for chain %s", len(accounts), chainID)
+	logger.Info("Found %d total accounts across all chains", len(chainAccounts))
 
-		// Sort accounts alphabetically by address for consistent processing order
-		sort.Slice(accounts, func(i, j int) bool {
-			return accounts[i].Address < accounts[j].Address
-		})
+	accountsByChain := groupByChain(s.unfinished(s.selectAccounts(chainAccounts)))
+	logger.Debug("Grouped accounts into %d unique chains", len(accountsByChain))
+	return accountsByChain, nil
+}
 
-		for _, account := range accounts {
-			if err := s.GetAccountTransactions(account); err != nil {
-				if client.IsEndpointMissing(err) {
-					return stats, &ContractBreakError{
-						Step:     "EVM transaction fetch",
-						Endpoint: evmTransactionsEndpoint,
-						Err:      err,
-					}
-				}
-				stats.Failed++
-				logger.Error("Failed to get transactions for account %s on chain %s: %v",
-					account.Address, account.EvmChain, err)
-				continue
-			}
-			stats.Ok++
-		}
+// groupByChain groups accounts by the chain id transactions are fetched for.
+func groupByChain(accounts []models.ChainAccount) map[string][]models.ChainAccount {
+	accountsByChain := make(map[string][]models.ChainAccount)
+	for _, account := range accounts {
+		accountsByChain[account.Blockchain] = append(accountsByChain[account.Blockchain], account)
 	}
-
-	logger.Info("Completed EVM transaction fetch (%d ok / %d failed)", stats.Ok, stats.Failed)
-	return stats, nil
+	return accountsByChain
 }
 
 // GetAccountTransactions fetches transactions for a specific account through the
 // unified endpoint, using the chain id (e.g. "ethereum", "optimism") as the
 // account's blockchain — the same shape the non-EVM path and the desktop app
 // send.
-func (s *BlockchainService) GetAccountTransactions(account models.ChainAccount) error {
-	logger.Debug("Fetching transactions for %s (%s)", account.Blockchain, account.Address)
+func (s *BlockchainService) GetAccountTransactions(ctx context.Context, account models.ChainAccount) error {
+	return s.GetAccountsTransactions(ctx, []models.ChainAccount{account})
+}
+
+// GetAccountsTransactions fetches transactions for several accounts in a
+// single request; the unified endpoint accepts a list of accounts, so a batch
+// costs one async task instead of one per account. With an incremental window
+// only the time since the accounts' last successful fetch is queried.
+func (s *BlockchainService) GetAccountsTransactions(ctx context.Context, accounts []models.ChainAccount) error {
+	if len(accounts) == 0 {
+		return nil
+	}
 
+	keys := make([]string, len(accounts))
 	requestData := models.TransactionsRequest{
-		Accounts: []models.TransactionAccount{
-			{
-				Address:    account.Address,
-				Blockchain: account.Blockchain,
-			},
-		},
+		Accounts: make([]models.TransactionAccount, len(accounts)),
+	}
+	for i, account := range accounts {
+		keys[i] = account.Blockchain + " " + account.Address
+		requestData.Accounts[i] = models.TransactionAccount{
+			Address:    account.Address,
+			Blockchain: account.Blockchain,
+		}
+	}
+	requestData.FromTimestamp, requestData.ToTimestamp = s.window.bounds(state.KindAccount, keys...)
+
+	target := accounts[0].Address
+	if len(accounts) > 1 {
+		target = fmt.Sprintf("%d accounts", len(accounts))
+	}
+	if requestData.FromTimestamp > 0 {
+		logger.Debug("Fetching transactions for %s (%s) since %s", accounts[0].Blockchain, target,
+			time.Unix(requestData.FromTimestamp, 0).UTC().Format(time.RFC3339))
+	} else {
+		logger.Debug("Fetching transactions for %s (%s)", accounts[0].Blockchain, target)
 	}
 
 	// Use async for fetching transactions
-	response, err := async.Post[bool](s.asyncClient, evmTransactionsEndpoint, requestData)
+	response, err := async.PostContext[bool](ctx, s.asyncClient, evmTransactionsEndpoint, requestData)
 	if err != nil {
-		return fmt.Errorf("failed to fetch transactions for %s on chain %s: %w", account.Address, account.Blockchain, err)
+		return fmt.Errorf("failed to fetch transactions for %s on chain %s: %w", target, accounts[0].Blockchain, err)
 	}
 	if response == nil {
-		return fmt.Errorf("received nil response for transactions of %s on chain %s", account.Address, account.Blockchain)
+		return fmt.Errorf("received nil response for transactions of %s on chain %s", target, accounts[0].Blockchain)
 	}
 
+	s.window.done(state.KindAccount, keys...)
 	return nil
 }
 
@@ -217,53 +331,54 @@ const transactionsDecodeEndpoint = "/blockchains/transactions/decode"
 // DecodeEvmTransactions decodes EVM transactions for each supported chain
 // through the unified decode endpoint, one chain id per request. It returns
 // per-chain ok/failed counts; a removed endpoint (404) aborts with a
-// ContractBreakError.
-func (s *BlockchainService) DecodeEvmTransactions() (OpStats, error) {
+// ContractBreakError. Chains a rate-limited provider slows down wait for it
+// or come last (see SetRateLimits). Once ctx is done the remaining chains are
+// left undecoded and ctx's error is returned.
+func (s *BlockchainService) DecodeEvmTransactions(ctx context.Context) (OpStats, error) {
 	var stats OpStats
 
-	evmChains, err := s.GetSupportedEvmChains()
+	chainIDs, err := s.evmDecodeChains(ctx)
 	if err != nil {
-		return stats, fmt.Errorf("failed to get EVM chains: %w", err)
+		return stats, err
 	}
 
-	// Decode by chain id, skipping chains without an EVM chain name and
-	// excluded chains.
-	chainIDs := make([]string, 0)
-	for _, chain := range evmChains {
-		if chain.EvmChainName != "" && !isChainExcluded(chain.EvmChainName) {
-			chainIDs = append(chainIDs, chain.ID)
+	for pending := chainIDs; len(pending) > 0; pending = pending[1:] {
+		pending = orderByRateLimits(s.limits, pending, func(id string) string { return id })
+		chainID := pending[0]
+		if err := ctx.Err(); err != nil {
+			return stats, err
 		}
-	}
-
-	logger.Info("Found %d EVM chains for transaction decoding", len(chainIDs))
-
-	for _, chainID := range chainIDs {
+		s.limits.wait(ctx, chainID, "decoding chain "+chainID)
 		logger.Debug("Decoding transactions for chain %s", chainID)
 
 		requestData := models.TransactionDecodeRequest{
 			Chain: chainID,
 		}
 
-		response, err := async.Post[models.TransactionDecodeResult](s.asyncClient, transactionsDecodeEndpoint, requestData)
-		if err != nil {
-			if client.IsEndpointMissing(err) {
-				return stats, &ContractBreakError{
-					Step:     "EVM transaction decode",
-					Endpoint: transactionsDecodeEndpoint,
-					Err:      err,
-				}
+		start := time.Now()
+		task := s.limits.begin(chainID)
+		var response *models.APIResponse[models.TransactionDecodeResult]
+		err := retry(ctx, "Decoding transactions for chain "+chainID, func() (err error) {
+			response, err = async.PostContext[models.TransactionDecodeResult](ctx, s.asyncClient, transactionsDecodeEndpoint, requestData)
+			return err
+		})
+		s.limits.observe(task)
+		if client.IsEndpointMissing(err) {
+			return stats, &ContractBreakError{
+				Step:     "EVM transaction decode",
+				Endpoint: transactionsDecodeEndpoint,
+				Err:      err,
 			}
-			stats.Failed++
-			logger.Error("Failed to decode transactions for chain %s: %v", chainID, err)
-			continue
 		}
-		if response == nil {
-			stats.Failed++
-			logger.Error("Received nil response for decoding transactions on chain %s", chainID)
+		if err == nil && response == nil {
+			err = fmt.Errorf("received nil response for decoding transactions on chain %s", chainID)
+		}
+		s.record(&stats, chainID, start, err)
+		if err != nil {
+			logger.Error("Failed to decode transactions for chain %s: %v", chainID, err)
 			continue
 		}
 
-		stats.Ok++
 		if decoded := response.Result.DecodedTxNumber; decoded > 0 {
 			logger.Info("Decoded %d transactions for chain %s", decoded, chainID)
 		}
@@ -272,6 +387,25 @@ func (s *BlockchainService) DecodeEvmTransactions() (OpStats, error) {
 	return stats, nil
 }
 
+// evmDecodeChains returns the ids of the EVM chains to decode, skipping chains
+// without an EVM chain name and excluded chains.
+func (s *BlockchainService) evmDecodeChains(ctx context.Context) ([]string, error) {
+	evmChains, err := s.GetSupportedEvmChains(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get EVM chains: %w", err)
+	}
+
+	chainIDs := make([]string, 0)
+	for _, chain := range evmChains {
+		if chain.EvmChainName != "" && s.chainSelected(chain) && s.checkpoint.pending(chain.ID) {
+			chainIDs = append(chainIDs, chain.ID)
+		}
+	}
+
+	logger.Info("Found %d EVM chains for transaction decoding", len(chainIDs))
+	return chainIDs, nil
+}
+
 // TokenDetectionChain holds a chain's ID, name, and the addresses to detect tokens for
 type TokenDetectionChain struct {
 	ChainID   string
@@ -280,13 +414,13 @@ type TokenDetectionChain struct {
 }
 
 // GetTokenDetectionChains returns EVM chains with their addresses for token detection
-func (s *BlockchainService) GetTokenDetectionChains() ([]TokenDetectionChain, error) {
-	evmChains, err := s.GetSupportedEvmChains()
+func (s *BlockchainService) GetTokenDetectionChains(ctx context.Context) ([]TokenDetectionChain, error) {
+	evmChains, err := s.GetSupportedEvmChains(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get EVM chains for token detection: %w", err)
 	}
 
-	accounts, err := s.FetchAccountsForChains(evmChains)
+	accounts, err := s.FetchAccountsForChains(ctx, evmChains)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch accounts for token detection: %w", err)
 	}
@@ -297,11 +431,11 @@ func (s *BlockchainService) GetTokenDetectionChains() ([]TokenDetectionChain, er
 		chainInfo[chain.ID] = chain
 	}
 
-	// Group addresses by chain ID, skipping excluded chains
+	// Group addresses by chain ID, skipping excluded chains and accounts
 	addressesByChain := make(map[string][]string)
-	for _, acc := range accounts {
+	for _, acc := range s.selectAccounts(accounts) {
 		chain := chainInfo[acc.ChainID]
-		if chain.EvmChainName == "" || isChainExcluded(chain.EvmChainName) {
+		if chain.EvmChainName == "" {
 			continue
 		}
 		addressesByChain[acc.ChainID] = append(addressesByChain[acc.ChainID], acc.Address)
@@ -347,13 +481,13 @@ func (s *BlockchainService) ShouldSkipTokenDetection(info models.TokenDetectAddr
 }
 
 // DetectTokensForAddress runs token detection on a single chain for a single address
-func (s *BlockchainService) DetectTokensForAddress(chainID string, address string) error {
+func (s *BlockchainService) DetectTokensForAddress(ctx context.Context, chainID string, address string) error {
 	endpoint := fmt.Sprintf("/blockchains/%s/tokens/detect", chainID)
 	requestData := models.TokenDetectRequest{
 		Addresses: []string{address},
 	}
 
-	_, err := async.Post[json.RawMessage](s.asyncClient, endpoint, requestData)
+	_, err := async.PostContext[json.RawMessage](ctx, s.asyncClient, endpoint, requestData)
 	if err != nil {
 		return fmt.Errorf("failed to detect tokens for %s on %s: %w", address, chainID, err)
 	}
@@ -363,14 +497,14 @@ func (s *BlockchainService) DetectTokensForAddress(chainID string, address strin
 
 // GetCachedTokenDetection fetches cached token detection info for the given
 // addresses on a chain without triggering a fresh detection.
-func (s *BlockchainService) GetCachedTokenDetection(chainID string, addresses []string) (models.TokenDetectResponse, error) {
+func (s *BlockchainService) GetCachedTokenDetection(ctx context.Context, chainID string, addresses []string) (models.TokenDetectResponse, error) {
 	endpoint := fmt.Sprintf("/blockchains/%s/tokens/detect", chainID)
 	requestData := models.TokenDetectRequest{
 		Addresses: addresses,
 		OnlyCache: true,
 	}
 
-	resp, err := async.Post[models.TokenDetectResponse](s.asyncClient, endpoint, requestData)
+	resp, err := async.PostContext[models.TokenDetectResponse](ctx, s.asyncClient, endpoint, requestData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query cached token detection on %s: %w", chainID, err)
 	}
@@ -378,40 +512,41 @@ func (s *BlockchainService) GetCachedTokenDetection(chainID string, addresses []
 	return resp.Result, nil
 }
 
-// DetectTokens runs token detection on EVM chains (excluding avalanche).
+// DetectTokens runs token detection on EVM chains for the selected accounts.
 // Per-address detection is skipped when a cached detection younger than
-// tokenDetectionMaxAge exists.
-func (s *BlockchainService) DetectTokens() (OpStats, error) {
+// tokenDetectionMaxAge exists. Chains a rate-limited provider slows down wait
+// for it or come last (see SetRateLimits). Once ctx is done the remaining
+// addresses are skipped and ctx's error is returned.
+func (s *BlockchainService) DetectTokens(ctx context.Context) (OpStats, error) {
 	var stats OpStats
 
-	chains, err := s.GetTokenDetectionChains()
+	chains, err := s.GetTokenDetectionChains(ctx)
 	if err != nil {
 		return stats, err
 	}
 
-	for _, chain := range chains {
-		cached, err := s.GetCachedTokenDetection(chain.ChainID, chain.Addresses)
-		if err != nil {
-			logger.Error("Failed to query token detection cache on %s, will run detection: %v", chain.ChainName, err)
-			cached = nil
-		}
-
-		for _, address := range chain.Addresses {
-			if skip, age := shouldSkipTokenDetection(cached[address], time.Now(), tokenDetectionMaxAge); skip {
-				logger.Info("Skipping token detection for %s on %s: last detection %s ago (< %s)",
-					address, chain.ChainName, age.Round(time.Hour), tokenDetectionMaxAge)
-				continue
+	for pending := chains; len(pending) > 0; pending = pending[1:] {
+		pending = orderByRateLimits(s.limits, pending, func(chain TokenDetectionChain) string { return chain.ChainID })
+		chain := pending[0]
+		for _, address := range s.pendingTokenDetection(ctx, chain) {
+			if err := ctx.Err(); err != nil {
+				return stats, err
 			}
-
+			s.limits.wait(ctx, chain.ChainID, "token detection on "+chain.ChainName)
 			logger.Info("Detecting tokens for %s on %s", address, chain.ChainName)
 
-			if err := s.DetectTokensForAddress(chain.ChainID, address); err != nil {
-				stats.Failed++
+			start := time.Now()
+			task := s.limits.begin(chain.ChainID)
+			err := retry(ctx, "Detecting tokens for "+address+" on "+chain.ChainName, func() error {
+				return s.DetectTokensForAddress(ctx, chain.ChainID, address)
+			})
+			s.limits.observe(task)
+			s.record(&stats, chain.ChainID+" "+address, start, err)
+			if err != nil {
 				logger.Error("Failed to detect tokens for %s on %s: %v", address, chain.ChainName, err)
 				continue
 			}
 
-			stats.Ok++
 			logger.Info("Token detection completed for %s on %s", address, chain.ChainName)
 		}
 	}
@@ -419,103 +554,134 @@ func (s *BlockchainService) DetectTokens() (OpStats, error) {
 	return stats, nil
 }
 
-// FetchNonEvmTransactions fetches transactions for non-EVM chain types. It
-// returns per-account ok/failed counts; a removed endpoint (404) aborts with a
-// ContractBreakError.
-func (s *BlockchainService) FetchNonEvmTransactions() (OpStats, error) {
+// pendingTokenDetection returns the addresses of chain whose cached token
+// detection is missing or older than tokenDetectionMaxAge. The cache query
+// itself changes nothing; if it fails every address is returned.
+func (s *BlockchainService) pendingTokenDetection(ctx context.Context, chain TokenDetectionChain) []string {
+	cached, err := s.GetCachedTokenDetection(ctx, chain.ChainID, chain.Addresses)
+	if err != nil {
+		logger.Error("Failed to query token detection cache on %s, will run detection: %v", chain.ChainName, err)
+		cached = nil
+	}
+
+	pending := make([]string, 0, len(chain.Addresses))
+	for _, address := range chain.Addresses {
+		if !s.checkpoint.pending(chain.ChainID + " " + address) {
+			continue
+		}
+		if skip, age := shouldSkipTokenDetection(cached[address], time.Now(), tokenDetectionMaxAge); skip {
+			logger.Info("Skipping token detection for %s on %s: last detection %s ago (< %s)",
+				address, chain.ChainName, age.Round(time.Hour), tokenDetectionMaxAge)
+			continue
+		}
+		pending = append(pending, address)
+	}
+	return pending
+}
+
+// FetchNonEvmTransactions fetches transactions for non-EVM chain types, within
+// the same concurrency limits as the EVM fetch. It returns per-account
+// ok/failed counts; a removed endpoint (404) aborts with a
+// ContractBreakError. Once ctx is done the remaining chain types are skipped
+// and ctx's error is returned.
+func (s *BlockchainService) FetchNonEvmTransactions(ctx context.Context) (OpStats, error) {
 	var stats OpStats
 
 	for _, chainType := range nonEvmChainTypes {
-		chains, err := s.GetSupportedChainsByType(chainType)
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		accountsByChain, err := s.nonEvmFetchAccounts(ctx, chainType)
 		if err != nil {
-			logger.Error("Failed to get supported %s chains: %v", chainType, err)
+			logger.Error("%v", err)
 			continue
 		}
-
-		if len(chains) == 0 {
+		if len(accountsByChain) == 0 {
 			continue
 		}
 
-		accounts, err := s.FetchAccountsForChains(chains)
+		chainStats, err := s.fetchConcurrently(ctx, "non-EVM transaction fetch", accountsByChain, s.GetAccountsTransactions)
+		stats.add(chainStats)
 		if err != nil {
-			logger.Error("Failed to fetch accounts for %s chains: %v", chainType, err)
-			continue
+			return stats, err
 		}
 
-		logger.Info("Fetching %s transactions for %d accounts", chainType, len(accounts))
+		logger.Info("Completed %s transaction fetch", chainType)
+	}
 
-		for _, account := range accounts {
-			requestData := models.TransactionsRequest{
-				Accounts: []models.TransactionAccount{
-					{
-						Address:    account.Address,
-						Blockchain: account.Blockchain,
-					},
-				},
-			}
+	return stats, nil
+}
 
-			_, err := async.Post[bool](s.asyncClient, evmTransactionsEndpoint, requestData)
-			if err != nil {
-				if client.IsEndpointMissing(err) {
-					return stats, &ContractBreakError{
-						Step:     "non-EVM transaction fetch",
-						Endpoint: evmTransactionsEndpoint,
-						Err:      err,
-					}
-				}
-				stats.Failed++
-				logger.Error("Failed to fetch transactions for %s on %s: %v",
-					account.Address, account.Blockchain, err)
-				continue
-			}
-			stats.Ok++
-		}
+// nonEvmFetchAccounts returns the selected accounts of the chains of chainType,
+// grouped by chain id; nil when the type has no supported chains.
+func (s *BlockchainService) nonEvmFetchAccounts(ctx context.Context, chainType string) (map[string][]models.ChainAccount, error) {
+	chains, err := s.GetSupportedChainsByType(ctx, chainType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get supported %s chains: %w", chainType, err)
+	}
 
-		logger.Info("Completed %s transaction fetch", chainType)
+	if len(chains) == 0 {
+		return nil, nil
 	}
 
-	return stats, nil
+	accounts, err := s.FetchAccountsForChains(ctx, chains)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch accounts for %s chains: %w", chainType, err)
+	}
+
+	accounts = s.unfinished(s.selectAccounts(accounts))
+	logger.Info("Fetching %s transactions for %d accounts", chainType, len(accounts))
+	return groupByChain(accounts), nil
 }
 
 // DecodeNonEvmTransactions decodes transactions for non-EVM chain types that
 // support decoding. It returns per-chain ok/failed counts; a removed endpoint
-// (404) aborts with a ContractBreakError.
-func (s *BlockchainService) DecodeNonEvmTransactions() (OpStats, error) {
+// (404) aborts with a ContractBreakError. Chains a rate-limited provider slows
+// down wait for it or come last (see SetRateLimits). Once ctx is done the
+// remaining chains are left undecoded and ctx's error is returned.
+func (s *BlockchainService) DecodeNonEvmTransactions(ctx context.Context) (OpStats, error) {
 	var stats OpStats
 
-	for _, chainType := range nonEvmChainTypes {
-		if nonDecodableChainTypes[chainType] {
-			continue
-		}
-
-		chains, err := s.GetSupportedChainsByType(chainType)
+	for _, chainType := range decodableNonEvmChainTypes() {
+		chains, err := s.nonEvmDecodeChains(ctx, chainType)
 		if err != nil {
-			logger.Error("Failed to get supported %s chains for decoding: %v", chainType, err)
+			logger.Error("%v", err)
 			continue
 		}
 
-		for _, chain := range chains {
+		for pending := chains; len(pending) > 0; pending = pending[1:] {
+			pending = orderByRateLimits(s.limits, pending, func(chain models.Blockchain) string { return chain.ID })
+			chain := pending[0]
+			if err := ctx.Err(); err != nil {
+				return stats, err
+			}
+			s.limits.wait(ctx, chain.ID, "decoding chain "+chain.ID)
 			logger.Debug("Decoding %s transactions for chain %s", chainType, chain.ID)
 
 			requestData := models.TransactionDecodeRequest{
 				Chain: chain.ID,
 			}
 
-			_, err := async.Post[models.TransactionDecodeResult](s.asyncClient, transactionsDecodeEndpoint, requestData)
-			if err != nil {
-				if client.IsEndpointMissing(err) {
-					return stats, &ContractBreakError{
-						Step:     "non-EVM transaction decode",
-						Endpoint: transactionsDecodeEndpoint,
-						Err:      err,
-					}
+			start := time.Now()
+			task := s.limits.begin(chain.ID)
+			err := retry(ctx, "Decoding transactions for chain "+chain.ID, func() error {
+				_, err := async.PostContext[models.TransactionDecodeResult](ctx, s.asyncClient, transactionsDecodeEndpoint, requestData)
+				return err
+			})
+			s.limits.observe(task)
+			if client.IsEndpointMissing(err) {
+				return stats, &ContractBreakError{
+					Step:     "non-EVM transaction decode",
+					Endpoint: transactionsDecodeEndpoint,
+					Err:      err,
 				}
-				stats.Failed++
+			}
+			s.record(&stats, chain.ID, start, err)
+			if err != nil {
 				logger.Error("Failed to decode transactions for chain %s: %v", chain.ID, err)
 				continue
 			}
 
-			stats.Ok++
 			logger.Info("Decoded transactions for %s chain %s", chainType, chain.ID)
 		}
 	}
@@ -523,41 +689,55 @@ func (s *BlockchainService) DecodeNonEvmTransactions() (OpStats, error) {
 	return stats, nil
 }
 
+// decodableNonEvmChainTypes lists the non-EVM chain types that support
+// decoding.
+func decodableNonEvmChainTypes() []string {
+	types := make([]string, 0, len(nonEvmChainTypes))
+	for _, chainType := range nonEvmChainTypes {
+		if !nonDecodableChainTypes[chainType] {
+			types = append(types, chainType)
+		}
+	}
+	return types
+}
+
+// nonEvmDecodeChains returns the selected chains of chainType to decode.
+func (s *BlockchainService) nonEvmDecodeChains(ctx context.Context, chainType string) ([]models.Blockchain, error) {
+	chains, err := s.GetSupportedChainsByType(ctx, chainType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get supported %s chains for decoding: %w", chainType, err)
+	}
+
+	selected := make([]models.Blockchain, 0, len(chains))
+	for _, chain := range chains {
+		if s.chainSelected(chain) && s.checkpoint.pending(chain.ID) {
+			selected = append(selected, chain)
+		}
+	}
+	return selected, nil
+}
+
 // FetchOnlineEvents fetches online events. It returns per-query ok/failed
 // counts. Each query type is gated on whether its integration is set up:
 // gnosis_pay and monerium only when their credentials are configured, and the
 // eth2-specific queries (block_productions, eth_withdrawals) only when the eth2
 // module is active. Gating avoids a recurring per-run failure from querying an
-// integration the user has not enabled.
-func (s *BlockchainService) FetchOnlineEvents() (OpStats, error) {
+// integration the user has not enabled. Once ctx is done the remaining query
+// types are skipped and ctx's error is returned.
+func (s *BlockchainService) FetchOnlineEvents(ctx context.Context) (OpStats, error) {
 	logger.Info("Fetching online events")
 
 	var stats OpStats
 
-	// gnosis_pay and monerium are independent integrations, not part of eth2;
-	// include them only when configured.
-	queryTypes := make([]models.QueryType, 0, 4)
-	queryTypes = s.appendIfConfigured(queryTypes, "gnosis_pay", models.GnosisPayQuery, s.isGnosisPayConfigured)
-	queryTypes = s.appendIfConfigured(queryTypes, "monerium", models.MoneriumQuery, s.isMoneriumConfigured)
-
-	// Check if eth2 module is activated before adding its query types.
-	isEth2Active, err := s.IsEth2ModuleActive()
+	queryTypes, err := s.onlineEventQueries(ctx)
 	if err != nil {
-		logger.Error("Failed to check eth2 module status: %v", err)
-		return stats, fmt.Errorf("failed to check eth2 module status: %w", err)
-	}
-	if isEth2Active {
-		queryTypes = append(queryTypes, models.BlockProductionsQuery, models.EthWithdrawalsQuery)
-	} else {
-		logger.Info("Eth2 module is not active, skipping eth2 online events")
-	}
-
-	if len(queryTypes) == 0 {
-		logger.Info("No online-event integrations are configured; nothing to fetch")
-		return stats, nil
+		return stats, err
 	}
 
 	for _, queryType := range queryTypes {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
 		logger.Info("Fetching %s events", queryType)
 
 		requestData := models.EventsQueryPayload{
@@ -565,26 +745,28 @@ func (s *BlockchainService) FetchOnlineEvents() (OpStats, error) {
 		}
 
 		// Use async for fetching history events
-		response, err := async.Post[bool](s.asyncClient, "/history/events/query", requestData)
-		if err != nil {
-			if client.IsEndpointMissing(err) {
-				return stats, &ContractBreakError{
-					Step:     "online events fetch",
-					Endpoint: "/history/events/query",
-					Err:      err,
-				}
+		start := time.Now()
+		var response *models.APIResponse[bool]
+		err := retry(ctx, "Fetching "+string(queryType)+" events", func() (err error) {
+			response, err = async.PostContext[bool](ctx, s.asyncClient, "/history/events/query", requestData)
+			return err
+		})
+		if client.IsEndpointMissing(err) {
+			return stats, &ContractBreakError{
+				Step:     "online events fetch",
+				Endpoint: "/history/events/query",
+				Err:      err,
 			}
-			stats.Failed++
-			logger.Error("Failed to fetch %s events: %v", queryType, err)
-			continue
 		}
-		if response == nil {
-			stats.Failed++
-			logger.Error("Received nil response for %s events", queryType)
+		if err == nil && response == nil {
+			err = fmt.Errorf("received nil response for %s events", queryType)
+		}
+		s.record(&stats, string(queryType), start, err)
+		if err != nil {
+			logger.Error("Failed to fetch %s events: %v", queryType, err)
 			continue
 		}
 
-		stats.Ok++
 		if response.Result {
 			logger.Info("Successfully fetched %s events", queryType)
 		}
@@ -593,17 +775,47 @@ func (s *BlockchainService) FetchOnlineEvents() (OpStats, error) {
 	return stats, nil
 }
 
+// onlineEventQueries returns the online-event query types whose integration
+// is set up.
+func (s *BlockchainService) onlineEventQueries(ctx context.Context) ([]models.QueryType, error) {
+	// gnosis_pay and monerium are independent integrations, not part of eth2;
+	// include them only when configured.
+	queryTypes := make([]models.QueryType, 0, 4)
+	queryTypes = s.appendIfConfigured(ctx, queryTypes, "gnosis_pay", models.GnosisPayQuery, s.isGnosisPayConfigured)
+	queryTypes = s.appendIfConfigured(ctx, queryTypes, "monerium", models.MoneriumQuery, s.isMoneriumConfigured)
+
+	// Check if eth2 module is activated before adding its query types.
+	isEth2Active, err := s.IsEth2ModuleActive(ctx)
+	if err != nil {
+		logger.Error("Failed to check eth2 module status: %v", err)
+		return nil, fmt.Errorf("failed to check eth2 module status: %w", err)
+	}
+	if isEth2Active {
+		queryTypes = append(queryTypes, models.BlockProductionsQuery, models.EthWithdrawalsQuery)
+	} else {
+		logger.Info("Eth2 module is not active, skipping eth2 online events")
+	}
+
+	if len(queryTypes) == 0 {
+		logger.Info("No online-event integrations are configured; nothing to fetch")
+	}
+	return slices.DeleteFunc(queryTypes, func(query models.QueryType) bool {
+		return !s.checkpoint.pending(string(query))
+	}), nil
+}
+
 // appendIfConfigured adds query to queryTypes when check reports the integration
 // named name as configured. If the check itself fails the query is still added
 // (fail-loud: a transient status-check error must not silently drop a
 // configured integration); when not configured it is skipped with an info log.
 func (s *BlockchainService) appendIfConfigured(
+	ctx context.Context,
 	queryTypes []models.QueryType,
 	name string,
 	query models.QueryType,
-	check func() (bool, error),
+	check func(context.Context) (bool, error),
 ) []models.QueryType {
-	configured, err := check()
+	configured, err := check(ctx)
 	if err != nil {
 		logger.Debug("Could not determine %s status, attempting anyway: %v", name, err)
 		return append(queryTypes, query)
@@ -617,9 +829,9 @@ func (s *BlockchainService) appendIfConfigured(
 
 // isMoneriumConfigured reports whether Monerium OAuth credentials are present,
 // via GET /services/monerium ({"result": {"authenticated": bool}}).
-func (s *BlockchainService) isMoneriumConfigured() (bool, error) {
+func (s *BlockchainService) isMoneriumConfigured(ctx context.Context) (bool, error) {
 	var response map[string]interface{}
-	if err := s.client.GetQuiet("/services/monerium", &response); err != nil {
+	if err := s.client.GetQuietContext(ctx, "/services/monerium", &response); err != nil {
 		if client.IsUnavailable(err) {
 			// Subscription tier gates Monerium off entirely (403/402). That is a
 			// definitive "not configured", not a transient error — skip quietly.
@@ -639,9 +851,9 @@ func (s *BlockchainService) isMoneriumConfigured() (bool, error) {
 // isGnosisPayConfigured reports whether Gnosis Pay credentials are present. The
 // GET /external_services result is a map keyed by configured service name, so
 // the presence of a "gnosis_pay" key means credentials are stored.
-func (s *BlockchainService) isGnosisPayConfigured() (bool, error) {
+func (s *BlockchainService) isGnosisPayConfigured(ctx context.Context) (bool, error) {
 	var response map[string]interface{}
-	if err := s.client.GetQuiet("/external_services", &response); err != nil {
+	if err := s.client.GetQuietContext(ctx, "/external_services", &response); err != nil {
 		if client.IsUnavailable(err) {
 			// Not available for this subscription tier (403/402) — treat as a
 			// definitive "not configured" and skip quietly.
@@ -661,11 +873,11 @@ func (s *BlockchainService) isGnosisPayConfigured() (bool, error) {
 // Balance-related methods
 
 // FetchExchangeRate fetches exchange rate for a currency
-func (s *BlockchainService) FetchExchangeRate(currency string) (float64, error) {
+func (s *BlockchainService) FetchExchangeRate(ctx context.Context, currency string) (float64, error) {
 	endpoint := fmt.Sprintf("/exchange_rates?currencies=%s", currency)
 	var response map[string]interface{}
 
-	if err := s.client.Get(endpoint, &response); err != nil {
+	if err := s.client.GetContext(ctx, endpoint, &response); err != nil {
 		return 0, fmt.Errorf("failed to fetch exchange rate for %s: %w", currency, err)
 	}
 
@@ -702,9 +914,9 @@ func (s *BlockchainService) FetchExchangeRate(currency string) (float64, error)
 }
 
 // GetLastBalanceSave gets the timestamp of the last balance save
-func (s *BlockchainService) GetLastBalanceSave() (int64, error) {
+func (s *BlockchainService) GetLastBalanceSave(ctx context.Context) (int64, error) {
 	var response map[string]interface{}
-	if err := s.client.Get("/periodic", &response); err != nil {
+	if err := s.client.GetContext(ctx, "/periodic", &response); err != nil {
 		return 0, fmt.Errorf("failed to get last balance save: %w", err)
 	}
 
@@ -722,9 +934,9 @@ func (s *BlockchainService) GetLastBalanceSave() (int64, error) {
 }
 
 // GetBalanceSaveFrequency gets the balance save frequency setting
-func (s *BlockchainService) GetBalanceSaveFrequency() (int, error) {
+func (s *BlockchainService) GetBalanceSaveFrequency(ctx context.Context) (int, error) {
 	var response map[string]interface{}
-	if err := s.client.Get("/settings", &response); err != nil {
+	if err := s.client.GetContext(ctx, "/settings", &response); err != nil {
 		return 0, fmt.Errorf("failed to get settings: %w", err)
 	}
 
@@ -742,9 +954,9 @@ func (s *BlockchainService) GetBalanceSaveFrequency() (int, error) {
 }
 
 // IsEth2ModuleActive checks if the eth2 module is active in settings
-func (s *BlockchainService) IsEth2ModuleActive() (bool, error) {
+func (s *BlockchainService) IsEth2ModuleActive(ctx context.Context) (bool, error) {
 	var response map[string]interface{}
-	if err := s.client.Get("/settings", &response); err != nil {
+	if err := s.client.GetContext(ctx, "/settings", &response); err != nil {
 		return false, fmt.Errorf("failed to get settings: %w", err)
 	}
 
@@ -768,17 +980,25 @@ func (s *BlockchainService) IsEth2ModuleActive() (bool, error) {
 	return false, nil
 }
 
-// TakeBalanceSnapshot takes a balance snapshot
-func (s *BlockchainService) TakeBalanceSnapshot(forceSnapshot bool) error {
-	query := ""
-	if forceSnapshot {
-		query = "?save_data=true"
+// balancesEndpoint is the balance query route; with saveData the balances are
+// also saved as a snapshot.
+func balancesEndpoint(saveData bool) string {
+	if saveData {
+		return "/balances?save_data=true"
 	}
+	return "/balances"
+}
 
-	endpoint := fmt.Sprintf("/balances%s", query)
+// TakeBalanceSnapshot takes a balance snapshot
+func (s *BlockchainService) TakeBalanceSnapshot(ctx context.Context, forceSnapshot bool) error {
+	endpoint := balancesEndpoint(forceSnapshot)
 
 	// Use async for balance snapshot
-	response, err := async.Get[map[string]interface{}](s.asyncClient, endpoint)
+	var response *models.APIResponse[map[string]interface{}]
+	err := retry(ctx, "Querying balances", func() (err error) {
+		response, err = async.GetContext[map[string]interface{}](ctx, s.asyncClient, endpoint)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to take balance snapshot: %w", err)
 	}
@@ -787,7 +1007,7 @@ func (s *BlockchainService) TakeBalanceSnapshot(forceSnapshot bool) error {
 	}
 
 	// Fetch EUR exchange rate
-	euroRate, err := s.FetchExchangeRate("EUR")
+	euroRate, err := s.FetchExchangeRate(ctx, "EUR")
 	if err != nil {
 		logger.Error("Failed to fetch EUR exchange rate: %v", err)
 	} else {
@@ -799,15 +1019,35 @@ func (s *BlockchainService) TakeBalanceSnapshot(forceSnapshot bool) error {
 }
 
 // PerformSnapshotIfNeeded performs a balance snapshot if enough time has elapsed
-func (s *BlockchainService) PerformSnapshotIfNeeded() error {
-	lastBalanceSave, err := s.GetLastBalanceSave()
+func (s *BlockchainService) PerformSnapshotIfNeeded(ctx context.Context) error {
+	due, forceSnapshot, err := s.snapshotDue(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get last balance save: %w", err)
+		return err
+	}
+
+	if due {
+		if err := s.TakeBalanceSnapshot(ctx, forceSnapshot); err != nil {
+			return fmt.Errorf("failed to take balance snapshot: %w", err)
+		}
+		logger.Info("Balance snapshot completed")
+	} else {
+		logger.Info("Skipping balance snapshot - not enough time elapsed")
 	}
 
-	balanceSaveFrequency, err := s.GetBalanceSaveFrequency()
+	return nil
+}
+
+// snapshotDue reports whether enough time has elapsed since the last balance
+// save for a snapshot, and whether it must be forced with save_data.
+func (s *BlockchainService) snapshotDue(ctx context.Context) (due, forceSnapshot bool, err error) {
+	lastBalanceSave, err := s.GetLastBalanceSave(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get balance save frequency: %w", err)
+		return false, false, fmt.Errorf("failed to get last balance save: %w", err)
+	}
+
+	balanceSaveFrequency, err := s.GetBalanceSaveFrequency(ctx)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to get balance save frequency: %w", err)
 	}
 
 	currentTime := time.Now().Unix()
@@ -819,14 +1059,5 @@ func (s *BlockchainService) PerformSnapshotIfNeeded() error {
 
 	logger.Info("Time since last balance save: %d seconds (required: %d)", timeSinceLastSave, requiredInterval)
 
-	if enoughTimeElapsed {
-		if err := s.TakeBalanceSnapshot(enoughTimeElapsed && !requiredTimeElapsed); err != nil {
-			return fmt.Errorf("failed to take balance snapshot: %w", err)
-		}
-		logger.Info("Balance snapshot completed")
-	} else {
-		logger.Info("Skipping balance snapshot - not enough time elapsed")
-	}
-
-	return nil
+	return enoughTimeElapsed, enoughTimeElapsed && !requiredTimeElapsed, nil
 }
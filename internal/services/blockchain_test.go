@@ -1,9 +1,14 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/kelsos/rotki-sync/internal/config"
 	"github.com/kelsos/rotki-sync/internal/models"
 )
 
@@ -64,3 +69,62 @@ func TestShouldSkipTokenDetection(t *testing.T) {
 		})
 	}
 }
+
+func TestSelectAccounts(t *testing.T) {
+	cold := "cold storage"
+	accounts := []models.ChainAccount{
+		{ChainID: "eth", EvmChain: "ethereum", ChainType: models.ChainTypeEvm, Address: "0xa", Label: &cold},
+		{ChainID: "eth", EvmChain: "ethereum", ChainType: models.ChainTypeEvm, Address: "0xb", Tags: []string{"skip"}},
+		{ChainID: "avax", EvmChain: "avalanche", ChainType: models.ChainTypeEvm, Address: "0xc"},
+		{ChainID: "optimism", EvmChain: "optimism", ChainType: models.ChainTypeEvm, Address: "0xd"},
+	}
+
+	s := &BlockchainService{}
+	s.SetAccountRules(config.AccountRules{
+		Exclude: []config.AccountRule{{Label: "cold*"}, {Tag: "skip"}},
+	})
+
+	got := s.selectAccounts(accounts)
+	if len(got) != 1 || got[0].Address != "0xd" {
+		t.Errorf("selectAccounts kept %+v, want only 0xd (avalanche is always excluded)", got)
+	}
+
+	if s.chainSelected(models.Blockchain{ID: "avax", EvmChainName: "avalanche", Type: models.ChainTypeEvm}) {
+		t.Error("avalanche should never be decoded")
+	}
+	if !s.chainSelected(models.Blockchain{ID: "eth", EvmChainName: "ethereum", Type: models.ChainTypeEvm}) {
+		t.Error("account-level exclusions must not drop the whole chain")
+	}
+}
+
+func TestSnapshotCheckHonorsContext(t *testing.T) {
+	t.Setenv("ROTKI_SYNC_HOME", t.TempDir())
+	requested := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	svc := NewSyncService(&config.Config{BaseURL: server.URL})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-requested
+		cancel()
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := svc.blockchain.snapshotDue(ctx)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("snapshotDue = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("snapshotDue did not return after its context was canceled")
+	}
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/logger"
+	"github.com/kelsos/rotki-sync/internal/models"
+)
+
+// EventDocument is the machine-readable form of an Event: one line of the
+// NDJSON event stream (see NewEventWriter). Sections that do not apply to the
+// event's kind are left out.
+type EventDocument struct {
+	Event EventKind `json:"event"`
+	Time  time.Time `json:"time"`
+	User  string    `json:"user,omitempty"`
+	// Step is the step the event belongs to; nil for logins, logouts and the
+	// tasks of a login.
+	Step *EventStepDocument `json:"step,omitempty"`
+	// Item is the attempted item of an item event.
+	Item *TimingDocument `json:"item,omitempty"`
+	// Task is the async task of a task or heartbeat event.
+	Task *TaskDocument `json:"task,omitempty"`
+	// Report is the outcome of a step_finish event.
+	Report *StepDocument `json:"report,omitempty"`
+	// Status is the outcome of a logout event: ok, failed, timed_out or
+	// interrupted; empty when the login failed.
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// EventStepDocument names the step of an EventDocument and its zero-based
+// position among the pipeline's steps.
+type EventStepDocument struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Index int    `json:"index"`
+	Count int    `json:"count"`
+}
+
+// TaskDocument is the async task of an EventDocument.
+type TaskDocument struct {
+	ID             models.TaskID `json:"id"`
+	Method         string        `json:"method,omitempty"`
+	Endpoint       string        `json:"endpoint"`
+	ElapsedSeconds float64       `json:"elapsed_seconds,omitempty"`
+	Failed         bool          `json:"failed,omitempty"`
+	TimedOut       bool          `json:"timed_out,omitempty"`
+	Progress       string        `json:"progress,omitempty"`
+}
+
+// Document converts the event into its JSON form.
+func (e Event) Document() EventDocument {
+	doc := EventDocument{Event: e.Kind, Time: e.Time, User: e.Username}
+	if e.StepID != "" {
+		doc.Step = &EventStepDocument{ID: e.StepID, Name: e.Step, Index: e.StepIndex, Count: e.StepCount}
+	}
+	if e.Err != nil {
+		doc.Error = e.Err.Error()
+	}
+
+	switch e.Kind {
+	case EventItem:
+		doc.Item = &TimingDocument{
+			Name: e.Item.Name, DurationSeconds: seconds(e.Item.Duration), Failed: e.Item.Failed, TimedOut: e.Item.TimedOut,
+		}
+	case EventTaskStart, EventTaskFinish, EventHeartbeat:
+		doc.Task = &TaskDocument{
+			ID: e.Task.ID, Method: e.Task.Method, Endpoint: e.Task.Endpoint,
+			ElapsedSeconds: seconds(e.Task.Elapsed), Failed: e.Task.Failed, TimedOut: e.Task.TimedOut,
+			Progress: e.Task.Progress,
+		}
+	case EventStepFinish:
+		if e.StepReport != nil {
+			report := e.StepReport.document()
+			doc.Report = &report
+		}
+	case EventLogout:
+		doc.Status = userStatus(e.User)
+	}
+	return doc
+}
+
+// userStatus is the outcome of a user's processing for a logout event; empty
+// when the login failed.
+func userStatus(user *UserReport) string {
+	switch {
+	case user == nil:
+		return ""
+	case user.Failed():
+		return StatusFailed
+	case user.Interrupted:
+		return StatusInterrupted
+	case user.HasTimeouts():
+		return StatusTimedOut
+	default:
+		return StatusOK
+	}
+}
+
+// eventBufferSize is how many events an event writer holds for a reader that
+// falls behind before it drops new ones.
+const eventBufferSize = 1024
+
+// eventFlushTimeout bounds how long closing an event writer waits for the
+// buffered events to be written.
+const eventFlushTimeout = 5 * time.Second
+
+// NewEventWriter returns an Observer that writes each event to w as one line
+// of JSON (NDJSON), for tools that drive rotki-sync, and a function that
+// writes the buffered events and stops. Events are written from a goroutine of
+// their own, so a slow or stalled reader never holds up the sync: once
+// eventBufferSize events wait, new ones are dropped with a warning. Once a
+// write fails, e.g. because the reader of a socket went away, the remaining
+// events are dropped and the run carries on.
+func NewEventWriter(w io.Writer) (Observer, func()) {
+	docs := make(chan EventDocument, eventBufferSize)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		enc := json.NewEncoder(w)
+		failed := false
+		for doc := range docs {
+			if failed {
+				continue
+			}
+			if err := enc.Encode(doc); err != nil {
+				failed = true
+				logger.Warn("Stopped writing the event stream: %v", err)
+			}
+		}
+	}()
+
+	var (
+		mu      sync.Mutex
+		closed  bool
+		dropped int
+	)
+	observer := func(event Event) {
+		doc := event.Document()
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case docs <- doc:
+		default:
+			if dropped == 0 {
+				logger.Warn("The event stream reader is falling behind; dropping events")
+			}
+			dropped++
+		}
+	}
+	stop := func() {
+		mu.Lock()
+		if closed {
+			mu.Unlock()
+			return
+		}
+		closed = true
+		close(docs)
+		mu.Unlock()
+
+		if dropped > 0 {
+			logger.Warn("Dropped %d event(s) the event stream reader did not keep up with", dropped)
+		}
+		select {
+		case <-done:
+		case <-time.After(eventFlushTimeout):
+			logger.Warn("Gave up writing the event stream after %s", eventFlushTimeout)
+		}
+	}
+	return observer, stop
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/async"
+)
+
+func TestEventWriter(t *testing.T) {
+	var out bytes.Buffer
+	bus := &eventBus{}
+	observer, stop := NewEventWriter(&out)
+	bus.subscribe(observer)
+	tasks := taskEvents{bus: bus}
+
+	bus.emit(Event{Kind: EventLogin, Username: "alice"})
+	bus.enter("alice", pipelineStep{id: StepEvmDecode, name: "EVM transaction decode"}, 6, 8)
+	bus.emit(Event{Kind: EventStepStart})
+	tasks.TaskStarted(7, "POST", "/blockchains/transactions/decode")
+	tasks.TaskHeartbeat(7, "/blockchains/transactions/decode", 30*time.Second, "decoding ethereum 250/1000 — coingecko rate-limited")
+	tasks.TaskFinished(async.TaskTiming{ID: 7, Method: "POST", Endpoint: "/blockchains/transactions/decode", Duration: 45 * time.Second}, nil)
+	bus.item(ItemTiming{Name: "1", Duration: 45 * time.Second}, nil)
+	step := StepReport{ID: StepEvmDecode, Step: "EVM transaction decode", Core: true, Stats: OpStats{Ok: 1}, Duration: time.Minute}
+	bus.emit(Event{Kind: EventStepFinish, StepReport: &step})
+	user := UserReport{Username: "alice", Steps: []StepReport{step}}
+	bus.emit(Event{Kind: EventLogout, Username: "alice", User: &user})
+	bus.emit(Event{Kind: EventLogin, Username: "bob", Err: errors.New("no stored password")})
+	stop()
+
+	var docs []EventDocument
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var doc EventDocument
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		docs = append(docs, doc)
+	}
+
+	var kinds []EventKind
+	for _, doc := range docs {
+		kinds = append(kinds, doc.Event)
+		if doc.Time.IsZero() {
+			t.Errorf("%s event has no time", doc.Event)
+		}
+	}
+	want := []EventKind{EventLogin, EventStepStart, EventTaskStart, EventHeartbeat, EventTaskFinish,
+		EventItem, EventStepFinish, EventLogout, EventLogin}
+	if len(kinds) != len(want) {
+		t.Fatalf("events = %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("events = %v, want %v", kinds, want)
+		}
+	}
+
+	if docs[0].Step != nil || docs[0].User != "alice" {
+		t.Errorf("login = %+v, want alice without a step", docs[0])
+	}
+	if s := docs[1].Step; s == nil || s.ID != StepEvmDecode || s.Index != 6 || s.Count != 8 {
+		t.Errorf("step_start step = %+v", s)
+	}
+	if task := docs[2].Task; task == nil || task.ID != 7 || task.Method != "POST" || task.Endpoint != "/blockchains/transactions/decode" {
+		t.Errorf("task_start task = %+v", task)
+	}
+	if task := docs[3].Task; task == nil || task.ElapsedSeconds != 30 || task.Progress != "decoding ethereum 250/1000 — coingecko rate-limited" {
+		t.Errorf("heartbeat task = %+v", task)
+	}
+	if task := docs[4].Task; task == nil || task.ElapsedSeconds != 45 || task.Failed {
+		t.Errorf("task_finish task = %+v", task)
+	}
+	if item := docs[5].Item; item == nil || item.Name != "1" || item.DurationSeconds != 45 {
+		t.Errorf("item = %+v", item)
+	}
+	if report := docs[6].Report; report == nil || report.Status != StatusOK || report.Ok != 1 {
+		t.Errorf("step_finish report = %+v", report)
+	}
+	if docs[7].Status != StatusOK || docs[7].Step != nil {
+		t.Errorf("logout = %+v, want status ok without a step", docs[7])
+	}
+	if docs[8].User != "bob" || docs[8].Error != "no stored password" {
+		t.Errorf("failed login = %+v", docs[8])
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{ writes int }
+
+func (w *failingWriter) Write([]byte) (int, error) {
+	w.writes++
+	return 0, errors.New("broken pipe")
+}
+
+func TestEventWriterStopsAfterWriteError(t *testing.T) {
+	w := &failingWriter{}
+	observer, stop := NewEventWriter(w)
+	observer(Event{Kind: EventLogin, Username: "alice"})
+	observer(Event{Kind: EventLogout, Username: "alice"})
+	stop()
+	if w.writes != 1 {
+		t.Errorf("writes = %d, want 1: no writes after the first failure", w.writes)
+	}
+}
+
+// stalledWriter blocks every write until release is closed.
+type stalledWriter struct {
+	release chan struct{}
+	lines   atomic.Int32
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.lines.Add(1)
+	return len(p), nil
+}
+
+func TestEventWriterDoesNotBlockOnStalledReader(t *testing.T) {
+	w := &stalledWriter{release: make(chan struct{})}
+	observer, stop := NewEventWriter(w)
+
+	emitted := make(chan struct{})
+	go func() {
+		for range eventBufferSize + 100 {
+			observer(Event{Kind: EventHeartbeat})
+		}
+		close(emitted)
+	}()
+	select {
+	case <-emitted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("emitting blocked on a stalled reader")
+	}
+
+	close(w.release)
+	stop()
+	// One event may have been taken off the buffer before it filled up.
+	if n := w.lines.Load(); n < eventBufferSize || n > eventBufferSize+1 {
+		t.Errorf("wrote %d events, want the %d buffered ones", n, eventBufferSize)
+	}
+	observer(Event{Kind: EventHeartbeat})
+}
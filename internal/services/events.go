@@ -0,0 +1,158 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/async"
+	"github.com/kelsos/rotki-sync/internal/models"
+)
+
+// EventKind identifies what a sync Event reports.
+type EventKind string
+
+const (
+	// EventLogin is a login attempt; Err is set when it failed.
+	EventLogin EventKind = "login"
+	// EventLogout marks the end of a user's processing; User carries the
+	// user's report (nil when the login failed).
+	EventLogout EventKind = "logout"
+	// EventStepStart is a pipeline step about to run.
+	EventStepStart EventKind = "step_start"
+	// EventStepFinish is a pipeline step that ran or was skipped; StepReport
+	// carries its outcome.
+	EventStepFinish EventKind = "step_finish"
+	// EventItem is one item (account, chain, query) a looping step attempted.
+	EventItem EventKind = "item"
+	// EventTaskStart is an async task rotki-core accepted; Task describes it.
+	EventTaskStart EventKind = "task_start"
+	// EventTaskFinish is an async task whose wait ended; Task describes it
+	// and Err is set when it failed or timed out.
+	EventTaskFinish EventKind = "task_finish"
+	// EventHeartbeat is a task still running after a while; Task carries how
+	// long it ran and what rotki-core reports it is doing.
+	EventHeartbeat EventKind = "heartbeat"
+)
+
+// Event is a structured progress notification from a sync run. The TUI, logs
+// and other front ends subscribe to the same stream, so every front end sees
+// the same steps in the same order.
+type Event struct {
+	Kind     EventKind
+	Time     time.Time
+	Username string
+	// StepID and Step name the step the event belongs to; StepIndex is its
+	// zero-based position among StepCount pipeline steps.
+	StepID    string
+	Step      string
+	StepIndex int
+	StepCount int
+	// Item is the attempted item of an EventItem.
+	Item ItemTiming
+	// Task is the async task of an EventTaskStart, EventTaskFinish or
+	// EventHeartbeat.
+	Task TaskInfo
+	Err  error
+
+	StepReport *StepReport
+	User       *UserReport
+}
+
+// TaskInfo describes the async task of a task event.
+type TaskInfo struct {
+	ID       models.TaskID
+	Method   string
+	Endpoint string
+	// Elapsed is how long the task ran so far (heartbeat) or took (finish).
+	Elapsed  time.Duration
+	Failed   bool
+	TimedOut bool
+	// Progress is what rotki-core reports the task is doing at a heartbeat
+	// (see progress.Tracker.Snapshot), e.g. "decoding ethereum 250/1000".
+	Progress string
+}
+
+// Observer receives sync events. It is called synchronously from the sync, one
+// event at a time even when items run concurrently, so it must not block.
+type Observer func(Event)
+
+// eventBus fans events out to the subscribed observers. It remembers the user
+// and step in progress so events from the services below (e.g. per-item
+// results) are attributed without threading them through every call. A nil
+// bus drops every event.
+type eventBus struct {
+	mu        sync.RWMutex
+	observers []Observer
+	current   Event
+	// deliver serializes delivery so observers need no locking of their own.
+	deliver sync.Mutex
+}
+
+func (b *eventBus) subscribe(observer Observer) {
+	b.mu.Lock()
+	b.observers = append(b.observers, observer)
+	b.mu.Unlock()
+}
+
+// enter sets the user and step that subsequent events belong to. An empty
+// step id clears the step.
+func (b *eventBus) enter(username string, step pipelineStep, index, count int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.current = Event{Username: username, StepID: step.id, Step: step.name, StepIndex: index, StepCount: count}
+	b.mu.Unlock()
+}
+
+// emit stamps event with the time and the current user/step (where the event
+// leaves them unset) and delivers it to every observer.
+func (b *eventBus) emit(event Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	observers := b.observers
+	current := b.current
+	b.mu.RUnlock()
+
+	event.Time = time.Now().UTC()
+	if event.Username == "" {
+		event.Username = current.Username
+	}
+	if event.StepID == "" && event.Kind != EventLogin && event.Kind != EventLogout {
+		event.StepID, event.Step = current.StepID, current.Step
+		event.StepIndex, event.StepCount = current.StepIndex, current.StepCount
+	}
+	b.deliver.Lock()
+	defer b.deliver.Unlock()
+	for _, observer := range observers {
+		observer(event)
+	}
+}
+
+// item publishes the result of one attempted item of the current step.
+func (b *eventBus) item(timing ItemTiming, err error) {
+	b.emit(Event{Kind: EventItem, Item: timing, Err: err})
+}
+
+// taskEvents publishes the async tasks of the TaskManager it observes (see
+// async.TaskObserver) on bus, attributed to the current user and step.
+type taskEvents struct {
+	bus *eventBus
+}
+
+func (t taskEvents) TaskStarted(taskID models.TaskID, method, endpoint string) {
+	t.bus.emit(Event{Kind: EventTaskStart, Task: TaskInfo{ID: taskID, Method: method, Endpoint: endpoint}})
+}
+
+func (t taskEvents) TaskHeartbeat(taskID models.TaskID, endpoint string, elapsed time.Duration, annotation string) {
+	t.bus.emit(Event{Kind: EventHeartbeat, Task: TaskInfo{ID: taskID, Endpoint: endpoint, Elapsed: elapsed, Progress: annotation}})
+}
+
+func (t taskEvents) TaskFinished(timing async.TaskTiming, err error) {
+	t.bus.emit(Event{Kind: EventTaskFinish, Err: err, Task: TaskInfo{
+		ID: timing.ID, Method: timing.Method, Endpoint: timing.Endpoint,
+		Elapsed: timing.Duration, Failed: timing.Failed, TimedOut: timing.TimedOut,
+	}})
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEventBusAttributesEvents(t *testing.T) {
+	var got []Event
+	bus := &eventBus{}
+	bus.subscribe(func(e Event) { got = append(got, e) })
+
+	bus.emit(Event{Kind: EventLogin, Username: "alice"})
+	bus.enter("alice", pipelineStep{id: StepEvmFetch, name: "EVM transaction fetch"}, 4, 8)
+	bus.emit(Event{Kind: EventStepStart})
+	bus.item(ItemTiming{Name: "ethereum 0xabc", Failed: true}, errors.New("boom"))
+	bus.emit(Event{Kind: EventLogout, Username: "alice"})
+
+	if len(got) != 4 {
+		t.Fatalf("got %d events, want 4", len(got))
+	}
+	if got[0].StepID != "" {
+		t.Errorf("login event should carry no step, got %q", got[0].StepID)
+	}
+	for _, e := range got[1:3] {
+		if e.Username != "alice" || e.StepID != StepEvmFetch || e.StepIndex != 4 || e.StepCount != 8 {
+			t.Errorf("%s event not attributed to the current step: %+v", e.Kind, e)
+		}
+	}
+	if got[2].Kind != EventItem || got[2].Item.Name != "ethereum 0xabc" || got[2].Err == nil {
+		t.Errorf("item event = %+v", got[2])
+	}
+	if got[3].StepID != "" {
+		t.Errorf("logout event should carry no step, got %q", got[3].StepID)
+	}
+	for _, e := range got {
+		if e.Time.IsZero() {
+			t.Errorf("%s event has no time", e.Kind)
+		}
+	}
+}
+
+func TestNilEventBusDropsEvents(t *testing.T) {
+	var bus *eventBus
+	bus.enter("alice", pipelineStep{id: StepSnapshot}, 0, 1)
+	bus.item(ItemTiming{Name: "x"}, nil)
+}
@@ -1,18 +1,22 @@
 package services
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/kelsos/rotki-sync/internal/async"
 	"github.com/kelsos/rotki-sync/internal/client"
 	"github.com/kelsos/rotki-sync/internal/logger"
 	"github.com/kelsos/rotki-sync/internal/models"
+	"github.com/kelsos/rotki-sync/internal/state"
 )
 
 // ExchangeService handles exchange-related operations
 type ExchangeService struct {
 	client      *client.APIClient
 	asyncClient *async.Client
+	// window limits history queries to what is new; nil queries everything.
+	window *fetchWindow
 }
 
 // NewExchangeServiceWithAsyncClient creates a new exchange service with an async client
@@ -24,9 +28,9 @@ func NewExchangeServiceWithAsyncClient(client *client.APIClient, asyncClient *as
 }
 
 // GetConnectedExchanges retrieves all connected exchanges
-func (s *ExchangeService) GetConnectedExchanges() ([]models.Exchange, error) {
+func (s *ExchangeService) GetConnectedExchanges(ctx context.Context) ([]models.Exchange, error) {
 	var response models.APIResponse[[]models.Exchange]
-	if err := s.client.Get("/exchanges", &response); err != nil {
+	if err := s.client.GetContext(ctx, "/exchanges", &response); err != nil {
 		return nil, fmt.Errorf("failed to get connected exchanges: %w", err)
 	}
 
@@ -34,30 +38,38 @@ func (s *ExchangeService) GetConnectedExchanges() ([]models.Exchange, error) {
 	return response.Result, nil
 }
 
-// FetchExchangeTrades fetches trades for a specific exchange
-func (s *ExchangeService) FetchExchangeTrades(exchange models.Exchange) error {
+// FetchExchangeTrades fetches trades for a specific exchange. With an
+// incremental window only the time since the location's last successful query
+// is fetched.
+func (s *ExchangeService) FetchExchangeTrades(ctx context.Context, exchange models.Exchange) error {
 	logger.Info("Fetching trades for exchange: %s", exchange.Name)
 
 	requestData := map[string]interface{}{
 		"location": exchange.Location,
 	}
+	if from, to := s.window.bounds(state.KindExchange, exchange.Location); from > 0 {
+		requestData["from_timestamp"] = from
+		requestData["to_timestamp"] = to
+	}
 
 	// Use async for fetching exchange trades
-	response, err := async.Post[bool](s.asyncClient, "/history/events/query/exchange", requestData)
+	response, err := async.PostContext[bool](ctx, s.asyncClient, "/history/events/query/exchange", requestData)
 	if err != nil {
 		return fmt.Errorf("failed to fetch trades for exchange %s: %w", exchange.Name, err)
 	}
 	if response == nil {
 		return fmt.Errorf("received nil response for exchange %s trades", exchange.Name)
 	}
+	s.window.done(state.KindExchange, exchange.Location)
 
 	logger.Info("Successfully fetched trades for exchange: %s", exchange.Name)
 	return nil
 }
 
-// GetExchangeTrades fetches trades for all connected exchanges
-func (s *ExchangeService) GetExchangeTrades() error {
-	connectedExchanges, err := s.GetConnectedExchanges()
+// GetExchangeTrades fetches trades for all connected exchanges. Once ctx is
+// done the remaining exchanges are skipped and ctx's error is returned.
+func (s *ExchangeService) GetExchangeTrades(ctx context.Context) error {
+	connectedExchanges, err := s.GetConnectedExchanges(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get connected exchanges: %w", err)
 	}
@@ -70,7 +82,12 @@ func (s *ExchangeService) GetExchangeTrades() error {
 	logger.Info("Processing %d connected exchanges", len(connectedExchanges))
 
 	for _, exchange := range connectedExchanges {
-		err := s.FetchExchangeTrades(exchange)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := retry(ctx, "Fetching trades for exchange "+exchange.Name, func() error {
+			return s.FetchExchangeTrades(ctx, exchange)
+		})
 		if err != nil {
 			logger.Error("Failed to fetch trades for exchange %s: %v", exchange.Name, err)
 			continue
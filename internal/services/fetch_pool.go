@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/client"
+	"github.com/kelsos/rotki-sync/internal/config"
+	"github.com/kelsos/rotki-sync/internal/logger"
+	"github.com/kelsos/rotki-sync/internal/models"
+)
+
+// SetConcurrency sets the limits for concurrent per-account transaction
+// fetches and the batch size. Without it fetches run one account at a time.
+func (s *BlockchainService) SetConcurrency(limits config.ConcurrencyConfig) {
+	s.concurrency = limits
+}
+
+// fetchFunc fetches the transactions of a batch of accounts on one chain in a
+// single request.
+type fetchFunc func(ctx context.Context, accounts []models.ChainAccount) error
+
+// fetchConcurrently runs fetch for every account, grouped by chain id, with at
+// most concurrency.Workers requests in flight overall and ChainLimit per chain.
+// Each chain's accounts are fetched in address order, up to BatchSize accounts
+// per request. Chains start in order: no chain's first request starts before
+// that of the chain ahead of it, unless that chain is held back by a
+// rate-limited provider (see SetRateLimits), which can also move it last. The
+// first request that
+// hits a removed endpoint stops every worker from starting another one and is
+// returned as a ContractBreakError for step; requests already in flight finish
+// but are not counted. Once ctx is done no further request starts and ctx's
+// error is returned.
+func (s *BlockchainService) fetchConcurrently(
+	ctx context.Context,
+	step string,
+	accountsByChain map[string][]models.ChainAccount,
+	fetch fetchFunc,
+) (OpStats, error) {
+	var (
+		stats     OpStats
+		statsMu   sync.Mutex
+		wg        sync.WaitGroup
+		abort     = make(chan struct{})
+		abortOnce sync.Once
+		fatal     error
+	)
+
+	workers := max(s.concurrency.Workers, 1)
+	global := make(chan struct{}, workers)
+
+	chainIDs := orderByRateLimits(s.limits, sortedChains(accountsByChain), func(id string) string { return id })
+	// turn is closed once the chain before the current one has started.
+	turn := make(chan struct{})
+	close(turn)
+	for _, chainID := range chainIDs {
+		accounts := accountsByChain[chainID]
+		batches := batchAccounts(accounts, s.concurrency.BatchSize)
+		queue := make(chan []models.ChainAccount, len(batches))
+		for _, batch := range batches {
+			queue <- batch
+		}
+		close(queue)
+
+		chainWorkers := min(s.chainLimit(chainID), len(batches))
+		logger.Info("Processing %d accounts for chain %s (%d request(s), %d concurrent)",
+			len(accounts), chainID, len(batches), chainWorkers)
+
+		prev, next := turn, make(chan struct{})
+		turn = next
+		var started sync.Once
+		startNext := func() { started.Do(func() { close(next) }) }
+		if chainWorkers == 0 {
+			startNext()
+		}
+
+		for range chainWorkers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer startNext()
+				select {
+				case <-prev:
+				case <-abort:
+					return
+				case <-ctx.Done():
+					return
+				}
+				for batch := range queue {
+					if s.limits.holds(chainID) {
+						startNext()
+					}
+					s.limits.wait(ctx, chainID, "transaction fetch on chain "+chainID)
+					select {
+					case <-abort:
+						return
+					case <-ctx.Done():
+						return
+					case global <- struct{}{}:
+					}
+					// Several channels may have been ready; never start new
+					// work once aborted.
+					select {
+					case <-abort:
+						<-global
+						return
+					case <-ctx.Done():
+						<-global
+						return
+					default:
+					}
+					startNext()
+
+					task := s.limits.begin(chainID)
+					results, err := fetchBatch(ctx, batch, fetch)
+					<-global
+					s.limits.observe(task)
+
+					if err != nil {
+						abortOnce.Do(func() {
+							fatal = &ContractBreakError{Step: step, Endpoint: evmTransactionsEndpoint, Err: err}
+							close(abort)
+						})
+						return
+					}
+
+					statsMu.Lock()
+					for _, result := range results {
+						s.record(&stats, result.account.Blockchain+" "+result.account.Address, result.start, result.err)
+					}
+					statsMu.Unlock()
+				}
+			}()
+		}
+	}
+
+	wg.Wait()
+	if fatal == nil {
+		fatal = ctx.Err()
+	}
+	return stats, fatal
+}
+
+// sortedChains returns the chain ids of accountsByChain in fetch order and
+// sorts each chain's accounts by address in place.
+func sortedChains(accountsByChain map[string][]models.ChainAccount) []string {
+	chainIDs := make([]string, 0, len(accountsByChain))
+	for chainID, accounts := range accountsByChain {
+		chainIDs = append(chainIDs, chainID)
+		sort.Slice(accounts, func(i, j int) bool {
+			return accounts[i].Address < accounts[j].Address
+		})
+	}
+	sort.Strings(chainIDs)
+	return chainIDs
+}
+
+// accountResult is the outcome of fetching one account's transactions.
+type accountResult struct {
+	account models.ChainAccount
+	start   time.Time
+	err     error
+}
+
+// fetchBatch fetches batch in one request. When a multi-account request fails
+// it retries each account on its own, so the report names the address that
+// failed instead of failing the whole batch. Single-account requests are
+// retried after a transient failure (see retry). The returned error is set
+// only for a removed endpoint. A batch that failed because ctx is done or its
+// task timed out is not retried.
+func fetchBatch(ctx context.Context, batch []models.ChainAccount, fetch fetchFunc) ([]accountResult, error) {
+	start := time.Now()
+	var err error
+	if len(batch) == 1 {
+		err = fetchAccount(ctx, batch[0], fetch)
+	} else {
+		err = fetch(ctx, batch)
+	}
+	if client.IsEndpointMissing(err) {
+		return nil, err
+	}
+	if err == nil || len(batch) == 1 || ctx.Err() != nil || timedOut(err) {
+		results := make([]accountResult, len(batch))
+		for i, account := range batch {
+			results[i] = accountResult{account: account, start: start, err: err}
+		}
+		if err != nil {
+			logger.Error("Failed to get transactions for account %s on chain %s: %v",
+				batch[0].Address, batch[0].Blockchain, err)
+		}
+		return results, nil
+	}
+
+	logger.Warn("Batch of %d accounts on chain %s failed, retrying them one at a time: %v",
+		len(batch), batch[0].Blockchain, err)
+	results := make([]accountResult, 0, len(batch))
+	for _, account := range batch {
+		start := time.Now()
+		err := fetchAccount(ctx, account, fetch)
+		if client.IsEndpointMissing(err) {
+			return nil, err
+		}
+		if err != nil {
+			logger.Error("Failed to get transactions for account %s on chain %s: %v",
+				account.Address, account.Blockchain, err)
+		}
+		results = append(results, accountResult{account: account, start: start, err: err})
+	}
+	return results, nil
+}
+
+// fetchAccount fetches the transactions of a single account, retrying it
+// after a transient failure.
+func fetchAccount(ctx context.Context, account models.ChainAccount, fetch fetchFunc) error {
+	return retry(ctx, "Fetching transactions for "+account.Address+" on "+account.Blockchain, func() error {
+		return fetch(ctx, []models.ChainAccount{account})
+	})
+}
+
+// batchAccounts splits accounts into consecutive batches of at most size
+// accounts; a size below two yields one batch per account.
+func batchAccounts(accounts []models.ChainAccount, size int) [][]models.ChainAccount {
+	size = max(size, 1)
+	batches := make([][]models.ChainAccount, 0, (len(accounts)+size-1)/size)
+	for start := 0; start < len(accounts); start += size {
+		batches = append(batches, accounts[start:min(start+size, len(accounts))])
+	}
+	return batches
+}
+
+// chainLimit is the number of workers for a chain; one when no concurrency
+// was configured.
+func (s *BlockchainService) chainLimit(chainID string) int {
+	if s.concurrency.Workers == 0 {
+		return 1
+	}
+	return s.concurrency.ChainLimit(chainID)
+}
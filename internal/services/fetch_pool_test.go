@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/client"
+	"github.com/kelsos/rotki-sync/internal/config"
+	"github.com/kelsos/rotki-sync/internal/models"
+)
+
+func accountsOn(chainID string, addresses ...string) []models.ChainAccount {
+	accounts := make([]models.ChainAccount, len(addresses))
+	for i, address := range addresses {
+		accounts[i] = models.ChainAccount{Address: address, Blockchain: chainID}
+	}
+	return accounts
+}
+
+func TestFetchConcurrentlyRespectsLimits(t *testing.T) {
+	s := &BlockchainService{}
+	s.SetConcurrency(config.ConcurrencyConfig{
+		Workers:      3,
+		ChainWorkers: 1,
+		Chains:       map[string]config.ChainConcurrency{"eth": {Workers: 2}},
+	})
+	groups := map[string][]models.ChainAccount{
+		"eth":      accountsOn("eth", "0x1", "0x2", "0x3", "0x4"),
+		"optimism": accountsOn("optimism", "0x5", "0x6"),
+		"base":     accountsOn("base", "0x7"),
+	}
+
+	var (
+		mu        sync.Mutex
+		inFlight  = map[string]int{}
+		maxChain  = map[string]int{}
+		total     int
+		maxGlobal int
+	)
+	fetch := func(_ context.Context, batch []models.ChainAccount) error {
+		account := batch[0]
+		mu.Lock()
+		inFlight[account.Blockchain]++
+		total++
+		maxChain[account.Blockchain] = max(maxChain[account.Blockchain], inFlight[account.Blockchain])
+		maxGlobal = max(maxGlobal, total)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inFlight[account.Blockchain]--
+		total--
+		mu.Unlock()
+		if account.Address == "0x6" {
+			return errors.New("boom")
+		}
+		return nil
+	}
+
+	stats, err := s.fetchConcurrently(context.Background(), "EVM transaction fetch", groups, fetch)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Ok != 6 || stats.Failed != 1 || len(stats.Items) != 7 {
+		t.Errorf("stats = %d ok / %d failed / %d items, want 6 / 1 / 7", stats.Ok, stats.Failed, len(stats.Items))
+	}
+	if maxGlobal > 3 {
+		t.Errorf("%d fetches in flight, limit is 3", maxGlobal)
+	}
+	if maxChain["eth"] > 2 || maxChain["optimism"] > 1 {
+		t.Errorf("per-chain concurrency exceeded: %v", maxChain)
+	}
+}
+
+func TestFetchConcurrentlyStartsChainsInOrder(t *testing.T) {
+	source := &fakeRateLimits{}
+	s := &BlockchainService{}
+	s.SetConcurrency(config.NewConfig().Concurrency)
+	s.SetRateLimits(source, config.RateLimitConfig{Reorder: true})
+	task := s.limits.begin("base")
+	source.set("etherscan", task.start)
+	s.limits.observe(task)
+
+	groups := map[string][]models.ChainAccount{
+		"optimism": accountsOn("optimism", "0x1"),
+		"base":     accountsOn("base", "0x2"),
+		"eth":      accountsOn("eth", "0x3"),
+		"gnosis":   accountsOn("gnosis", "0x4"),
+	}
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	fetch := func(_ context.Context, batch []models.ChainAccount) error {
+		mu.Lock()
+		order = append(order, batch[0].Blockchain)
+		mu.Unlock()
+		return nil
+	}
+
+	if _, err := s.fetchConcurrently(context.Background(), "EVM transaction fetch", groups, fetch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"eth", "gnosis", "optimism", "base"}; !slices.Equal(order, want) {
+		t.Errorf("fetch order = %q, want %q (rate-limited base last)", order, want)
+	}
+}
+
+func TestFetchConcurrentlyAbortsOnContractBreak(t *testing.T) {
+	s := &BlockchainService{}
+	s.SetConcurrency(config.ConcurrencyConfig{Workers: 2, ChainWorkers: 1})
+	groups := map[string][]models.ChainAccount{
+		"eth":      accountsOn("eth", "0x1", "0x2", "0x3"),
+		"optimism": accountsOn("optimism", "0x4", "0x5", "0x6"),
+	}
+
+	var calls atomic.Int32
+	fetch := func(_ context.Context, batch []models.ChainAccount) error {
+		calls.Add(1)
+		return &client.HTTPError{StatusCode: 404}
+	}
+
+	_, err := s.fetchConcurrently(context.Background(), "EVM transaction fetch", groups, fetch)
+	var contractBreak *ContractBreakError
+	if !errors.As(err, &contractBreak) {
+		t.Fatalf("err = %v, want a ContractBreakError", err)
+	}
+	if n := calls.Load(); n > 2 {
+		t.Errorf("%d fetches started after the contract break, want at most one per worker", n)
+	}
+}
+
+func TestFetchConcurrentlyStopsAtDeadline(t *testing.T) {
+	s := &BlockchainService{}
+	s.SetConcurrency(config.ConcurrencyConfig{Workers: 1, BatchSize: 2})
+	groups := map[string][]models.ChainAccount{
+		"eth": accountsOn("eth", "0x1", "0x2", "0x3", "0x4"),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var calls atomic.Int32
+	fetch := func(ctx context.Context, batch []models.ChainAccount) error {
+		calls.Add(1)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	stats, err := s.fetchConcurrently(ctx, "EVM transaction fetch", groups, fetch)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	// The batch in flight fails as a whole instead of being retried one
+	// account at a time, and the next batch never starts.
+	if n := calls.Load(); n != 1 {
+		t.Errorf("%d fetches, want 1", n)
+	}
+	if stats.Ok != 0 || stats.Failed != 0 || stats.TimedOut != 2 {
+		t.Errorf("stats = %s, want 0 ok / 0 failed / 2 timed out", stats.counts())
+	}
+}
+
+func TestFetchConcurrentlyBatchesAndPinpointsFailures(t *testing.T) {
+	s := &BlockchainService{}
+	s.SetConcurrency(config.ConcurrencyConfig{Workers: 1, BatchSize: 3})
+	groups := map[string][]models.ChainAccount{
+		"eth": accountsOn("eth", "0x5", "0x4", "0x3", "0x2", "0x1"),
+	}
+
+	var requests [][]string
+	fetch := func(_ context.Context, batch []models.ChainAccount) error {
+		var addresses []string
+		for _, account := range batch {
+			addresses = append(addresses, account.Address)
+		}
+		requests = append(requests, addresses)
+		if slices.Contains(addresses, "0x2") {
+			return errors.New("bad address")
+		}
+		return nil
+	}
+
+	stats, err := s.fetchConcurrently(context.Background(), "EVM transaction fetch", groups, fetch)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Ok != 4 || stats.Failed != 1 {
+		t.Errorf("stats = %d ok / %d failed, want 4 / 1", stats.Ok, stats.Failed)
+	}
+	for _, item := range stats.Items {
+		if item.Failed != (item.Name == "eth 0x2") {
+			t.Errorf("item %s failed = %v", item.Name, item.Failed)
+		}
+	}
+	// One batch of three that fails, its three accounts alone, then the
+	// remaining batch of two.
+	want := [][]string{{"0x1", "0x2", "0x3"}, {"0x1"}, {"0x2"}, {"0x3"}, {"0x4", "0x5"}}
+	if len(requests) != len(want) {
+		t.Fatalf("requests = %v, want %v", requests, want)
+	}
+	for i := range want {
+		if !slices.Equal(requests[i], want[i]) {
+			t.Errorf("request %d = %v, want %v", i, requests[i], want[i])
+		}
+	}
+}
+
+func TestBatchAccounts(t *testing.T) {
+	accounts := accountsOn("eth", "0x1", "0x2", "0x3", "0x4", "0x5")
+	for size, want := range map[int][]int{0: {1, 1, 1, 1, 1}, 1: {1, 1, 1, 1, 1}, 2: {2, 2, 1}, 10: {5}} {
+		batches := batchAccounts(accounts, size)
+		got := make([]int, len(batches))
+		for i, batch := range batches {
+			got[i] = len(batch)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("batchAccounts(size %d) sizes = %v, want %v", size, got, want)
+		}
+	}
+}
+
+func TestChainLimit(t *testing.T) {
+	c := config.ConcurrencyConfig{
+		Workers:      4,
+		ChainWorkers: 0,
+		Chains:       map[string]config.ChainConcurrency{"eth": {Workers: 8}, "base": {Workers: 2}},
+	}
+	for chain, want := range map[string]int{"eth": 4, "base": 2, "optimism": 4} {
+		if got := c.ChainLimit(chain); got != want {
+			t.Errorf("ChainLimit(%q) = %d, want %d", chain, got, want)
+		}
+	}
+}
+
+func TestFetchConcurrentlyRetriesTransientFailures(t *testing.T) {
+	s := &BlockchainService{}
+	groups := map[string][]models.ChainAccount{"eth": accountsOn("eth", "0x1", "0x2")}
+
+	attempts := make(map[string]int)
+	fetch := func(_ context.Context, batch []models.ChainAccount) error {
+		address := batch[0].Address
+		attempts[address]++
+		if address == "0x1" && attempts[address] < 3 {
+			return &client.HTTPError{StatusCode: 503, Body: "busy"}
+		}
+		if address == "0x2" {
+			return errors.New("bad address")
+		}
+		return nil
+	}
+
+	ctx := withRetryPolicy(context.Background(), retryPolicy{retries: 3, delay: time.Millisecond})
+	stats, err := s.fetchConcurrently(ctx, "EVM transaction fetch", groups, fetch)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Ok != 1 || stats.Failed != 1 {
+		t.Errorf("stats = %d ok / %d failed, want 1 / 1", stats.Ok, stats.Failed)
+	}
+	if attempts["0x1"] != 3 || attempts["0x2"] != 1 {
+		t.Errorf("attempts = %v, want 0x1 three times and 0x2 once", attempts)
+	}
+}
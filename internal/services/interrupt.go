@@ -0,0 +1,61 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/logger"
+)
+
+// interruption tracks a request to stop the run early (see Interrupt).
+type interruption struct {
+	mu     sync.Mutex
+	reason string
+	// cancel gives up on the in-flight async tasks once the shutdown timeout
+	// passes.
+	cancel *time.Timer
+}
+
+// Interrupt asks the run in progress to stop: no further step, user or async
+// task is started, the current user is logged out as usual and the report is
+// marked interrupted. Async tasks in flight get the configured shutdown
+// timeout to finish before they are canceled. Calling it again cancels them at
+// once. reason (e.g. "signal: terminated") is recorded in the report.
+func (s *SyncService) Interrupt(reason string) {
+	s.interruption.mu.Lock()
+	defer s.interruption.mu.Unlock()
+
+	if s.interruption.reason != "" {
+		logger.Warn("Interrupted again (%s); canceling the running tasks", reason)
+		s.interruption.cancel.Stop()
+		s.taskManager.CancelTasks()
+		return
+	}
+	s.interruption.reason = reason
+	s.taskManager.StopNewTasks()
+
+	timeout := s.config.ShutdownTimeout
+	logger.Warn("Run interrupted (%s); stopping after the current step, waiting up to %s for running tasks",
+		reason, timeout)
+	s.interruption.cancel = time.AfterFunc(timeout, func() {
+		logger.Warn("Shutdown timeout of %s reached; canceling the running tasks", timeout)
+		s.taskManager.CancelTasks()
+	})
+}
+
+// interrupted returns why the run was interrupted, or "" while it was not.
+func (s *SyncService) interrupted() string {
+	s.interruption.mu.Lock()
+	defer s.interruption.mu.Unlock()
+	return s.interruption.reason
+}
+
+// settleInterruption stops a pending task cancellation once the run ended on
+// its own.
+func (s *SyncService) settleInterruption() {
+	s.interruption.mu.Lock()
+	defer s.interruption.mu.Unlock()
+	if s.interruption.cancel != nil {
+		s.interruption.cancel.Stop()
+	}
+}
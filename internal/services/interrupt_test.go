@@ -0,0 +1,72 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kelsos/rotki-sync/internal/config"
+)
+
+func TestInterruptedRunStartsNoUser(t *testing.T) {
+	t.Setenv("ROTKI_SYNC_HOME", t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/api/1/users" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"result": {"alice": "loggedout"}, "message": ""}`))
+	}))
+	defer server.Close()
+
+	svc := NewSyncService(&config.Config{BaseURL: server.URL})
+	svc.Interrupt("signal: terminated")
+	report, err := svc.ProcessAllUsers()
+	if err != nil {
+		t.Fatalf("ProcessAllUsers: %v", err)
+	}
+	if report.Interrupted != "signal: terminated" {
+		t.Errorf("Interrupted = %q", report.Interrupted)
+	}
+	if len(report.Users) != 0 {
+		t.Errorf("users = %+v, want none", report.Users)
+	}
+}
+
+func TestInterruptedReport(t *testing.T) {
+	report := &RunReport{Interrupted: "signal: interrupt", Users: []UserReport{{
+		Username:    "alice",
+		Interrupted: true,
+		Steps: []StepReport{
+			{ID: StepSnapshot, Step: "balance snapshot", Core: true},
+			{ID: StepEvmFetch, Step: "EVM transaction fetch", Core: true, Interrupted: true,
+				Stats: OpStats{Ok: 0, Failed: 2}},
+		},
+	}}}
+
+	if report.HasFailures() {
+		t.Error("an interrupted step should not count as failed")
+	}
+
+	doc := report.Document()
+	if doc.Status != StatusInterrupted || doc.Interrupted != "signal: interrupt" {
+		t.Errorf("run status = %q (%q), want interrupted", doc.Status, doc.Interrupted)
+	}
+	if got := doc.Users[0].Status; got != StatusInterrupted {
+		t.Errorf("user status = %q, want interrupted", got)
+	}
+	if got := []string{doc.Users[0].Steps[0].Status, doc.Users[0].Steps[1].Status}; got[0] != StatusOK || got[1] != StatusInterrupted {
+		t.Errorf("step statuses = %v, want [ok interrupted]", got)
+	}
+
+	summary := report.Summary()
+	for _, want := range []string{
+		"INTERRUPTED: signal: interrupt; continue with --resume",
+		"[interrupted] EVM transaction fetch: 0 ok / 2 failed",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary missing %q:\n%s", want, summary)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/logger"
+	"github.com/kelsos/rotki-sync/internal/models"
+	"github.com/kelsos/rotki-sync/internal/state"
+)
+
+// PlannedTask is one async request a run would issue.
+type PlannedTask struct {
+	Method   string
+	Endpoint string
+	// Target is what the request covers, e.g. "eth 0xabc, 0xdef" or a chain id.
+	Target string
+}
+
+// StepPlan is what one pipeline step would do for a user.
+type StepPlan struct {
+	ID   string
+	Step string
+	// Skipped marks a step disabled by the step selection.
+	Skipped bool
+	// Resumed marks a step finished in the interrupted run being resumed.
+	Resumed bool
+	Tasks   []PlannedTask
+	// Err is set when a read needed to plan the step failed; the real step
+	// would most likely fail the same way.
+	Err error
+}
+
+// UserPlan is the plan for one user.
+type UserPlan struct {
+	Username string
+	// LoginErr is set when the user could not be logged in, so nothing was
+	// planned.
+	LoginErr error
+	Steps    []StepPlan
+}
+
+// RunPlan is the outcome of a dry run: the async tasks a sync would issue per
+// user.
+type RunPlan struct {
+	Users []UserPlan
+}
+
+// TaskCount returns the number of planned tasks across every user.
+func (p *RunPlan) TaskCount() int {
+	count := 0
+	for _, user := range p.Users {
+		for _, step := range user.Steps {
+			count += len(step.Tasks)
+		}
+	}
+	return count
+}
+
+// HasErrors reports whether a login or a step's planning failed.
+func (p *RunPlan) HasErrors() bool {
+	for _, user := range p.Users {
+		if user.LoginErr != nil {
+			return true
+		}
+		for _, step := range user.Steps {
+			if step.Err != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Summary renders the plan as a multi-line, human-readable listing.
+func (p *RunPlan) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Dry-run plan (%d async task(s), nothing was sent):", p.TaskCount())
+
+	for _, user := range p.Users {
+		fmt.Fprintf(&b, "\n  user %s:", user.Username)
+		if user.LoginErr != nil {
+			fmt.Fprintf(&b, "\n    [FAILED] login: %v", user.LoginErr)
+			continue
+		}
+		for _, step := range user.Steps {
+			switch {
+			case step.Resumed:
+				fmt.Fprintf(&b, "\n    [resumed] %s: finished before the interruption", step.Step)
+			case step.Skipped:
+				fmt.Fprintf(&b, "\n    [skipped] %s", step.Step)
+			case step.Err != nil:
+				fmt.Fprintf(&b, "\n    [FAILED] %s: %v", step.Step, step.Err)
+			case len(step.Tasks) == 0:
+				fmt.Fprintf(&b, "\n    [plan] %s: nothing to do", step.Step)
+			default:
+				fmt.Fprintf(&b, "\n    [plan] %s: %d task(s)", step.Step, len(step.Tasks))
+			}
+			for _, task := range step.Tasks {
+				fmt.Fprintf(&b, "\n      %s %s", task.Method, task.Endpoint)
+				if task.Target != "" {
+					fmt.Fprintf(&b, "  %s", task.Target)
+				}
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// PlanAllUsers logs in every selected user and plans the enabled steps from
+// the read-only endpoints, without issuing any fetch, decode or snapshot
+// request. Logging users in and out is the only change it makes on the
+// backend. The incremental sync state is read but never updated.
+func (s *SyncService) PlanAllUsers() (*RunPlan, error) {
+	plan := &RunPlan{}
+	err := s.user.ProcessUsersWithCallback(context.Background(), func(username string, loginErr error) {
+		if loginErr != nil {
+			plan.Users = append(plan.Users, UserPlan{Username: username, LoginErr: loginErr})
+		}
+	}, func(username string) error {
+		s.window.begin(username)
+		plan.Users = append(plan.Users, s.planUser(username))
+		return nil
+	}, nil)
+	return plan, err
+}
+
+// planUser plans every pipeline step for username.
+func (s *SyncService) planUser(username string) UserPlan {
+	logger.Info("Planning data processing for user: %s", username)
+
+	user := UserPlan{Username: username}
+	for _, step := range s.pipeline() {
+		s.checkpoint.enter(username, step.id)
+		if !s.StepEnabled(username, step.id) {
+			user.Steps = append(user.Steps, StepPlan{ID: step.id, Step: step.name, Skipped: true})
+			continue
+		}
+		if s.checkpoint.stepDone() {
+			user.Steps = append(user.Steps, StepPlan{ID: step.id, Step: step.name, Resumed: true})
+			continue
+		}
+		tasks, err := step.plan()
+		if err != nil {
+			logger.Error("Failed to plan %s: %v", step.name, err)
+		}
+		user.Steps = append(user.Steps, StepPlan{ID: step.id, Step: step.name, Tasks: tasks, Err: err})
+	}
+	return user
+}
+
+// planSnapshot plans the balance snapshot, if one is due.
+func (s *BlockchainService) planSnapshot() ([]PlannedTask, error) {
+	due, forceSnapshot, err := s.snapshotDue(context.Background())
+	if err != nil || !due {
+		return nil, err
+	}
+	return []PlannedTask{{Method: "GET", Endpoint: balancesEndpoint(forceSnapshot)}}, nil
+}
+
+// planTokenDetection plans a detection for every selected address without a
+// fresh cached detection.
+func (s *BlockchainService) planTokenDetection() ([]PlannedTask, error) {
+	chains, err := s.GetTokenDetectionChains(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []PlannedTask
+	for _, chain := range chains {
+		for _, address := range s.pendingTokenDetection(context.Background(), chain) {
+			tasks = append(tasks, PlannedTask{
+				Method:   "POST",
+				Endpoint: fmt.Sprintf("/blockchains/%s/tokens/detect", chain.ChainID),
+				Target:   address,
+			})
+		}
+	}
+	return tasks, nil
+}
+
+// planExchangeTrades plans one history query per connected exchange.
+func (s *ExchangeService) planExchangeTrades() ([]PlannedTask, error) {
+	exchanges, err := s.GetConnectedExchanges(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connected exchanges: %w", err)
+	}
+
+	tasks := make([]PlannedTask, 0, len(exchanges))
+	for _, exchange := range exchanges {
+		from, _ := s.window.bounds(state.KindExchange, exchange.Location)
+		tasks = append(tasks, PlannedTask{
+			Method:   "POST",
+			Endpoint: "/history/events/query/exchange",
+			Target:   exchange.Name + " (" + exchange.Location + ")" + since(from),
+		})
+	}
+	return tasks, nil
+}
+
+// planOnlineEvents plans one query per configured online-event integration.
+func (s *BlockchainService) planOnlineEvents() ([]PlannedTask, error) {
+	queryTypes, err := s.onlineEventQueries(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]PlannedTask, len(queryTypes))
+	for i, queryType := range queryTypes {
+		tasks[i] = PlannedTask{Method: "POST", Endpoint: "/history/events/query", Target: string(queryType)}
+	}
+	return tasks, nil
+}
+
+// planEvmFetch plans the EVM transaction fetch requests, batched as the fetch
+// would send them.
+func (s *BlockchainService) planEvmFetch() ([]PlannedTask, error) {
+	accountsByChain, err := s.evmFetchAccounts(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return s.planFetch(accountsByChain), nil
+}
+
+// planNonEvmFetch plans the non-EVM transaction fetch requests.
+func (s *BlockchainService) planNonEvmFetch() ([]PlannedTask, error) {
+	var tasks []PlannedTask
+	for _, chainType := range nonEvmChainTypes {
+		accountsByChain, err := s.nonEvmFetchAccounts(context.Background(), chainType)
+		if err != nil {
+			return tasks, err
+		}
+		tasks = append(tasks, s.planFetch(accountsByChain)...)
+	}
+	return tasks, nil
+}
+
+// planFetch turns grouped accounts into one planned request per batch, in
+// fetch order.
+func (s *BlockchainService) planFetch(accountsByChain map[string][]models.ChainAccount) []PlannedTask {
+	var tasks []PlannedTask
+	for _, chainID := range sortedChains(accountsByChain) {
+		for _, batch := range batchAccounts(accountsByChain[chainID], s.concurrency.BatchSize) {
+			keys := make([]string, len(batch))
+			addresses := make([]string, len(batch))
+			for i, account := range batch {
+				keys[i] = account.Blockchain + " " + account.Address
+				addresses[i] = account.Address
+			}
+			from, _ := s.window.bounds(state.KindAccount, keys...)
+			tasks = append(tasks, PlannedTask{
+				Method:   "POST",
+				Endpoint: evmTransactionsEndpoint,
+				Target:   chainID + " " + strings.Join(addresses, ", ") + since(from),
+			})
+		}
+	}
+	return tasks
+}
+
+// planEvmDecode plans one decode request per selected EVM chain.
+func (s *BlockchainService) planEvmDecode() ([]PlannedTask, error) {
+	chainIDs, err := s.evmDecodeChains(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]PlannedTask, len(chainIDs))
+	for i, chainID := range chainIDs {
+		tasks[i] = PlannedTask{Method: "POST", Endpoint: transactionsDecodeEndpoint, Target: chainID}
+	}
+	return tasks, nil
+}
+
+// planNonEvmDecode plans one decode request per selected decodable non-EVM
+// chain.
+func (s *BlockchainService) planNonEvmDecode() ([]PlannedTask, error) {
+	var tasks []PlannedTask
+	for _, chainType := range decodableNonEvmChainTypes() {
+		chains, err := s.nonEvmDecodeChains(context.Background(), chainType)
+		if err != nil {
+			return tasks, err
+		}
+		for _, chain := range chains {
+			tasks = append(tasks, PlannedTask{Method: "POST", Endpoint: transactionsDecodeEndpoint, Target: chain.ID})
+		}
+	}
+	return tasks, nil
+}
+
+// since describes an incremental window's start for a plan target; empty for a
+// full fetch.
+func since(from int64) string {
+	if from <= 0 {
+		return ""
+	}
+	return " since " + time.Unix(from, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/config"
+)
+
+// newPlanBackend serves the read-only endpoints a plan uses and fails the test
+// on any other request, so planning can never issue a mutating call.
+func newPlanBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	lastSave := strconv.FormatInt(time.Now().Add(-48*time.Hour).Unix(), 10)
+	responses := map[string]string{
+		"/api/1/blockchains/supported": `{"result": [
+			{"id": "eth", "name": "Ethereum", "type": "evm", "evm_chain_name": "ethereum"},
+			{"id": "avax", "name": "Avalanche", "type": "evm", "evm_chain_name": "avalanche"},
+			{"id": "optimism", "name": "Optimism", "type": "evm", "evm_chain_name": "optimism"}
+		]}`,
+		"/api/1/blockchains/eth/accounts":      `{"result": [{"address": "0xb"}, {"address": "0xa"}, {"address": "0xc", "tags": ["cold"]}]}`,
+		"/api/1/blockchains/avax/accounts":     `{"result": [{"address": "0xa"}]}`,
+		"/api/1/blockchains/optimism/accounts": `{"result": []}`,
+		"/api/1/periodic":                      `{"result": {"last_balance_save": ` + lastSave + `}}`,
+		"/api/1/settings":                      `{"result": {"balance_save_frequency": 24, "active_modules": ["eth2"]}}`,
+		"/api/1/exchanges":                     `{"result": [{"name": "main", "location": "kraken"}]}`,
+		"/api/1/external_services":             `{"result": {"gnosis_pay": {}}}`,
+		"/api/1/services/monerium":             `{"result": {"authenticated": false}}`,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if r.Method != http.MethodGet || !ok {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+func TestPlanStepsUseReadOnlyEndpoints(t *testing.T) {
+	t.Setenv("ROTKI_SYNC_HOME", t.TempDir())
+	server := newPlanBackend(t)
+	defer server.Close()
+
+	cfg := &config.Config{
+		BaseURL:     server.URL,
+		Concurrency: config.ConcurrencyConfig{Workers: 4, BatchSize: 2},
+		Accounts:    config.AccountRules{Exclude: []config.AccountRule{{Tag: "cold"}}},
+	}
+	svc := NewSyncService(cfg)
+
+	plans := make(map[string][]PlannedTask)
+	for _, step := range svc.pipeline() {
+		if step.id == StepTokenDetection || step.id == StepNonEvmFetch || step.id == StepNonEvmDecode {
+			continue // covered by the same helpers; needs the async cache query
+		}
+		tasks, err := step.plan()
+		if err != nil {
+			t.Fatalf("plan %s: %v", step.id, err)
+		}
+		plans[step.id] = tasks
+	}
+
+	tests := []struct {
+		step string
+		want []PlannedTask
+	}{
+		{StepSnapshot, []PlannedTask{{Method: "GET", Endpoint: "/balances"}}},
+		{StepExchangeTrades, []PlannedTask{{Method: "POST", Endpoint: "/history/events/query/exchange", Target: "main (kraken)"}}},
+		{StepOnlineEvents, []PlannedTask{
+			{Method: "POST", Endpoint: "/history/events/query", Target: "gnosis_pay"},
+			{Method: "POST", Endpoint: "/history/events/query", Target: "block_productions"},
+			{Method: "POST", Endpoint: "/history/events/query", Target: "eth_withdrawals"},
+		}},
+		// avalanche is never fetched and the cold account is excluded; the
+		// rest is sorted and batched like the real fetch.
+		{StepEvmFetch, []PlannedTask{{Method: "POST", Endpoint: evmTransactionsEndpoint, Target: "eth 0xa, 0xb"}}},
+		{StepEvmDecode, []PlannedTask{
+			{Method: "POST", Endpoint: transactionsDecodeEndpoint, Target: "eth"},
+			{Method: "POST", Endpoint: transactionsDecodeEndpoint, Target: "optimism"},
+		}},
+	}
+	for _, tt := range tests {
+		got := plans[tt.step]
+		if len(got) != len(tt.want) {
+			t.Errorf("%s plan = %+v, want %+v", tt.step, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s task %d = %+v, want %+v", tt.step, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestRunPlanSummary(t *testing.T) {
+	plan := &RunPlan{Users: []UserPlan{
+		{Username: "alice", Steps: []StepPlan{
+			{ID: StepSnapshot, Step: "balance snapshot"},
+			{ID: StepEvmFetch, Step: "EVM transaction fetch", Tasks: []PlannedTask{
+				{Method: "POST", Endpoint: evmTransactionsEndpoint, Target: "eth 0xa"},
+			}},
+			{ID: StepEvmDecode, Step: "EVM transaction decode", Skipped: true},
+		}},
+		{Username: "bob", LoginErr: errors.New("no stored password")},
+	}}
+
+	summary := plan.Summary()
+	for _, want := range []string{
+		"1 async task(s)",
+		"[plan] balance snapshot: nothing to do",
+		"[plan] EVM transaction fetch: 1 task(s)",
+		"POST /blockchains/transactions  eth 0xa",
+		"[skipped] EVM transaction decode",
+		"[FAILED] login: no stored password",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary missing %q:\n%s", want, summary)
+		}
+	}
+	if !plan.HasErrors() {
+		t.Error("a failed login should count as a plan error")
+	}
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/config"
+	"github.com/kelsos/rotki-sync/internal/logger"
+	"github.com/kelsos/rotki-sync/internal/progress"
+)
+
+// RateLimitSource tells when rotki-core was last rate-limited by each remote
+// provider (see progress.Tracker.RateLimits).
+type RateLimitSource interface {
+	RateLimits() map[string]time.Time
+}
+
+// rateLimitCheckInterval is how often a held-back task checks whether the
+// providers it waits for are still rate-limited.
+const rateLimitCheckInterval = time.Second
+
+// rateLimitGate holds back new tasks for the chains a rate-limited provider
+// slows down, and can put those chains last. The log tail does not name the
+// chain a marker is about, so the gate learns it: a provider seen
+// rate-limited while only one chain's tasks ran is taken to affect that chain
+// for the rest of the run. A marker from a moment when tasks of several chains
+// ran makes those chains suspects of the provider instead; while it stays
+// rate-limited the suspects take turns, so its next marker names one chain.
+// A nil gate holds nothing back.
+type rateLimitGate struct {
+	source RateLimitSource
+	limits config.RateLimitConfig
+	// interval overrides rateLimitCheckInterval in tests.
+	interval time.Duration
+
+	mu sync.Mutex
+	// hitBy is, per chain id, the providers seen rate-limited while its
+	// tasks ran.
+	hitBy map[string]map[string]bool
+	// suspects is, per provider not yet attributed, the chains whose tasks
+	// ran together when it was seen rate-limited.
+	suspects map[string]map[string]bool
+	// spans are the running tasks and the finished ones a running task
+	// overlapped.
+	spans []*taskSpan
+}
+
+// taskSpan is a task the gate watches: the chain it is for and when it ran.
+type taskSpan struct {
+	chain string
+	start time.Time
+	// end is zero while the task runs.
+	end time.Time
+}
+
+// SetRateLimits makes the fetch, decode and token detection steps react to
+// the rate limits reported by source as configured by limits.
+func (s *BlockchainService) SetRateLimits(source RateLimitSource, limits config.RateLimitConfig) {
+	s.limits = &rateLimitGate{
+		source:   source,
+		limits:   limits,
+		hitBy:    make(map[string]map[string]bool),
+		suspects: make(map[string]map[string]bool),
+	}
+}
+
+// limitedProviders returns the providers hitting chain that are still
+// rate-limited, sorted.
+func (g *rateLimitGate) limitedProviders(chain string) []string {
+	g.mu.Lock()
+	hitBy := maps.Clone(g.hitBy[chain])
+	g.mu.Unlock()
+	return g.stillLimited(hitBy)
+}
+
+// heldBy returns the still rate-limited providers the next task for chain
+// waits for: those hitting chain, and those chain is a suspect of while a
+// task for another of their suspects runs.
+func (g *rateLimitGate) heldBy(chain string) []string {
+	g.mu.Lock()
+	providers := maps.Clone(g.hitBy[chain])
+	for provider, chains := range g.suspects {
+		if chains[chain] && g.suspectRunning(provider, chain) {
+			if providers == nil {
+				providers = make(map[string]bool)
+			}
+			providers[provider] = true
+		}
+	}
+	g.mu.Unlock()
+	return g.stillLimited(providers)
+}
+
+// stillLimited returns the providers in set that are still rate-limited,
+// sorted.
+func (g *rateLimitGate) stillLimited(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	var providers []string
+	for provider, at := range g.source.RateLimits() {
+		if set[provider] && time.Since(at) < progress.RateLimitHold {
+			providers = append(providers, provider)
+		}
+	}
+	slices.Sort(providers)
+	return providers
+}
+
+// suspectRunning reports whether a task runs for a suspect of provider other
+// than chain. The caller holds g.mu.
+func (g *rateLimitGate) suspectRunning(provider, chain string) bool {
+	for _, span := range g.spans {
+		if span.end.IsZero() && span.chain != chain && g.suspects[provider][span.chain] {
+			return true
+		}
+	}
+	return false
+}
+
+// holds reports whether wait would hold back the next task for chain.
+func (g *rateLimitGate) holds(chain string) bool {
+	return g != nil && g.limits.Pause > 0 && len(g.heldBy(chain)) > 0
+}
+
+// wait holds back the next task for chain, described by what, while a
+// provider affecting the chain is rate-limited, or while a task for another
+// suspect of a rate-limited provider runs, for at most the configured pause.
+// It returns early once ctx is done.
+func (g *rateLimitGate) wait(ctx context.Context, chain, what string) {
+	if g == nil || g.limits.Pause <= 0 {
+		return
+	}
+	providers := g.heldBy(chain)
+	if len(providers) == 0 {
+		return
+	}
+
+	interval := g.interval
+	if interval <= 0 {
+		interval = rateLimitCheckInterval
+	}
+	logger.Info("Holding back %s while %s rate-limited (up to %s)",
+		what, strings.Join(providers, ", "), g.limits.Pause)
+	start := time.Now()
+	deadline := time.After(g.limits.Pause)
+	for len(providers) > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+			logger.Info("Starting %s although %s still rate-limited", what, strings.Join(providers, ", "))
+			return
+		case <-time.After(interval):
+		}
+		providers = g.heldBy(chain)
+	}
+	logger.Debug("Resuming %s after %s", what, time.Since(start).Round(time.Second))
+}
+
+// begin records that a task for chain starts now. The returned span is passed
+// to observe once the task is done.
+func (g *rateLimitGate) begin(chain string) *taskSpan {
+	if g == nil {
+		return nil
+	}
+	span := &taskSpan{chain: chain, start: time.Now()}
+	g.mu.Lock()
+	g.spans = append(g.spans, span)
+	g.mu.Unlock()
+	return span
+}
+
+// observe ends span and records the providers seen rate-limited since it
+// began as affecting its chain. When tasks for other chains were running at
+// the time too, all those chains become suspects of the provider instead.
+func (g *rateLimitGate) observe(span *taskSpan) {
+	if g == nil {
+		return
+	}
+	limits := g.source.RateLimits()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	span.end = time.Now()
+	defer g.pruneSpans()
+
+	chain := span.chain
+	for provider, at := range limits {
+		if at.Before(span.start) {
+			continue
+		}
+		if g.hitBy[chain][provider] {
+			continue
+		}
+		if running := g.chainsRunningAt(at); len(running) > 1 {
+			if g.suspects[provider] == nil {
+				g.suspects[provider] = make(map[string]bool)
+			}
+			for _, other := range running {
+				g.suspects[provider][other] = true
+			}
+			logger.Debug("Provider %s rate-limited while chains %s were worked on; taking turns until it is clear which",
+				provider, strings.Join(running, ", "))
+			continue
+		}
+		if g.hitBy[chain] == nil {
+			g.hitBy[chain] = make(map[string]bool)
+		}
+		logger.Debug("Provider %s rate-limited while working on chain %s", provider, chain)
+		g.hitBy[chain][provider] = true
+		delete(g.suspects, provider)
+	}
+}
+
+// chainsRunningAt returns the chains with a task running at, sorted. The
+// caller holds g.mu.
+func (g *rateLimitGate) chainsRunningAt(at time.Time) []string {
+	var chains []string
+	for _, span := range g.spans {
+		if !at.Before(span.start) && (span.end.IsZero() || !at.After(span.end)) && !slices.Contains(chains, span.chain) {
+			chains = append(chains, span.chain)
+		}
+	}
+	slices.Sort(chains)
+	return chains
+}
+
+// pruneSpans drops the finished spans no running task overlaps. The caller
+// holds g.mu.
+func (g *rateLimitGate) pruneSpans() {
+	var oldest time.Time
+	for _, span := range g.spans {
+		if span.end.IsZero() && (oldest.IsZero() || span.start.Before(oldest)) {
+			oldest = span.start
+		}
+	}
+	g.spans = slices.DeleteFunc(g.spans, func(span *taskSpan) bool {
+		return !span.end.IsZero() && (oldest.IsZero() || span.end.Before(oldest))
+	})
+}
+
+// orderByRateLimits returns items with those whose chain is affected by a
+// rate-limited provider moved to the end, keeping the order otherwise. It
+// returns items unchanged unless reordering is enabled.
+func orderByRateLimits[T any](g *rateLimitGate, items []T, chainOf func(T) string) []T {
+	if g == nil || !g.limits.Reorder || len(items) < 2 {
+		return items
+	}
+	ready := make([]T, 0, len(items))
+	var limited []T
+	for _, item := range items {
+		if len(g.limitedProviders(chainOf(item))) > 0 {
+			limited = append(limited, item)
+		} else {
+			ready = append(ready, item)
+		}
+	}
+	if len(limited) > 0 && len(ready) > 0 {
+		logger.Debug("Working on %d chain(s) not affected by rate limits first", len(ready))
+	}
+	return append(ready, limited...)
+}
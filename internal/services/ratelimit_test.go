@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/config"
+	"github.com/kelsos/rotki-sync/internal/models"
+)
+
+// fakeRateLimits is a RateLimitSource whose markers the test sets.
+type fakeRateLimits struct {
+	mu     sync.Mutex
+	limits map[string]time.Time
+}
+
+func (f *fakeRateLimits) RateLimits() map[string]time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return maps.Clone(f.limits)
+}
+
+func (f *fakeRateLimits) set(provider string, at time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.limits == nil {
+		f.limits = make(map[string]time.Time)
+	}
+	f.limits[provider] = at
+}
+
+func newTestGate(source RateLimitSource, limits config.RateLimitConfig) *rateLimitGate {
+	s := &BlockchainService{}
+	s.SetRateLimits(source, limits)
+	s.limits.interval = 5 * time.Millisecond
+	return s.limits
+}
+
+func TestRateLimitGateObserve(t *testing.T) {
+	source := &fakeRateLimits{}
+	gate := newTestGate(source, config.RateLimitConfig{Pause: time.Minute})
+
+	task := gate.begin("1")
+	source.set("coingecko", task.start.Add(-time.Second)) // before the task began
+	source.set("etherscan", task.start.Add(time.Millisecond))
+	gate.observe(task)
+
+	if got, want := gate.limitedProviders("1"), []string{"etherscan"}; !slices.Equal(got, want) {
+		t.Errorf("limitedProviders(1) = %q, want %q", got, want)
+	}
+	if got := gate.limitedProviders("10"); len(got) != 0 {
+		t.Errorf("limitedProviders(10) = %q, want none for a chain no provider hit", got)
+	}
+}
+
+func TestRateLimitGateObserveConcurrentChains(t *testing.T) {
+	source := &fakeRateLimits{}
+	gate := newTestGate(source, config.RateLimitConfig{Pause: time.Minute})
+
+	eth, gnosis := gate.begin("1"), gate.begin("100")
+	source.set("etherscan", time.Now())
+	gate.observe(eth)
+	for _, chain := range []string{"1", "100"} {
+		if got := gate.limitedProviders(chain); len(got) != 0 {
+			t.Errorf("limitedProviders(%s) = %q, want none for a marker while both chains ran", chain, got)
+		}
+	}
+	if !gate.holds("1") {
+		t.Error("chain 1 should wait while its fellow suspect 100 runs")
+	}
+	if gate.holds("100") {
+		t.Error("chain 100 should not wait while no other suspect runs")
+	}
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		gate.observe(gnosis)
+	}()
+	start := time.Now()
+	gate.wait(context.Background(), "1", "test task")
+	if waited := time.Since(start); waited < 30*time.Millisecond || waited > 10*time.Second {
+		t.Errorf("waited %s, want until chain 100's task finished", waited)
+	}
+
+	gnosis = gate.begin("100")
+	source.set("etherscan", gnosis.start.Add(time.Millisecond))
+	gate.observe(gnosis)
+	if got, want := gate.limitedProviders("100"), []string{"etherscan"}; !slices.Equal(got, want) {
+		t.Errorf("limitedProviders(100) = %q, want %q once it ran alone", got, want)
+	}
+	if got := gate.limitedProviders("1"); len(got) != 0 {
+		t.Errorf("limitedProviders(1) = %q, want none", got)
+	}
+	if len(gate.suspects) != 0 || len(gate.spans) != 0 {
+		t.Errorf("suspects %v and %d spans kept after the provider was attributed", gate.suspects, len(gate.spans))
+	}
+}
+
+func TestRateLimitGateHoldsBackDefaultFetch(t *testing.T) {
+	const pause = 50 * time.Millisecond
+	source := &fakeRateLimits{}
+	s := &BlockchainService{}
+	s.SetConcurrency(config.NewConfig().Concurrency)
+	s.SetRateLimits(source, config.RateLimitConfig{Pause: pause})
+	s.limits.interval = 5 * time.Millisecond
+
+	groups := map[string][]models.ChainAccount{
+		"1":  accountsOn("1", "0x1", "0x2"),
+		"10": accountsOn("10", "0x3"),
+	}
+	var (
+		mu      sync.Mutex
+		order   []string
+		limited time.Time
+		resumed time.Duration
+	)
+	fetch := func(_ context.Context, batch []models.ChainAccount) error {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, batch[0].Address)
+		switch batch[0].Address {
+		case "0x1":
+			limited = time.Now()
+			source.set("etherscan", limited)
+		case "0x2":
+			resumed = time.Since(limited)
+		}
+		return nil
+	}
+
+	if _, err := s.fetchConcurrently(context.Background(), "EVM transaction fetch", groups, fetch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := s.limits.limitedProviders("1"); !slices.Equal(got, []string{"etherscan"}) {
+		t.Errorf("limitedProviders(1) = %q, want etherscan", got)
+	}
+	if want := []string{"0x1", "0x3", "0x2"}; !slices.Equal(order, want) {
+		t.Errorf("fetch order = %q, want %q (chain 10 carries on while chain 1 waits)", order, want)
+	}
+	if resumed < pause {
+		t.Errorf("chain 1 resumed after %s, want it held back for the %s pause", resumed, pause)
+	}
+}
+
+func TestRateLimitGateWait(t *testing.T) {
+	t.Run("until the provider clears", func(t *testing.T) {
+		source := &fakeRateLimits{}
+		gate := newTestGate(source, config.RateLimitConfig{Pause: time.Minute})
+		task := gate.begin("1")
+		start := task.start
+		source.set("etherscan", start)
+		gate.observe(task)
+
+		go func() {
+			time.Sleep(30 * time.Millisecond)
+			source.set("etherscan", time.Now().Add(-time.Hour))
+		}()
+		gate.wait(context.Background(), "1", "test task")
+		if waited := time.Since(start); waited < 30*time.Millisecond || waited > 10*time.Second {
+			t.Errorf("waited %s, want until the provider cleared", waited)
+		}
+	})
+
+	t.Run("at most the pause", func(t *testing.T) {
+		source := &fakeRateLimits{}
+		gate := newTestGate(source, config.RateLimitConfig{Pause: 40 * time.Millisecond})
+		task := gate.begin("1")
+		start := task.start
+		source.set("etherscan", start)
+		gate.observe(task)
+
+		gate.wait(context.Background(), "1", "test task")
+		if waited := time.Since(start); waited < 40*time.Millisecond || waited > 10*time.Second {
+			t.Errorf("waited %s, want the 40ms pause", waited)
+		}
+	})
+
+	t.Run("not for other chains or without a pause", func(t *testing.T) {
+		source := &fakeRateLimits{}
+		gate := newTestGate(source, config.RateLimitConfig{Pause: time.Minute})
+		task := gate.begin("1")
+		start := task.start
+		source.set("etherscan", start)
+		gate.observe(task)
+
+		gate.wait(context.Background(), "10", "test task")
+		gate.limits.Pause = 0
+		gate.wait(context.Background(), "1", "test task")
+		var none *rateLimitGate
+		none.wait(context.Background(), "1", "test task")
+		if waited := time.Since(start); waited > 10*time.Second {
+			t.Errorf("waited %s, want no wait", waited)
+		}
+	})
+
+	t.Run("until ctx is done", func(t *testing.T) {
+		source := &fakeRateLimits{}
+		gate := newTestGate(source, config.RateLimitConfig{Pause: time.Minute})
+		task := gate.begin("1")
+		start := task.start
+		source.set("etherscan", start)
+		gate.observe(task)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		gate.wait(ctx, "1", "test task")
+		if waited := time.Since(start); waited > 10*time.Second {
+			t.Errorf("waited %s, want to stop with ctx", waited)
+		}
+	})
+}
+
+func TestOrderByRateLimits(t *testing.T) {
+	source := &fakeRateLimits{}
+	start := time.Now()
+	chains := []string{"1", "10", "137", "42161"}
+	id := func(chain string) string { return chain }
+
+	gate := newTestGate(source, config.RateLimitConfig{Pause: time.Minute})
+	for _, chain := range []string{"1", "137"} {
+		task := gate.begin(chain)
+		source.set("etherscan", task.start)
+		gate.observe(task)
+	}
+	if got := orderByRateLimits(gate, chains, id); !slices.Equal(got, chains) {
+		t.Errorf("order without reordering = %q, want %q", got, chains)
+	}
+
+	gate.limits.Reorder = true
+	if got, want := orderByRateLimits(gate, chains, id), []string{"10", "42161", "1", "137"}; !slices.Equal(got, want) {
+		t.Errorf("order = %q, want %q", got, want)
+	}
+
+	source.set("etherscan", start.Add(-time.Hour))
+	if got := orderByRateLimits(gate, chains, id); !slices.Equal(got, chains) {
+		t.Errorf("order once the provider cleared = %q, want %q", got, chains)
+	}
+}
@@ -1,8 +1,12 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 )
 
 // OpStats counts the per-item outcome of a sync step that loops over many
@@ -10,13 +14,83 @@ import (
 type OpStats struct {
 	Ok     int
 	Failed int
+	// TimedOut counts items given up on at a time limit (see timedOut); they
+	// are not Failed.
+	TimedOut int
+	// Items times every attempted item, in attempt order.
+	Items []ItemTiming
 }
 
 // Total returns the number of items the step attempted.
-func (s OpStats) Total() int { return s.Ok + s.Failed }
+func (s OpStats) Total() int { return s.Ok + s.Failed + s.TimedOut }
+
+// record counts one attempted item as ok, failed or timed out by err and times
+// it from start.
+func (s *OpStats) record(name string, start time.Time, err error) {
+	item := ItemTiming{Name: name, Duration: time.Since(start)}
+	switch {
+	case err == nil:
+		s.Ok++
+	case timedOut(err):
+		s.TimedOut++
+		item.TimedOut = true
+	default:
+		s.Failed++
+		item.Failed = true
+	}
+	s.Items = append(s.Items, item)
+}
+
+// add merges the counts and items of other into s.
+func (s *OpStats) add(other OpStats) {
+	s.Ok += other.Ok
+	s.Failed += other.Failed
+	s.TimedOut += other.TimedOut
+	s.Items = append(s.Items, other.Items...)
+}
+
+// counts renders the item counts for summaries, mentioning timeouts only when
+// there were any.
+func (s OpStats) counts() string {
+	if s.TimedOut > 0 {
+		return fmt.Sprintf("%d ok / %d failed / %d timed out", s.Ok, s.Failed, s.TimedOut)
+	}
+	return fmt.Sprintf("%d ok / %d failed", s.Ok, s.Failed)
+}
+
+// timedOut reports whether err is a time limit running out: the step's
+// (timeouts.steps) or its async task's (timeouts.task).
+func timedOut(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// ItemTiming is the wall-clock time one item took: an account fetch, a chain
+// decode, or an async task.
+type ItemTiming struct {
+	Name     string
+	Duration time.Duration
+	Failed   bool
+	TimedOut bool
+}
+
+// SlowestItems is how many of a step's slowest items and async tasks the
+// summary and the JSON report list.
+const SlowestItems = 5
+
+// slowest returns the n longest timings, longest first.
+func slowest(timings []ItemTiming, n int) []ItemTiming {
+	sorted := append([]ItemTiming(nil), timings...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Duration > sorted[j].Duration })
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
 
 // StepReport captures the outcome of a single sync step for one user.
 type StepReport struct {
+	// ID is the step id used for selection (e.g. "evm-fetch").
+	ID string
 	// Step is a stable, human-readable name (e.g. "EVM fetch").
 	Step string
 	// Core marks steps whose total failure means the run did not do its job.
@@ -27,37 +101,150 @@ type StepReport struct {
 	Stats OpStats
 	// Err is set when the step could not run at all (setup failure) or aborted.
 	Err error
+	// Skipped marks a step disabled by the step selection. It never ran, so it
+	// is neither ok nor failed.
+	Skipped bool
+	// Resumed marks a skipped step that finished in the interrupted run this
+	// run resumed.
+	Resumed bool
+	// Interrupted marks a step cut short by Interrupt. Its failed items were
+	// most likely canceled, so it does not count as failed.
+	Interrupted bool
+	// TimedOut marks a step stopped by its time limit (timeouts.steps). Err
+	// says so; like timed-out items it is reported apart from failures.
+	TimedOut bool
+	// Duration is the wall-clock time the step took.
+	Duration time.Duration
+	// Tasks times the async tasks the step waited on.
+	Tasks []ItemTiming
+	// Polls counts the /tasks requests made while the step ran.
+	Polls int
+	// RateLimited is how long rotki-core was rate-limited by a remote
+	// provider while the step ran.
+	RateLimited time.Duration
 }
 
-// failed reports whether this step should be considered failed for summary and
+// Failed reports whether this step should be considered failed for summary and
 // exit-code purposes: it errored, or it is a core step that attempted work but
-// had zero successes.
-func (s StepReport) failed() bool {
-	if s.Err != nil {
+// had zero successes and some failures. Time limits running out are reported
+// by HasTimeouts instead.
+func (s StepReport) Failed() bool {
+	if s.Interrupted {
+		return false
+	}
+	if s.Err != nil && !s.TimedOut {
 		return true
 	}
-	if s.Core && s.Stats.Total() > 0 && s.Stats.Ok == 0 {
+	if s.Core && s.Stats.Ok == 0 && s.Stats.Failed > 0 {
 		return true
 	}
 	return false
 }
 
+// HasTimeouts reports whether the step ran into its own time limit or gave
+// up on items at theirs.
+func (s StepReport) HasTimeouts() bool {
+	return !s.Interrupted && (s.TimedOut || s.Stats.TimedOut > 0)
+}
+
+// finished reports whether a resume has nothing left to redo for the step:
+// it was skipped, or it ran without an error, failed or timed-out items.
+func (s StepReport) finished() bool {
+	return s.Skipped || (s.Err == nil && s.Stats.Failed == 0 && s.Stats.TimedOut == 0)
+}
+
 // UserReport aggregates the step outcomes for a single user.
 type UserReport struct {
-	Username string
-	Steps    []StepReport
+	Username   string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Steps      []StepReport
+	// Interrupted is set when the run was interrupted before every step of
+	// the user ran.
+	Interrupted bool
 }
 
 func (u *UserReport) add(step StepReport) {
 	u.Steps = append(u.Steps, step)
 }
 
+// Failed reports whether any step for this user failed.
+func (u *UserReport) Failed() bool {
+	for _, step := range u.Steps {
+		if step.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTimeouts reports whether any step for this user ran into a time limit.
+func (u *UserReport) HasTimeouts() bool {
+	for _, step := range u.Steps {
+		if step.HasTimeouts() {
+			return true
+		}
+	}
+	return false
+}
+
+// finished reports whether every step of the user finished (see
+// StepReport.finished).
+func (u *UserReport) finished() bool {
+	if u.Interrupted {
+		return false
+	}
+	for _, step := range u.Steps {
+		if !step.finished() {
+			return false
+		}
+	}
+	return true
+}
+
 // RunReport aggregates the outcome of an entire sync run across all users.
 type RunReport struct {
+	// ID identifies the run; it is a UTC timestamp of the start, so ids sort
+	// chronologically.
+	ID         string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// Scope is the config.ScopeKey of the rotki data the run synced, so runs
+	// against different data dirs or backends can be told apart.
+	Scope string
+	// CoreVersion is the rotki-core version the run synced against, when known.
+	CoreVersion string
+	// ResumedFrom is the id of the interrupted run this run resumed, if any.
+	// Users that run finished are not part of this report.
+	ResumedFrom string
+
 	Users []UserReport
 	// FatalErr is set when a contract break (e.g. a removed endpoint) aborted
 	// the run. It is distinct from ordinary per-item failures.
 	FatalErr error
+	// Interrupted is why the run was stopped early (see
+	// SyncService.Interrupt), or "" when it ran to the end.
+	Interrupted string
+	// Polls counts the /tasks requests made during the run, including those
+	// for logins outside any step.
+	Polls int
+	// RateLimited is how long rotki-core was rate-limited by a remote
+	// provider during the run.
+	RateLimited time.Duration
+}
+
+// runIDLayout formats a run start time into a run id.
+const runIDLayout = "20060102T150405Z"
+
+// NewRunReport starts an empty report for a run beginning now.
+func NewRunReport() *RunReport {
+	now := time.Now().UTC()
+	return &RunReport{ID: now.Format(runIDLayout), StartedAt: now}
+}
+
+// Finish stamps the end of the run.
+func (r *RunReport) Finish() {
+	r.FinishedAt = time.Now().UTC()
 }
 
 func (r *RunReport) add(user UserReport) {
@@ -69,14 +256,39 @@ func (r *RunReport) HasFailures() bool {
 	if r.FatalErr != nil {
 		return true
 	}
+	for _, user := range r.Users {
+		if user.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTimeouts reports whether any step in the run ran into a time limit.
+func (r *RunReport) HasTimeouts() bool {
+	for _, user := range r.Users {
+		if user.HasTimeouts() {
+			return true
+		}
+	}
+	return false
+}
+
+// timeouts counts the steps that ran into their time limit and the items
+// given up on at theirs.
+func (r *RunReport) timeouts() (steps, items int) {
 	for _, user := range r.Users {
 		for _, step := range user.Steps {
-			if step.failed() {
-				return true
+			if step.Interrupted {
+				continue
+			}
+			if step.TimedOut {
+				steps++
 			}
+			items += step.Stats.TimedOut
 		}
 	}
-	return false
+	return steps, items
 }
 
 // Summary renders a multi-line, human-readable summary of the run suitable for
@@ -84,29 +296,81 @@ func (r *RunReport) HasFailures() bool {
 func (r *RunReport) Summary() string {
 	var b strings.Builder
 	b.WriteString("Sync run summary:")
+	if r.ResumedFrom != "" {
+		fmt.Fprintf(&b, " (resumed run %s)", r.ResumedFrom)
+	}
 
 	if r.FatalErr != nil {
 		fmt.Fprintf(&b, "\n  FATAL: %v", r.FatalErr)
 	}
+	if r.Interrupted != "" {
+		fmt.Fprintf(&b, "\n  INTERRUPTED: %s; continue with --resume", r.Interrupted)
+	}
+	if steps, items := r.timeouts(); steps+items > 0 {
+		fmt.Fprintf(&b, "\n  TIMED OUT: %d step(s) and %d item(s) ran into their time limit", steps, items)
+	}
 
 	for _, user := range r.Users {
 		fmt.Fprintf(&b, "\n  user %s:", user.Username)
 		for _, step := range user.Steps {
 			marker := "ok"
-			if step.failed() {
+			if step.Interrupted {
+				marker = "interrupted"
+			} else if step.Failed() {
 				marker = "FAILED"
+			} else if step.HasTimeouts() {
+				marker = "TIMED OUT"
 			}
 			switch {
+			case step.Resumed:
+				fmt.Fprintf(&b, "\n    [resumed] %s: finished before the interruption", step.Step)
+			case step.Skipped:
+				fmt.Fprintf(&b, "\n    [skipped] %s", step.Step)
 			case step.Err != nil:
 				fmt.Fprintf(&b, "\n    [%s] %s: %v", marker, step.Step, step.Err)
+				if step.TimedOut && step.Stats.Total() > 0 {
+					fmt.Fprintf(&b, " (%s)", step.Stats.counts())
+				}
 			case step.Stats.Total() > 0:
-				fmt.Fprintf(&b, "\n    [%s] %s: %d ok / %d failed",
-					marker, step.Step, step.Stats.Ok, step.Stats.Failed)
+				fmt.Fprintf(&b, "\n    [%s] %s: %s", marker, step.Step, step.Stats.counts())
 			default:
 				fmt.Fprintf(&b, "\n    [%s] %s", marker, step.Step)
 			}
+			if step.Skipped {
+				continue
+			}
+			if step.Duration > 0 {
+				fmt.Fprintf(&b, " (%s", step.Duration.Round(time.Second))
+				if step.Polls > 0 {
+					fmt.Fprintf(&b, ", %d polls", step.Polls)
+				}
+				if step.RateLimited > 0 {
+					fmt.Fprintf(&b, ", rate-limited %s", step.RateLimited.Round(time.Second))
+				}
+				b.WriteString(")")
+			}
+			writeTimings(&b, "slowest items", step.Stats.Items)
+			writeTimings(&b, "slowest tasks", step.Tasks)
 		}
 	}
+	if r.Polls > 0 {
+		fmt.Fprintf(&b, "\n  polled /tasks %d time(s)", r.Polls)
+	}
+	if r.RateLimited > 0 {
+		fmt.Fprintf(&b, "\n  rate-limited by remote providers for %s", r.RateLimited.Round(time.Second))
+	}
 
 	return b.String()
 }
+
+// writeTimings appends the slowest timings as one indented summary line.
+func writeTimings(b *strings.Builder, label string, timings []ItemTiming) {
+	if len(timings) == 0 {
+		return
+	}
+	parts := make([]string, 0, SlowestItems)
+	for _, t := range slowest(timings, SlowestItems) {
+		parts = append(parts, fmt.Sprintf("%s %s", t.Name, t.Duration.Round(time.Second)))
+	}
+	fmt.Fprintf(b, "\n      %s: %s", label, strings.Join(parts, ", "))
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/utils"
+)
+
+// ReportSchemaVersion is bumped whenever a ReportDocument field is renamed or
+// removed, so consumers can tell layouts apart. Adding fields does not bump it.
+const ReportSchemaVersion = 1
+
+// Status values used in report documents.
+const (
+	StatusOK          = "ok"
+	StatusFailed      = "failed"
+	StatusSkipped     = "skipped"
+	StatusAborted     = "aborted"
+	StatusInterrupted = "interrupted"
+	StatusTimedOut    = "timed_out"
+)
+
+// ReportDocument is the machine-readable form of a RunReport, written as JSON
+// after every run for dashboards to ingest.
+type ReportDocument struct {
+	SchemaVersion   int       `json:"schema_version"`
+	ID              string    `json:"id"`
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Scope           string    `json:"scope,omitempty"`
+	CoreVersion     string    `json:"core_version,omitempty"`
+	ResumedFrom     string    `json:"resumed_from,omitempty"`
+	Status          string    `json:"status"`
+	FatalError      string    `json:"fatal_error,omitempty"`
+	Interrupted     string    `json:"interrupted,omitempty"`
+	Polls           int       `json:"polls"`
+	// RateLimitedSeconds is how long rotki-core was rate-limited by a remote
+	// provider during the run.
+	RateLimitedSeconds float64        `json:"rate_limited_seconds"`
+	Users              []UserDocument `json:"users"`
+}
+
+// UserDocument is the per-user section of a ReportDocument.
+type UserDocument struct {
+	Username        string         `json:"username"`
+	StartedAt       time.Time      `json:"started_at"`
+	FinishedAt      time.Time      `json:"finished_at"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	Status          string         `json:"status"`
+	Steps           []StepDocument `json:"steps"`
+}
+
+// StepDocument is the per-step section of a UserDocument.
+type StepDocument struct {
+	ID              string  `json:"id"`
+	Name            string  `json:"name"`
+	Core            bool    `json:"core"`
+	Status          string  `json:"status"`
+	Ok              int     `json:"ok"`
+	Failed          int     `json:"failed"`
+	TimedOut        int     `json:"timed_out"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Polls           int     `json:"polls"`
+	// RateLimitedSeconds is how long rotki-core was rate-limited by a remote
+	// provider while the step ran.
+	RateLimitedSeconds float64 `json:"rate_limited_seconds"`
+	Error              string  `json:"error,omitempty"`
+	// Resumed marks a skipped step that finished before the interruption of
+	// the resumed run.
+	Resumed bool `json:"resumed,omitempty"`
+	// SlowestItems and SlowestTasks list up to SlowestItems of the step's
+	// longest items (accounts, chains, queries) and async tasks.
+	SlowestItems []TimingDocument `json:"slowest_items,omitempty"`
+	SlowestTasks []TimingDocument `json:"slowest_tasks,omitempty"`
+}
+
+// TimingDocument is one timed item of a StepDocument.
+type TimingDocument struct {
+	Name            string  `json:"name"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Failed          bool    `json:"failed,omitempty"`
+	TimedOut        bool    `json:"timed_out,omitempty"`
+}
+
+// Document converts the report into its JSON form.
+func (r *RunReport) Document() ReportDocument {
+	doc := ReportDocument{
+		SchemaVersion:      ReportSchemaVersion,
+		ID:                 r.ID,
+		StartedAt:          r.StartedAt,
+		FinishedAt:         r.FinishedAt,
+		DurationSeconds:    seconds(r.FinishedAt.Sub(r.StartedAt)),
+		Scope:              r.Scope,
+		CoreVersion:        r.CoreVersion,
+		ResumedFrom:        r.ResumedFrom,
+		Status:             StatusOK,
+		Interrupted:        r.Interrupted,
+		Polls:              r.Polls,
+		RateLimitedSeconds: seconds(r.RateLimited),
+		Users:              make([]UserDocument, 0, len(r.Users)),
+	}
+	switch {
+	case r.FatalErr != nil:
+		doc.Status = StatusAborted
+		doc.FatalError = r.FatalErr.Error()
+	case r.Interrupted != "":
+		doc.Status = StatusInterrupted
+	case r.HasFailures():
+		doc.Status = StatusFailed
+	case r.HasTimeouts():
+		doc.Status = StatusTimedOut
+	}
+
+	for _, user := range r.Users {
+		userDoc := UserDocument{
+			Username:        user.Username,
+			StartedAt:       user.StartedAt,
+			FinishedAt:      user.FinishedAt,
+			DurationSeconds: seconds(user.FinishedAt.Sub(user.StartedAt)),
+			Status:          StatusOK,
+			Steps:           make([]StepDocument, 0, len(user.Steps)),
+		}
+		switch {
+		case user.Failed():
+			userDoc.Status = StatusFailed
+		case !user.finished() && r.Interrupted != "":
+			userDoc.Status = StatusInterrupted
+		case user.HasTimeouts():
+			userDoc.Status = StatusTimedOut
+		}
+		for _, step := range user.Steps {
+			userDoc.Steps = append(userDoc.Steps, step.document())
+		}
+		doc.Users = append(doc.Users, userDoc)
+	}
+	return doc
+}
+
+// document converts the step into its JSON form.
+func (s StepReport) document() StepDocument {
+	doc := StepDocument{
+		ID:                 s.ID,
+		Name:               s.Step,
+		Core:               s.Core,
+		Status:             StatusOK,
+		Ok:                 s.Stats.Ok,
+		Failed:             s.Stats.Failed,
+		TimedOut:           s.Stats.TimedOut,
+		DurationSeconds:    seconds(s.Duration),
+		Polls:              s.Polls,
+		RateLimitedSeconds: seconds(s.RateLimited),
+		Resumed:            s.Resumed,
+		SlowestItems:       timingDocuments(s.Stats.Items),
+		SlowestTasks:       timingDocuments(s.Tasks),
+	}
+	switch {
+	case s.Skipped:
+		doc.Status = StatusSkipped
+	case s.Interrupted:
+		doc.Status = StatusInterrupted
+	case s.Failed():
+		doc.Status = StatusFailed
+	case s.HasTimeouts():
+		doc.Status = StatusTimedOut
+	}
+	if s.Err != nil {
+		doc.Error = s.Err.Error()
+	}
+	return doc
+}
+
+// timingDocuments renders the slowest timings, or nil when there are none.
+func timingDocuments(timings []ItemTiming) []TimingDocument {
+	if len(timings) == 0 {
+		return nil
+	}
+	var docs []TimingDocument
+	for _, t := range slowest(timings, SlowestItems) {
+		docs = append(docs, TimingDocument{
+			Name: t.Name, DurationSeconds: seconds(t.Duration), Failed: t.Failed, TimedOut: t.TimedOut,
+		})
+	}
+	return docs
+}
+
+// seconds renders a duration as fractional seconds, rounded to milliseconds.
+func seconds(d time.Duration) float64 {
+	if d < 0 {
+		return 0
+	}
+	return d.Round(time.Millisecond).Seconds()
+}
+
+// WriteJSON writes the report document to path atomically, creating its
+// directory, so a reader never sees a partial document.
+func (r *RunReport) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(r.Document(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run report: %w", err)
+	}
+	data = append(data, '\n')
+
+	if err := utils.WriteFileAtomic(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write run report: %w", err)
+	}
+	return nil
+}
+
+// ReportFileName is the name of a run's report in the reports directory.
+func ReportFileName(id string) string {
+	return "run-" + id + ".json"
+}
+
+// PruneReports deletes all but the newest keep run reports in dir. Report
+// names embed the run id, which sorts chronologically. It is best-effort;
+// keep <= 0 disables pruning.
+func PruneReports(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, ReportFileName("*")))
+	if err != nil || len(matches) <= keep {
+		return err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(matches)))
+	for _, path := range matches[keep:] {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
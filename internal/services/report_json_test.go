@@ -0,0 +1,119 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunReportDocument(t *testing.T) {
+	start := time.Date(2026, 1, 2, 9, 30, 0, 0, time.UTC)
+	report := &RunReport{
+		ID:          "20260102T093000Z",
+		StartedAt:   start,
+		FinishedAt:  start.Add(90 * time.Second),
+		CoreVersion: "1.43.2",
+		Users: []UserReport{{
+			Username:   "alice",
+			StartedAt:  start,
+			FinishedAt: start.Add(80 * time.Second),
+			Steps: []StepReport{
+				{ID: StepSnapshot, Step: "balance snapshot", Skipped: true},
+				{ID: StepEvmFetch, Step: "EVM transaction fetch", Core: true, Stats: OpStats{Failed: 3}, Duration: 1500 * time.Millisecond},
+				{ID: StepOnlineEvents, Step: "online events fetch", Err: errors.New("boom")},
+			},
+		}},
+	}
+
+	doc := report.Document()
+	if doc.Status != StatusFailed {
+		t.Errorf("Status = %q, want failed", doc.Status)
+	}
+	if doc.DurationSeconds != 90 {
+		t.Errorf("DurationSeconds = %v, want 90", doc.DurationSeconds)
+	}
+	if doc.CoreVersion != "1.43.2" || doc.ID != report.ID {
+		t.Errorf("header = %+v", doc)
+	}
+
+	user := doc.Users[0]
+	if user.Status != StatusFailed {
+		t.Errorf("user Status = %q, want failed", user.Status)
+	}
+	wantSteps := []struct {
+		status string
+		err    string
+	}{
+		{StatusSkipped, ""},
+		{StatusFailed, ""},
+		{StatusFailed, "boom"},
+	}
+	for i, want := range wantSteps {
+		got := user.Steps[i]
+		if got.Status != want.status || got.Error != want.err {
+			t.Errorf("step %d = %+v, want status %q error %q", i, got, want.status, want.err)
+		}
+	}
+	if user.Steps[1].DurationSeconds != 1.5 || user.Steps[1].Failed != 3 {
+		t.Errorf("evm fetch step = %+v", user.Steps[1])
+	}
+
+	report.FatalErr = errors.New("endpoint gone")
+	if doc := report.Document(); doc.Status != StatusAborted || doc.FatalError != "endpoint gone" {
+		t.Errorf("aborted doc = %+v", doc)
+	}
+}
+
+func TestRunReportWriteJSON(t *testing.T) {
+	report := NewRunReport()
+	report.Finish()
+
+	path := filepath.Join(t.TempDir(), "nested", "report.json")
+	if err := report.WriteJSON(path); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc ReportDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("report is not valid JSON: %v", err)
+	}
+	if doc.ID != report.ID || doc.Status != StatusOK || doc.SchemaVersion != ReportSchemaVersion {
+		t.Errorf("decoded doc = %+v", doc)
+	}
+	if doc.Users == nil {
+		t.Error("users must encode as [] rather than null")
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*.tmp-*"))
+	if len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestPruneReports(t *testing.T) {
+	dir := t.TempDir()
+	ids := []string{"20260101T000000Z", "20260102T000000Z", "20260103T000000Z"}
+	for _, id := range ids {
+		if err := os.WriteFile(filepath.Join(dir, ReportFileName(id)), []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := PruneReports(dir, 2); err != nil {
+		t.Fatalf("PruneReports: %v", err)
+	}
+	remaining, _ := filepath.Glob(filepath.Join(dir, "run-*.json"))
+	if len(remaining) != 2 {
+		t.Fatalf("remaining = %v, want 2 reports", remaining)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ReportFileName(ids[0]))); !os.IsNotExist(err) {
+		t.Error("oldest report should have been pruned")
+	}
+}
@@ -1,9 +1,12 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestRunReportHasFailures(t *testing.T) {
@@ -58,6 +61,16 @@ func TestRunReportHasFailures(t *testing.T) {
 			report: RunReport{FatalErr: errors.New("contract break")},
 			want:   true,
 		},
+		{
+			name: "core step whose items all timed out is not a failure",
+			report: RunReport{Users: []UserReport{{
+				Username: "alice",
+				Steps: []StepReport{
+					{Step: "EVM transaction decode", Core: true, Stats: OpStats{TimedOut: 2}},
+				},
+			}}},
+			want: false,
+		},
 		{
 			name: "core step with no work attempted is not a failure",
 			report: RunReport{Users: []UserReport{{
@@ -99,3 +112,176 @@ func TestRunReportSummary(t *testing.T) {
 		t.Errorf("summary should mark the failed step: %q", summary)
 	}
 }
+
+func TestRunReportSummarySkippedStep(t *testing.T) {
+	report := RunReport{Users: []UserReport{{
+		Username: "alice",
+		Steps: []StepReport{
+			{ID: StepTokenDetection, Step: "token detection", Skipped: true},
+			{ID: StepEvmFetch, Step: "EVM transaction fetch", Core: true, Stats: OpStats{Ok: 4}},
+		},
+	}}}
+
+	if report.HasFailures() {
+		t.Error("a skipped step must not count as a failure")
+	}
+	if summary := report.Summary(); !strings.Contains(summary, "[skipped] token detection") {
+		t.Errorf("summary should list the skipped step: %q", summary)
+	}
+}
+
+func TestOpStatsRecord(t *testing.T) {
+	var stats OpStats
+	start := time.Now().Add(-2 * time.Second)
+	stats.record("ethereum 0xabc", start, nil)
+	stats.record("optimism 0xdef", start, errors.New("boom"))
+
+	if stats.Ok != 1 || stats.Failed != 1 {
+		t.Fatalf("stats = %+v, want 1 ok / 1 failed", stats)
+	}
+	if len(stats.Items) != 2 || stats.Items[1].Name != "optimism 0xdef" || !stats.Items[1].Failed {
+		t.Fatalf("items = %+v", stats.Items)
+	}
+	if stats.Items[0].Duration < 2*time.Second {
+		t.Errorf("duration = %v, want >= 2s", stats.Items[0].Duration)
+	}
+
+	stats.record("gnosis", start, fmt.Errorf("async task 7: %w", context.DeadlineExceeded))
+	if stats.TimedOut != 1 || stats.Failed != 1 || stats.Total() != 3 {
+		t.Fatalf("stats = %+v, want the timeout counted apart from failures", stats)
+	}
+	if item := stats.Items[2]; !item.TimedOut || item.Failed {
+		t.Errorf("item = %+v, want timed out, not failed", item)
+	}
+}
+
+func TestRunReportSummaryTimedOutItems(t *testing.T) {
+	report := RunReport{Users: []UserReport{{
+		Username: "alice",
+		Steps: []StepReport{
+			{Step: "EVM transaction decode", Core: true, Stats: OpStats{Ok: 2, TimedOut: 1}},
+			{Step: "EVM transaction fetch", Core: true, Stats: OpStats{Ok: 4}},
+		},
+	}}}
+
+	if report.HasFailures() || !report.HasTimeouts() {
+		t.Fatalf("HasFailures = %v, HasTimeouts = %v; want only a timeout",
+			report.HasFailures(), report.HasTimeouts())
+	}
+	summary := report.Summary()
+	for _, want := range []string{
+		"TIMED OUT: 0 step(s) and 1 item(s) ran into their time limit",
+		"[TIMED OUT] EVM transaction decode: 2 ok / 0 failed / 1 timed out",
+		"[ok] EVM transaction fetch: 4 ok / 0 failed",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary missing %q:\n%s", want, summary)
+		}
+	}
+
+	doc := report.Document()
+	if doc.Status != StatusTimedOut || doc.Users[0].Status != StatusTimedOut {
+		t.Errorf("run/user status = %q/%q, want timed_out", doc.Status, doc.Users[0].Status)
+	}
+	if step := doc.Users[0].Steps[0]; step.Status != StatusTimedOut || step.TimedOut != 1 {
+		t.Errorf("step = %+v, want status timed_out with 1 timed-out item", step)
+	}
+}
+
+func TestSlowest(t *testing.T) {
+	timings := []ItemTiming{
+		{Name: "a", Duration: time.Second},
+		{Name: "b", Duration: 3 * time.Second},
+		{Name: "c", Duration: 2 * time.Second},
+	}
+	got := slowest(timings, 2)
+	if len(got) != 2 || got[0].Name != "b" || got[1].Name != "c" {
+		t.Fatalf("slowest = %+v, want b then c", got)
+	}
+	if timings[0].Name != "a" {
+		t.Error("slowest must not reorder its input")
+	}
+}
+
+func TestRunReportSummaryTimings(t *testing.T) {
+	report := &RunReport{Users: []UserReport{{
+		Username: "alice",
+		Steps: []StepReport{{
+			ID: StepEvmDecode, Step: "EVM transaction decode", Core: true,
+			Stats: OpStats{Ok: 2, Items: []ItemTiming{
+				{Name: "ethereum", Duration: 40 * time.Minute},
+				{Name: "optimism", Duration: time.Minute},
+			}},
+			Duration: 41 * time.Minute,
+			Tasks:    []ItemTiming{{Name: "task 7 POST /blockchains/transactions/decode", Duration: 40 * time.Minute}},
+		}},
+	}}}
+
+	summary := report.Summary()
+	for _, want := range []string{
+		"EVM transaction decode: 2 ok / 0 failed (41m0s)",
+		"slowest items: ethereum 40m0s, optimism 1m0s",
+		"slowest tasks: task 7 POST /blockchains/transactions/decode 40m0s",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary missing %q:\n%s", want, summary)
+		}
+	}
+}
+
+func TestRunReportRateLimited(t *testing.T) {
+	report := &RunReport{
+		RateLimited: 95 * time.Second,
+		Users: []UserReport{{
+			Username: "alice",
+			Steps: []StepReport{{
+				ID: StepEvmFetch, Step: "EVM transaction fetch", Core: true,
+				Stats: OpStats{Ok: 3}, Duration: 10 * time.Minute, Polls: 12, RateLimited: 90 * time.Second,
+			}},
+		}},
+	}
+
+	summary := report.Summary()
+	for _, want := range []string{
+		"EVM transaction fetch: 3 ok / 0 failed (10m0s, 12 polls, rate-limited 1m30s)",
+		"rate-limited by remote providers for 1m35s",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary missing %q:\n%s", want, summary)
+		}
+	}
+
+	doc := report.Document()
+	if doc.RateLimitedSeconds != 95 || doc.Users[0].Steps[0].RateLimitedSeconds != 90 {
+		t.Errorf("document rate-limited = %v, step rate-limited = %v; want 95 and 90",
+			doc.RateLimitedSeconds, doc.Users[0].Steps[0].RateLimitedSeconds)
+	}
+}
+
+func TestRunReportPolls(t *testing.T) {
+	report := &RunReport{
+		Polls: 31,
+		Users: []UserReport{{
+			Username: "alice",
+			Steps: []StepReport{{
+				ID: StepEvmDecode, Step: "EVM transaction decode", Core: true,
+				Stats: OpStats{Ok: 2}, Duration: 41 * time.Minute, Polls: 27,
+			}},
+		}},
+	}
+
+	summary := report.Summary()
+	for _, want := range []string{
+		"EVM transaction decode: 2 ok / 0 failed (41m0s, 27 polls)",
+		"polled /tasks 31 time(s)",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary missing %q:\n%s", want, summary)
+		}
+	}
+
+	doc := report.Document()
+	if doc.Polls != 31 || doc.Users[0].Steps[0].Polls != 27 {
+		t.Errorf("document polls = %d, step polls = %d; want 31 and 27", doc.Polls, doc.Users[0].Steps[0].Polls)
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/checkpoint"
+	"github.com/kelsos/rotki-sync/internal/logger"
+)
+
+// runCheckpoint records the progress of a run so an interrupted one can be
+// resumed. It remembers the user and step in progress so finished items are
+// attributed without threading them through every call. A nil checkpoint
+// records nothing and treats everything as unfinished.
+type runCheckpoint struct {
+	store *checkpoint.Checkpoint
+	// target is the rotki data this run syncs (see config.Config.Target); a
+	// checkpoint recorded against other data is not resumed.
+	target string
+
+	mu   sync.Mutex
+	user string
+	step string
+}
+
+// begin starts a run and returns the id of the interrupted run it resumes, or
+// "" for a new run. Unless resume is set and an interrupted run against the
+// same rotki data was recorded, earlier progress is discarded, on disk too,
+// so a later --resume cannot pick up a run that is no longer the latest.
+func (c *runCheckpoint) begin(resume bool, runID string, startedAt time.Time) string {
+	if c == nil {
+		return ""
+	}
+	switch {
+	case resume && !c.store.Empty() && c.store.Target() != c.target:
+		logger.Warn("Not resuming run %s: it synced %s, this run syncs %s; starting a full run",
+			c.store.RunID(), c.store.Target(), c.target)
+	case resume && !c.store.Empty():
+		resumed := c.store.RunID()
+		logger.Info("Resuming interrupted run %s", resumed)
+		return resumed
+	case resume:
+		logger.Info("No interrupted run to resume; starting a full run")
+	}
+	c.warn(c.store.Reset(runID, startedAt, c.target))
+	return ""
+}
+
+// enter sets the user and step that finished items belong to.
+func (c *runCheckpoint) enter(username, step string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.user, c.step = username, step
+	c.mu.Unlock()
+}
+
+func (c *runCheckpoint) current() (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.user, c.step
+}
+
+// userDone reports whether username finished in the resumed run.
+func (c *runCheckpoint) userDone(username string) bool {
+	return c != nil && c.store.UserDone(username)
+}
+
+// stepDone reports whether the current step finished in the resumed run.
+func (c *runCheckpoint) stepDone() bool {
+	if c == nil {
+		return false
+	}
+	user, step := c.current()
+	return c.store.StepDone(user, step)
+}
+
+// pending reports whether item of the current step still has to be done.
+func (c *runCheckpoint) pending(item string) bool {
+	if c == nil {
+		return true
+	}
+	user, step := c.current()
+	return !c.store.ItemDone(user, step, item)
+}
+
+// itemDone records that item of the current step finished.
+func (c *runCheckpoint) itemDone(item string) {
+	if c == nil {
+		return
+	}
+	user, step := c.current()
+	c.warn(c.store.MarkItem(user, step, item))
+}
+
+// stepFinished records that the current step finished.
+func (c *runCheckpoint) stepFinished() {
+	if c == nil {
+		return
+	}
+	user, step := c.current()
+	c.warn(c.store.MarkStep(user, step))
+}
+
+// userFinished records that every step of username finished.
+func (c *runCheckpoint) userFinished(username string) {
+	if c == nil {
+		return
+	}
+	c.warn(c.store.MarkUser(username))
+}
+
+// finish discards the checkpoint of a run that completed.
+func (c *runCheckpoint) finish() {
+	if c == nil {
+		return
+	}
+	c.warn(c.store.Remove())
+}
+
+// warn logs a checkpoint write failure. It only costs redoing work on a
+// resume, so it does not fail the run.
+func (c *runCheckpoint) warn(err error) {
+	if err != nil {
+		logger.Warn("Failed to update the run checkpoint: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/checkpoint"
+)
+
+func TestRunCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	started := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	first := &runCheckpoint{store: checkpoint.New(path)}
+	if resumed := first.begin(false, "run-1", started); resumed != "" {
+		t.Fatalf("a new run resumed %q", resumed)
+	}
+	first.enter("alice", StepSnapshot)
+	first.stepFinished()
+	first.enter("alice", StepEvmFetch)
+	first.itemDone("eth 0xa")
+	// interrupted here
+
+	store, err := checkpoint.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := &runCheckpoint{store: store}
+	if resumed := second.begin(true, "run-2", started.Add(time.Hour)); resumed != "run-1" {
+		t.Fatalf("resumed = %q, want run-1", resumed)
+	}
+
+	tests := []struct {
+		step     string
+		stepDone bool
+		item     string
+		pending  bool
+	}{
+		{StepSnapshot, true, "", true},
+		{StepEvmFetch, false, "eth 0xa", false},
+		{StepEvmFetch, false, "eth 0xb", true},
+		{StepEvmDecode, false, "eth", true},
+	}
+	for _, tt := range tests {
+		second.enter("alice", tt.step)
+		if got := second.stepDone(); got != tt.stepDone {
+			t.Errorf("%s stepDone = %v, want %v", tt.step, got, tt.stepDone)
+		}
+		if tt.item != "" && second.pending(tt.item) != tt.pending {
+			t.Errorf("%s pending(%s) = %v, want %v", tt.step, tt.item, !tt.pending, tt.pending)
+		}
+	}
+
+	second.enter("bob", StepSnapshot)
+	if second.stepDone() {
+		t.Error("users should not share progress")
+	}
+
+	second.userFinished("alice")
+	if !second.userDone("alice") {
+		t.Error("alice should be done")
+	}
+	second.finish()
+	if store, err = checkpoint.Open(path); err != nil || !store.Empty() {
+		t.Errorf("finished run left a checkpoint (err %v)", err)
+	}
+}
+
+func TestRunCheckpointRefusesOtherTarget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	started := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	first := &runCheckpoint{store: checkpoint.New(path), target: "data dir /data/a"}
+	first.begin(false, "run-1", started)
+	first.userFinished("alice")
+
+	store, err := checkpoint.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := &runCheckpoint{store: store, target: "data dir /data/b"}
+	if resumed := second.begin(true, "run-2", started.Add(time.Hour)); resumed != "" {
+		t.Fatalf("resumed %q recorded against another data dir", resumed)
+	}
+	if second.userDone("alice") {
+		t.Error("progress against another data dir must not be reused")
+	}
+}
+
+func TestNewRunDiscardsCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	started := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	first := &runCheckpoint{store: checkpoint.New(path), target: "data dir /data/a"}
+	first.begin(false, "run-1", started)
+	first.userFinished("alice")
+
+	// A run without --resume that records nothing, e.g. one failing at login.
+	store, err := checkpoint.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := &runCheckpoint{store: store, target: "data dir /data/a"}
+	second.begin(false, "run-2", started.Add(time.Hour))
+
+	if store, err = checkpoint.Open(path); err != nil || !store.Empty() {
+		t.Fatalf("run-1's checkpoint outlived a newer run (err %v, run %q)", err, store.RunID())
+	}
+}
+
+func TestRunCheckpointResumeWithoutCheckpoint(t *testing.T) {
+	c := &runCheckpoint{store: checkpoint.New(filepath.Join(t.TempDir(), "checkpoint.json"))}
+	if resumed := c.begin(true, "run-1", time.Now()); resumed != "" {
+		t.Errorf("resumed = %q with nothing to resume", resumed)
+	}
+}
+
+func TestNilRunCheckpoint(t *testing.T) {
+	var c *runCheckpoint
+	if c.begin(true, "run-1", time.Now()) != "" {
+		t.Error("nil checkpoint resumed a run")
+	}
+	c.enter("alice", StepEvmFetch)
+	if c.userDone("alice") || c.stepDone() || !c.pending("eth 0xa") {
+		t.Error("nil checkpoint should treat everything as unfinished")
+	}
+	c.itemDone("eth 0xa")
+	c.stepFinished()
+	c.userFinished("alice")
+	c.finish()
+}
+
+func TestSummaryMarksResumedSteps(t *testing.T) {
+	report := &RunReport{ResumedFrom: "run-1", Users: []UserReport{{
+		Username: "alice",
+		Steps:    []StepReport{{ID: StepSnapshot, Step: "balance snapshot", Skipped: true, Resumed: true}},
+	}}}
+	summary := report.Summary()
+	for _, want := range []string{"(resumed run run-1)", "[resumed] balance snapshot"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary missing %q:\n%s", want, summary)
+		}
+	}
+}
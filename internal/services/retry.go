@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/async"
+	"github.com/kelsos/rotki-sync/internal/client"
+	"github.com/kelsos/rotki-sync/internal/logger"
+	"github.com/kelsos/rotki-sync/internal/models"
+)
+
+// maxRetryDelay caps the wait between two attempts of an item.
+const maxRetryDelay = time.Minute
+
+// retryPolicy is how often, and how patiently, a step retries an item that
+// failed transiently (see retryable).
+type retryPolicy struct {
+	retries int
+	delay   time.Duration
+}
+
+type retryPolicyKey struct{}
+
+// withRetryPolicy returns a context under which retry follows policy.
+func withRetryPolicy(ctx context.Context, policy retryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, policy)
+}
+
+// retry runs op, the attempt at one item described by what, and runs it again
+// while it fails transiently, as often as the retry policy of ctx allows.
+// Without a policy op runs once. It returns the error of the last attempt; once
+// ctx is done no further attempt is made.
+func retry(ctx context.Context, what string, op func() error) error {
+	policy, _ := ctx.Value(retryPolicyKey{}).(retryPolicy)
+	err := op()
+	for n := 1; n <= policy.retries && retryable(err); n++ {
+		wait := retryBackoff(policy.delay, n)
+		logger.Warn("%s failed, retry %d of %d in %s: %v", what, n, policy.retries, wait.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		err = op()
+	}
+	return err
+}
+
+// retryBackoff returns the wait before retry n (from 1): delay doubled for
+// each earlier retry and capped at maxRetryDelay, of which a random part of
+// up to half is dropped so workers that failed together retry apart.
+func retryBackoff(delay time.Duration, n int) time.Duration {
+	backoff := delay
+	for i := 1; i < n && backoff < maxRetryDelay; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, maxRetryDelay)
+	if backoff < 2 {
+		return backoff
+	}
+	return backoff - rand.N(backoff/2)
+}
+
+// retryable reports whether err is a failure that may go away on its own: a
+// network error, a 408, 429 or 5xx (other than 501) answer to the request,
+// or a task that failed with such a status or a message saying so. A removed
+// endpoint, a feature the user has no access to, a time limit, an
+// interruption and any other failure are not retried.
+func retryable(err error) bool {
+	var contractBreak *ContractBreakError
+	switch {
+	case err == nil,
+		errors.As(err, &contractBreak),
+		client.IsEndpointMissing(err),
+		client.IsUnavailable(err),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, async.ErrCanceled):
+		return false
+	}
+
+	var httpErr *client.HTTPError
+	if errors.As(err, &httpErr) {
+		return transientStatus(httpErr.StatusCode)
+	}
+	var taskErr *models.TaskError
+	if errors.As(err, &taskErr) {
+		return transientStatus(taskErr.StatusCode) || transientMessage(taskErr.Message)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// transientStatus reports whether an HTTP status code asks to try again.
+func transientStatus(code int) bool {
+	switch {
+	case code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+		return true
+	case code == http.StatusNotImplemented:
+		return false
+	default:
+		return code >= 500
+	}
+}
+
+// transientMarkers are phrases of task failure messages about a remote
+// service that was overloaded or unreachable at the time.
+var transientMarkers = []string{
+	"rate limit",
+	"too many requests",
+	"timed out",
+	"timeout",
+	"temporarily",
+	"try again",
+	"connection",
+}
+
+// transientMessage reports whether a task failure message names a transient
+// cause (see transientMarkers).
+func transientMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, marker := range transientMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
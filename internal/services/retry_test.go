@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/async"
+	"github.com/kelsos/rotki-sync/internal/client"
+	"github.com/kelsos/rotki-sync/internal/models"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"no error", nil, false},
+		{"bad gateway", &client.HTTPError{StatusCode: 502}, true},
+		{"too many requests", fmt.Errorf("failed to initiate async request: %w", &client.HTTPError{StatusCode: 429}), true},
+		{"bad request", &client.HTTPError{StatusCode: 400}, false},
+		{"not implemented", &client.HTTPError{StatusCode: 501}, false},
+		{"payment required", &client.HTTPError{StatusCode: 402}, false},
+		{"removed endpoint", &client.HTTPError{StatusCode: 404}, false},
+		{"contract break", &ContractBreakError{Step: "EVM transaction fetch", Err: errors.New("gone")}, false},
+		{"task failed with 502", fmt.Errorf("async task 7: %w", &models.TaskError{StatusCode: 502, Message: "etherscan error"}), true},
+		{"task rate limited", &models.TaskError{StatusCode: 409, Message: "Got rate limited by etherscan"}, true},
+		{"task failed for good", &models.TaskError{StatusCode: 409, Message: "Given chain is not supported"}, false},
+		{"task reported a timeout", &models.TaskError{Message: "Request timed out"}, true},
+		{"connection refused", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"time limit", fmt.Errorf("async task 7: %w", context.DeadlineExceeded), false},
+		{"interrupted", fmt.Errorf("async task 7: %w", async.ErrCanceled), false},
+		{"other", errors.New("received nil response"), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := retryable(tc.err); got != tc.want {
+				t.Errorf("retryable(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{4, 16 * time.Second},
+		{10, maxRetryDelay},
+	}
+	for _, tc := range tests {
+		for range 20 {
+			got := retryBackoff(2*time.Second, tc.n)
+			if got <= tc.want/2 || got > tc.want {
+				t.Fatalf("retryBackoff(2s, %d) = %v, want within (%v, %v]", tc.n, got, tc.want/2, tc.want)
+			}
+		}
+	}
+	if got := retryBackoff(0, 3); got != 0 {
+		t.Errorf("retryBackoff(0, 3) = %v, want 0", got)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	transient := &client.HTTPError{StatusCode: 503}
+	tests := []struct {
+		name     string
+		policy   retryPolicy
+		failures []error
+		wantRuns int
+		wantErr  error
+	}{
+		{"succeeds after transient failures", retryPolicy{retries: 3, delay: time.Millisecond}, []error{transient, transient}, 3, nil},
+		{"gives up after the retries", retryPolicy{retries: 2, delay: time.Millisecond}, []error{transient, transient, transient, transient}, 3, transient},
+		{"does not retry a permanent failure", retryPolicy{retries: 3, delay: time.Millisecond}, []error{errors.New("bad address")}, 1, nil},
+		{"no policy runs once", retryPolicy{}, []error{transient}, 1, transient},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			runs := 0
+			err := retry(withRetryPolicy(context.Background(), tc.policy), "test item", func() error {
+				runs++
+				if runs <= len(tc.failures) {
+					return tc.failures[runs-1]
+				}
+				return nil
+			})
+			if runs != tc.wantRuns {
+				t.Errorf("ran %d times, want %d", runs, tc.wantRuns)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("err = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(withRetryPolicy(context.Background(), retryPolicy{retries: 5, delay: time.Hour}))
+	runs := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- retry(ctx, "test item", func() error {
+			runs++
+			return &client.HTTPError{StatusCode: 503}
+		})
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil || runs != 1 {
+			t.Errorf("err = %v after %d runs, want the first failure", err, runs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("retry kept waiting after the context was done")
+	}
+}
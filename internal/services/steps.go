@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/async"
+	"github.com/kelsos/rotki-sync/internal/config"
+	"github.com/kelsos/rotki-sync/internal/logger"
+)
+
+// Step ids name the sync steps for selection (--only/--skip and the [steps]
+// config table). They are stable identifiers, unlike the human-readable step
+// names shown in reports.
+const (
+	StepSnapshot       = "snapshot"
+	StepTokenDetection = "token-detection"
+	StepExchangeTrades = "exchange-trades"
+	StepOnlineEvents   = "online-events"
+	StepEvmFetch       = "evm-fetch"
+	StepNonEvmFetch    = "non-evm-fetch"
+	StepEvmDecode      = "evm-decode"
+	StepNonEvmDecode   = "non-evm-decode"
+)
+
+// StepIDs lists every step id in pipeline order.
+var StepIDs = []string{
+	StepSnapshot,
+	StepTokenDetection,
+	StepExchangeTrades,
+	StepOnlineEvents,
+	StepEvmFetch,
+	StepNonEvmFetch,
+	StepEvmDecode,
+	StepNonEvmDecode,
+}
+
+// ValidateStepSelection rejects a selection naming an unknown step, so a typo
+// in --only does not quietly turn a run into a no-op.
+func ValidateStepSelection(sel config.StepSelection) error {
+	unknown := unknownSteps(sel.Names())
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown step(s) %s; valid steps are: %s",
+			strings.Join(unknown, ", "), strings.Join(StepIDs, ", "))
+	}
+	return nil
+}
+
+// ValidateStepTimeouts rejects time limits for unknown steps, so a typo in
+// [timeouts.steps] or [timeouts.tasks] does not quietly leave a step
+// unbounded.
+func ValidateStepTimeouts(timeouts config.TimeoutConfig) error {
+	unknown := unknownSteps(slices.Collect(maps.Keys(timeouts.Steps)), slices.Collect(maps.Keys(timeouts.Tasks)))
+	if len(unknown) > 0 {
+		return fmt.Errorf("timeouts for unknown step(s) %s; valid steps are: %s",
+			strings.Join(unknown, ", "), strings.Join(StepIDs, ", "))
+	}
+	return nil
+}
+
+// ValidateStepRetries rejects retry counts for unknown steps, so a typo in
+// [retries.steps] does not quietly keep the default.
+func ValidateStepRetries(retries config.RetryConfig) error {
+	unknown := unknownSteps(slices.Collect(maps.Keys(retries.Steps)))
+	if len(unknown) > 0 {
+		return fmt.Errorf("retries for unknown step(s) %s; valid steps are: %s",
+			strings.Join(unknown, ", "), strings.Join(StepIDs, ", "))
+	}
+	return nil
+}
+
+// unknownSteps returns the sorted, distinct names that are no step id.
+func unknownSteps(names ...[]string) []string {
+	var unknown []string
+	for _, name := range slices.Concat(names...) {
+		if !slices.Contains(StepIDs, name) && !slices.Contains(unknown, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	slices.Sort(unknown)
+	return unknown
+}
+
+// pipelineStep is one entry of the per-user sync pipeline.
+type pipelineStep struct {
+	id   string
+	name string
+	// core marks steps whose total failure means the run did not do its job.
+	core bool
+	// run runs the step until it is done or ctx is.
+	run func(ctx context.Context) (OpStats, error)
+	// plan lists the async tasks run would issue, using only read-only
+	// endpoints (see PlanAllUsers).
+	plan func() ([]PlannedTask, error)
+}
+
+// pipeline returns the per-user sync steps in execution order. Snapshot and
+// exchange trades are single operations with no per-item count.
+func (s *SyncService) pipeline() []pipelineStep {
+	return []pipelineStep{
+		{StepSnapshot, "balance snapshot", false, func(ctx context.Context) (OpStats, error) {
+			return OpStats{}, s.blockchain.PerformSnapshotIfNeeded(ctx)
+		}, s.blockchain.planSnapshot},
+		{StepTokenDetection, "token detection", false, s.blockchain.DetectTokens, s.blockchain.planTokenDetection},
+		{StepExchangeTrades, "exchange trades", false, func(ctx context.Context) (OpStats, error) {
+			return OpStats{}, s.exchange.GetExchangeTrades(ctx)
+		}, s.exchange.planExchangeTrades},
+		{StepOnlineEvents, "online events fetch", false, s.blockchain.FetchOnlineEvents, s.blockchain.planOnlineEvents},
+		{StepEvmFetch, "EVM transaction fetch", true, s.blockchain.FetchEvmTransactions, s.blockchain.planEvmFetch},
+		{StepNonEvmFetch, "non-EVM transaction fetch", true, s.blockchain.FetchNonEvmTransactions, s.blockchain.planNonEvmFetch},
+		{StepEvmDecode, "EVM transaction decode", true, s.blockchain.DecodeEvmTransactions, s.blockchain.planEvmDecode},
+		{StepNonEvmDecode, "non-EVM transaction decode", true, s.blockchain.DecodeNonEvmTransactions, s.blockchain.planNonEvmDecode},
+	}
+}
+
+// runStep runs step within its time limit (timeouts.steps), if it has one,
+// giving up on each of its async tasks at the task time limit. A step that ran
+// into its limit returns an error wrapping context.DeadlineExceeded, even when
+// it stopped without one.
+func (s *SyncService) runStep(ctx context.Context, step pipelineStep) (OpStats, error) {
+	ctx = async.WithTaskTimeout(ctx, s.config.Timeouts.TaskLimit(step.id))
+	ctx = withRetryPolicy(ctx, retryPolicy{retries: s.config.StepRetries(step.id), delay: s.config.RetryDelay})
+	limit := s.config.Timeouts.Step(step.id)
+	if limit <= 0 {
+		return step.run(ctx)
+	}
+
+	stepCtx, cancel := context.WithTimeout(ctx, limit)
+	defer cancel()
+	stats, err := step.run(stepCtx)
+
+	var contractBreak *ContractBreakError
+	if !errors.As(err, &contractBreak) && errors.Is(stepCtx.Err(), context.DeadlineExceeded) {
+		logger.Warn("%s ran into its %s time limit", step.name, limit)
+		err = &stepTimeoutError{limit: limit}
+	}
+	return stats, err
+}
+
+// stepTimeoutError is the error of a step that ran into its time limit.
+type stepTimeoutError struct {
+	limit time.Duration
+}
+
+func (e *stepTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s", e.limit)
+}
+
+func (e *stepTimeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+// StepEnabled reports whether the step with the given id runs for username
+// under the configured step selection.
+func (s *SyncService) StepEnabled(username, step string) bool {
+	return s.config.Steps.Enabled(username, step)
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/config"
+)
+
+func TestValidateStepSelection(t *testing.T) {
+	valid := config.StepSelection{
+		Only:  []string{StepEvmFetch, StepEvmDecode},
+		Users: map[string]config.StepFilter{"alice": {Skip: []string{StepTokenDetection}}},
+	}
+	if err := ValidateStepSelection(valid); err != nil {
+		t.Fatalf("expected valid selection, got %v", err)
+	}
+
+	invalid := config.StepSelection{
+		Skip:  []string{"token-detect"},
+		Users: map[string]config.StepFilter{"alice": {Only: []string{"evm-fetch", "evm-fetsh"}, Skip: []string{"token-detect"}}},
+	}
+	err := ValidateStepSelection(invalid)
+	if err == nil || !strings.Contains(err.Error(), "unknown step(s) evm-fetsh, token-detect;") {
+		t.Fatalf("expected the unknown steps sorted and named once, got %v", err)
+	}
+}
+
+func TestPipelineMatchesStepIDs(t *testing.T) {
+	svc := NewSyncService(&config.Config{})
+	steps := svc.pipeline()
+	if len(steps) != len(StepIDs) {
+		t.Fatalf("pipeline has %d steps, StepIDs has %d", len(steps), len(StepIDs))
+	}
+	for i, step := range steps {
+		if step.id != StepIDs[i] {
+			t.Errorf("step %d: id %q, want %q", i, step.id, StepIDs[i])
+		}
+	}
+}
+
+func TestValidateStepTimeouts(t *testing.T) {
+	valid := config.TimeoutConfig{Steps: map[string]time.Duration{StepEvmDecode: 2 * time.Hour}}
+	if err := ValidateStepTimeouts(valid); err != nil {
+		t.Fatalf("expected valid timeouts, got %v", err)
+	}
+
+	invalid := config.TimeoutConfig{Steps: map[string]time.Duration{"evm-decod": time.Hour}}
+	if err := ValidateStepTimeouts(invalid); err == nil || !strings.Contains(err.Error(), "evm-decod") {
+		t.Fatalf("expected an error naming evm-decod, got %v", err)
+	}
+}
+
+func TestValidateStepRetries(t *testing.T) {
+	if err := ValidateStepRetries(config.RetryConfig{Steps: map[string]int{StepEvmDecode: 1}}); err != nil {
+		t.Fatalf("expected valid retries, got %v", err)
+	}
+	invalid := config.RetryConfig{Steps: map[string]int{"online-event": 1, "evm-decod": 0}}
+	if err := ValidateStepRetries(invalid); err == nil || !strings.Contains(err.Error(), "evm-decod, online-event") {
+		t.Fatalf("expected an error naming evm-decod and online-event, got %v", err)
+	}
+}
+
+func TestRunStepTimesOut(t *testing.T) {
+	svc := &SyncService{config: &config.Config{Timeouts: config.TimeoutConfig{
+		Steps: map[string]time.Duration{StepEvmDecode: 20 * time.Millisecond},
+	}}}
+	// The step gives up on its last item and returns without an error, as
+	// the looping steps do once their context is done.
+	waitForDeadline := func(ctx context.Context) (OpStats, error) {
+		<-ctx.Done()
+		return OpStats{Failed: 1}, nil
+	}
+
+	stats, err := svc.runStep(context.Background(), pipelineStep{id: StepEvmDecode, name: "EVM transaction decode", run: waitForDeadline})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if stats.Failed != 1 {
+		t.Errorf("stats = %+v, want the step's stats", stats)
+	}
+
+	done := func(ctx context.Context) (OpStats, error) {
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("a step without a time limit got a deadline")
+		}
+		return OpStats{Ok: 1}, nil
+	}
+	if _, err := svc.runStep(context.Background(), pipelineStep{id: StepEvmFetch, run: done}); err != nil {
+		t.Errorf("step without a time limit: %v", err)
+	}
+}
+
+func TestTimedOutStepReport(t *testing.T) {
+	report := &RunReport{Users: []UserReport{{
+		Username: "alice",
+		Steps: []StepReport{{
+			ID: StepEvmDecode, Step: "EVM transaction decode", Core: true, TimedOut: true,
+			Err:   &stepTimeoutError{limit: 2 * time.Hour},
+			Stats: OpStats{Ok: 3, Failed: 1},
+		}},
+	}}}
+
+	if report.HasFailures() || !report.HasTimeouts() {
+		t.Errorf("HasFailures = %v, HasTimeouts = %v; want a timeout, not a failure",
+			report.HasFailures(), report.HasTimeouts())
+	}
+	if got := report.Document().Users[0].Steps[0].Status; got != StatusTimedOut {
+		t.Errorf("step status = %q, want %q", got, StatusTimedOut)
+	}
+	summary := report.Summary()
+	for _, want := range []string{
+		"TIMED OUT: 1 step(s) and 0 item(s) ran into their time limit",
+		"[TIMED OUT] EVM transaction decode: timed out after 2h0m0s (3 ok / 1 failed)",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary missing %q:\n%s", want, summary)
+		}
+	}
+}
@@ -1,19 +1,23 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/kelsos/rotki-sync/internal/async"
+	"github.com/kelsos/rotki-sync/internal/checkpoint"
 	"github.com/kelsos/rotki-sync/internal/client"
 	"github.com/kelsos/rotki-sync/internal/config"
 	"github.com/kelsos/rotki-sync/internal/logger"
 	"github.com/kelsos/rotki-sync/internal/models"
+	"github.com/kelsos/rotki-sync/internal/paths"
 	"github.com/kelsos/rotki-sync/internal/process"
 	"github.com/kelsos/rotki-sync/internal/progress"
 	"github.com/kelsos/rotki-sync/internal/secrets"
+	"github.com/kelsos/rotki-sync/internal/state"
 )
 
 // SyncService orchestrates the data synchronization process
@@ -26,6 +30,11 @@ type SyncService struct {
 	user        *UserService
 	blockchain  *BlockchainService
 	exchange    *ExchangeService
+	events      *eventBus
+	window      *fetchWindow
+	checkpoint  *runCheckpoint
+	// interruption is set by Interrupt to stop the run early.
+	interruption interruption
 }
 
 // NewSyncService creates a new sync service with all dependencies
@@ -37,61 +46,147 @@ func NewSyncService(cfg *config.Config) *SyncService {
 	// The progress tracker enriches async-task heartbeats with live decode
 	// progress (websocket) and rate-limit causes (log tail). The websocket is
 	// started once the API is ready (see WaitForAPIReady).
-	progressTracker := progress.NewTracker(process.LogFilePath())
+	// An attached rotki-core logs wherever its owner configured; the local
+	// core log would only describe an earlier spawned run.
+	logPath := process.LogFilePath()
+	if cfg.Attached() {
+		logPath = ""
+	}
+	progressTracker := progress.NewTracker(logPath)
 	taskManager.SetProgressReporter(progressTracker)
+	// The same websocket announces finished work, so task results are picked
+	// up without polling /tasks every second while it is connected.
+	progressTracker.SetFinishedHandler(taskManager.TasksChanged)
+	taskManager.SetTaskNotifier(progressTracker)
 
 	store := secrets.Default()
 
-	return &SyncService{
+	user := NewUserServiceWithAsyncClient(apiClient, asyncClient, store)
+	if cfg.HasUserSelection() {
+		user.SetUserFilter(cfg.UserSelected)
+	}
+	user.SetPreserveSessions(cfg.Attached() && !cfg.ForceLogout)
+
+	// The incremental window remembers each account's and exchange's last
+	// successful fetch. An unreadable state only costs a full refetch.
+	fetchState, err := state.Default(cfg.ScopeKey())
+	if err != nil {
+		logger.Warn("Ignoring the incremental sync state, fetching full history: %v", err)
+		fetchState = nil
+	}
+	window := &fetchWindow{store: fetchState, full: cfg.FullSync}
+
+	// The checkpoint of an interrupted run is only read with --resume; any
+	// other run starts a new one.
+	runState := checkpoint.New(paths.CheckpointFile(cfg.ScopeKey()))
+	if cfg.Resume {
+		if runState, err = checkpoint.Default(cfg.ScopeKey()); err != nil {
+			logger.Warn("Ignoring the run checkpoint, starting a full run: %v", err)
+			runState = checkpoint.New(paths.CheckpointFile(cfg.ScopeKey()))
+		}
+	}
+	runProgress := &runCheckpoint{store: runState, target: cfg.Target()}
+	user.SetSkipFilter(runProgress.userDone)
+
+	events := &eventBus{}
+	taskManager.SetTaskObserver(taskEvents{bus: events})
+	blockchain := NewBlockchainServiceWithAsyncClient(apiClient, asyncClient)
+	blockchain.events = events
+	blockchain.window = window
+	blockchain.checkpoint = runProgress
+	blockchain.SetConcurrency(cfg.Concurrency)
+	blockchain.SetAccountRules(cfg.Accounts)
+	// The log tail also tells which providers rotki-core is rate-limited by,
+	// so new tasks for the chains they slow down can wait for them.
+	blockchain.SetRateLimits(progressTracker, cfg.RateLimits)
+	exchange := NewExchangeServiceWithAsyncClient(apiClient, asyncClient)
+	exchange.window = window
+
+	s := &SyncService{
 		config:      cfg,
 		client:      apiClient,
 		taskManager: taskManager,
 		asyncClient: asyncClient,
 		progress:    progressTracker,
-		user:        NewUserServiceWithAsyncClient(apiClient, asyncClient, store),
-		blockchain:  NewBlockchainServiceWithAsyncClient(apiClient, asyncClient),
-		exchange:    NewExchangeServiceWithAsyncClient(apiClient, asyncClient),
+		user:        user,
+		blockchain:  blockchain,
+		exchange:    exchange,
+		events:      events,
+		window:      window,
+		checkpoint:  runProgress,
 	}
+	user.SetStopCheck(func() bool { return s.interrupted() != "" })
+	return s
+}
+
+// Subscribe registers observer for the events of every subsequent run. It must
+// be called before the run starts.
+func (s *SyncService) Subscribe(observer Observer) {
+	s.events.subscribe(observer)
 }
 
 // processUserData performs all data processing for a single user and records
-// the outcome of each step into a UserReport. A non-nil second return is a
-// fatal contract break (e.g. a removed endpoint) that aborts the remaining
-// steps for this user and the whole run.
-func (s *SyncService) processUserData(username string) (UserReport, error) {
+// the outcome of each step into a UserReport. Steps disabled by the step
+// selection are recorded as skipped. A non-nil second return is a fatal
+// contract break (e.g. a removed endpoint) that aborts the remaining steps for
+// this user and the whole run. Steps stop early once ctx is done.
+func (s *SyncService) processUserData(ctx context.Context, username string) (UserReport, error) {
 	logger.Info("Starting data processing for user: %s", username)
 
-	report := UserReport{Username: username}
-
-	// Snapshot and exchange trades are single operations with no per-item count.
-	report.add(StepReport{Step: "balance snapshot", Err: s.blockchain.PerformSnapshotIfNeeded()})
+	report := UserReport{Username: username, StartedAt: time.Now().UTC()}
 
-	detectStats, detectErr := s.blockchain.DetectTokens()
-	report.add(StepReport{Step: "token detection", Stats: detectStats, Err: detectErr})
-
-	report.add(StepReport{Step: "exchange trades", Err: s.exchange.GetExchangeTrades()})
-
-	// The remaining steps loop over accounts/chains and can hit a removed
-	// endpoint; a ContractBreakError from any of them aborts the run.
-	steps := []struct {
-		name string
-		core bool
-		run  func() (OpStats, error)
-	}{
-		{"online events fetch", false, s.blockchain.FetchOnlineEvents},
-		{"EVM transaction fetch", true, s.blockchain.FetchEvmTransactions},
-		{"non-EVM transaction fetch", true, s.blockchain.FetchNonEvmTransactions},
-		{"EVM transaction decode", true, s.blockchain.DecodeEvmTransactions},
-		{"non-EVM transaction decode", true, s.blockchain.DecodeNonEvmTransactions},
-	}
+	steps := s.pipeline()
+	for i, step := range steps {
+		if reason := s.interrupted(); reason != "" {
+			logger.Warn("Not starting the remaining steps for user %s (%s)", username, reason)
+			report.Interrupted = true
+			break
+		}
+		s.events.enter(username, step, i, len(steps))
+		s.checkpoint.enter(username, step.id)
+		s.events.emit(Event{Kind: EventStepStart})
+
+		if !s.StepEnabled(username, step.id) {
+			logger.Info("Skipping %s for user %s (step selection)", step.name, username)
+			s.finishStep(&report, StepReport{ID: step.id, Step: step.name, Core: step.core, Skipped: true})
+			continue
+		}
+		if s.checkpoint.stepDone() {
+			logger.Info("Skipping %s for user %s (finished before the interruption)", step.name, username)
+			s.finishStep(&report, StepReport{ID: step.id, Step: step.name, Core: step.core, Skipped: true, Resumed: true})
+			continue
+		}
 
-	for _, step := range steps {
-		stats, err := step.run()
-		report.add(StepReport{Step: step.name, Core: step.core, Stats: stats, Err: err})
+		// Drop tasks and polls from outside the step (e.g. login) so only
+		// this step's are attributed to it.
+		s.taskManager.DrainTimings()
+		s.taskManager.DrainPolls()
+		start, rateLimited := time.Now(), s.rateLimitedTime()
+		stats, err := s.runStep(ctx, step)
+		stepReport := StepReport{
+			ID: step.id, Step: step.name, Core: step.core,
+			Stats: stats, Err: err, Duration: time.Since(start),
+			Tasks:       taskTimings(s.taskManager.DrainTimings()),
+			Polls:       s.taskManager.DrainPolls(),
+			RateLimited: s.rateLimitedTime() - rateLimited,
+			TimedOut:    errors.Is(err, context.DeadlineExceeded),
+		}
+		// A step with failed items is not finished, so a resume retries them.
+		// Items that failed while the run was being interrupted were most
+		// likely canceled, so the step counts as interrupted, not failed.
+		if stepReport.finished() {
+			s.checkpoint.stepFinished()
+		} else if s.interrupted() != "" {
+			stepReport.Interrupted = true
+		}
+		s.finishStep(&report, stepReport)
 
+		// The looping steps can hit a removed endpoint; a ContractBreakError
+		// from any of them aborts the run.
 		var contractBreak *ContractBreakError
 		if errors.As(err, &contractBreak) {
 			logger.Error("Aborting run for user %s: %v", username, err)
+			report.FinishedAt = time.Now().UTC()
 			return report, contractBreak
 		}
 		if err != nil {
@@ -100,16 +195,74 @@ func (s *SyncService) processUserData(username string) (UserReport, error) {
 	}
 
 	logger.Info("Completed data processing for user: %s", username)
+	report.FinishedAt = time.Now().UTC()
 	return report, nil
 }
 
+// rateLimitedTime is how long rotki-core has been rate-limited so far (see
+// progress.Tracker.RateLimitedTime); zero without a progress tracker.
+func (s *SyncService) rateLimitedTime() time.Duration {
+	if s.progress == nil {
+		return 0
+	}
+	return s.progress.RateLimitedTime()
+}
+
+// finishStep adds step to the user's report and publishes its outcome.
+func (s *SyncService) finishStep(report *UserReport, step StepReport) {
+	report.add(step)
+	s.events.emit(Event{Kind: EventStepFinish, Err: step.Err, StepReport: &step})
+}
+
+// taskTimings converts async task timings into report item timings.
+func taskTimings(tasks []async.TaskTiming) []ItemTiming {
+	if len(tasks) == 0 {
+		return nil
+	}
+	timings := make([]ItemTiming, len(tasks))
+	for i, task := range tasks {
+		timings[i] = ItemTiming{
+			Name:     fmt.Sprintf("task %d %s %s", task.ID, task.Method, task.Endpoint),
+			Duration: task.Duration,
+			Failed:   task.Failed,
+			TimedOut: task.TimedOut,
+		}
+	}
+	return timings
+}
+
 // ProcessAllUsers processes all users in the system and returns an aggregated
 // run report. The returned error is a transport/setup failure that prevented
 // processing; per-step and contract-break outcomes are carried in the report.
+// Progress is published to the subscribed observers as the run goes, and
+// checkpointed so an interrupted run can be resumed; the checkpoint is
+// discarded once every user was processed. After Interrupt the report covers
+// the users and steps that ran.
 func (s *SyncService) ProcessAllUsers() (*RunReport, error) {
-	report := &RunReport{}
+	return s.ProcessAllUsersContext(context.Background())
+}
 
-	err := s.user.ProcessUsers(func(username string) error {
+// ProcessAllUsersContext is like ProcessAllUsers, but the run is interrupted
+// (see Interrupt) once ctx is done, and the steps in progress stop waiting for
+// their tasks.
+func (s *SyncService) ProcessAllUsersContext(ctx context.Context) (*RunReport, error) {
+	stop := context.AfterFunc(ctx, func() { s.Interrupt(context.Cause(ctx).Error()) })
+	defer stop()
+
+	report := NewRunReport()
+	defer report.Finish()
+	polls, rateLimited := s.taskManager.Polls(), s.rateLimitedTime()
+	defer func() {
+		report.Polls = s.taskManager.Polls() - polls
+		report.RateLimited = s.rateLimitedTime() - rateLimited
+	}()
+	report.ResumedFrom = s.checkpoint.begin(s.config.Resume, report.ID, report.StartedAt)
+
+	var current *UserReport
+	err := s.user.ProcessUsersWithCallback(ctx, func(username string, loginErr error) {
+		current = nil
+		s.events.emit(Event{Kind: EventLogin, Username: username, Err: loginErr})
+	}, func(username string) error {
 		// Once a contract break has aborted the run, skip the remaining users:
 		// the same broken endpoint would fail for every one of them.
 		if report.FatalErr != nil {
@@ -117,14 +270,29 @@ func (s *SyncService) ProcessAllUsers() (*RunReport, error) {
 			return nil
 		}
 
-		userReport, fatal := s.processUserData(username)
+		s.window.begin(username)
+		userReport, fatal := s.processUserData(ctx, username)
+		s.window.save()
 		report.add(userReport)
+		current = &userReport
 		if fatal != nil {
 			report.FatalErr = fatal
+		} else if userReport.finished() {
+			s.checkpoint.userFinished(username)
 		}
 		return nil
+	}, func(username string) error {
+		s.events.emit(Event{Kind: EventLogout, Username: username, User: current})
+		// Tasks until the next user's steps (its login) belong to no step.
+		s.events.enter("", pipelineStep{}, 0, 0)
+		return nil
 	})
 
+	s.settleInterruption()
+	report.Interrupted = s.interrupted()
+	if err == nil && report.FatalErr == nil && report.Interrupted == "" {
+		s.checkpoint.finish()
+	}
 	return report, err
 }
 
@@ -171,11 +339,20 @@ func (s *SyncService) PreflightEndpoints() error {
 func (s *SyncService) WaitForAPIReady() bool {
 	ready := s.client.WaitForAPIReady()
 	if ready && s.progress != nil {
-		s.progress.StartWebsocket(s.config.Port)
+		s.progress.StartWebsocket(s.backendURL())
 	}
 	return ready
 }
 
+// backendURL is the REST base URL used to locate the websocket. A spawned
+// rotki-core is reached over IPv4 loopback, which is what it binds to.
+func (s *SyncService) backendURL() string {
+	if s.config.Attached() {
+		return s.config.BaseURL
+	}
+	return fmt.Sprintf("http://127.0.0.1:%d", s.config.Port)
+}
+
 // GetInfo fetches general information about the running rotki backend,
 // including the version and data directory.
 func (s *SyncService) GetInfo() (*models.Info, error) {
@@ -202,7 +379,7 @@ func (s *SyncService) Cleanup() {
 	}
 }
 
-// GetUsers retrieves all users from the system
+// GetUsers retrieves the users selected for processing
 func (s *SyncService) GetUsers() ([]string, error) {
 	return s.user.GetUsers()
 }
@@ -214,20 +391,24 @@ type CredentialCheck struct {
 	Err      error
 }
 
-// CheckCredentials logs in then immediately logs out every user, verifying their
+// CheckCredentials logs in then immediately logs out every selected user, verifying their
 // stored password authenticates against the running backend. It performs no sync
 // work and requires the API to be ready. A user without a stored password (or
 // with a wrong one) is reported as a failed check rather than aborting the rest.
 func (s *SyncService) CheckCredentials() ([]CredentialCheck, error) {
-	users, err := s.GetUsers()
+	users, loggedIn, err := s.user.getSortedUsers(context.Background())
 	if err != nil {
 		return nil, err
 	}
+	if s.user.preserveSessions && len(loggedIn) > 0 {
+		return nil, fmt.Errorf("attached backend has %s logged in; a credential check would end that session (use --force-logout)",
+			strings.Join(loggedIn, ", "))
+	}
 
 	results := make([]CredentialCheck, 0, len(users))
 	for _, username := range users {
 		result := CredentialCheck{Username: username}
-		if err := s.user.Login(username); err != nil {
+		if err := s.user.Login(context.Background(), username); err != nil {
 			result.Err = err
 		} else {
 			result.OK = true
@@ -239,110 +420,3 @@ func (s *SyncService) CheckCredentials() ([]CredentialCheck, error) {
 	}
 	return results, nil
 }
-
-// ProcessUsersWithCallback processes all users with callbacks for monitoring
-func (s *SyncService) ProcessUsersWithCallback(
-	onLoginResult func(username string, loginErr error),
-	processFunc func(username string) error,
-	onLogout func(username string) error,
-) error {
-	return s.user.ProcessUsersWithCallback(onLoginResult, processFunc, onLogout)
-}
-
-// PerformSnapshotIfNeeded performs a blockchain snapshot if needed
-func (s *SyncService) PerformSnapshotIfNeeded() error {
-	return s.blockchain.PerformSnapshotIfNeeded()
-}
-
-// GetExchangeTrades fetches exchange trades
-func (s *SyncService) GetExchangeTrades() error {
-	return s.exchange.GetExchangeTrades()
-}
-
-// FetchOnlineEvents fetches online blockchain events
-func (s *SyncService) FetchOnlineEvents() error {
-	_, err := s.blockchain.FetchOnlineEvents()
-	return err
-}
-
-// FetchEvmTransactions fetches EVM transactions
-func (s *SyncService) FetchEvmTransactions() error {
-	_, err := s.blockchain.FetchEvmTransactions()
-	return err
-}
-
-// DecodeEvmTransactions decodes EVM transactions
-func (s *SyncService) DecodeEvmTransactions() error {
-	_, err := s.blockchain.DecodeEvmTransactions()
-	return err
-}
-
-// FetchAccounts retrieves all accounts for all chains
-func (s *SyncService) FetchAccounts() ([]interface{}, error) {
-	accounts, err := s.blockchain.FetchAccounts()
-	if err != nil {
-		return nil, err
-	}
-
-	// Convert to interface{} slice for TUI compatibility
-	result := make([]interface{}, len(accounts))
-	for i, acc := range accounts {
-		result[i] = acc
-	}
-	return result, nil
-}
-
-// DetectTokens runs token detection on EVM chains
-func (s *SyncService) DetectTokens() error {
-	_, err := s.blockchain.DetectTokens()
-	return err
-}
-
-// GetTokenDetectionChains returns EVM chains with addresses for token detection
-func (s *SyncService) GetTokenDetectionChains() ([]TokenDetectionChain, error) {
-	return s.blockchain.GetTokenDetectionChains()
-}
-
-// DetectTokensForAddress runs token detection for a single address on a chain
-func (s *SyncService) DetectTokensForAddress(chainID string, address string) error {
-	return s.blockchain.DetectTokensForAddress(chainID, address)
-}
-
-// GetCachedTokenDetection fetches cached token detection info for the given
-// addresses on a chain without triggering a fresh detection.
-func (s *SyncService) GetCachedTokenDetection(chainID string, addresses []string) (models.TokenDetectResponse, error) {
-	return s.blockchain.GetCachedTokenDetection(chainID, addresses)
-}
-
-// ShouldSkipTokenDetection reports whether token detection can be skipped for
-// an address based on its cached info.
-func (s *SyncService) ShouldSkipTokenDetection(info models.TokenDetectAddressInfo) (bool, time.Duration) {
-	return s.blockchain.ShouldSkipTokenDetection(info)
-}
-
-// FetchNonEvmTransactions fetches transactions for non-EVM chains
-func (s *SyncService) FetchNonEvmTransactions() error {
-	_, err := s.blockchain.FetchNonEvmTransactions()
-	return err
-}
-
-// DecodeNonEvmTransactions decodes transactions for non-EVM chains
-func (s *SyncService) DecodeNonEvmTransactions() error {
-	_, err := s.blockchain.DecodeNonEvmTransactions()
-	return err
-}
-
-// GetSupportedEvmChains retrieves supported EVM chains
-func (s *SyncService) GetSupportedEvmChains() ([]interface{}, error) {
-	chains, err := s.blockchain.GetSupportedEvmChains()
-	if err != nil {
-		return nil, err
-	}
-
-	// Convert to interface{} slice for TUI compatibility
-	result := make([]interface{}, len(chains))
-	for i, chain := range chains {
-		result[i] = chain
-	}
-	return result, nil
-}
@@ -1,8 +1,11 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"slices"
 	"sort"
+	"strings"
 
 	"github.com/kelsos/rotki-sync/internal/async"
 	"github.com/kelsos/rotki-sync/internal/client"
@@ -16,6 +19,17 @@ type UserService struct {
 	client      *client.APIClient
 	asyncClient *async.Client
 	secrets     *secrets.Store
+	// selected filters the users processed; nil selects every user.
+	selected func(username string) bool
+	// preserveSessions leaves sessions this run did not start alone (an
+	// attached backend without --force-logout).
+	preserveSessions bool
+	// skip names selected users that need no processing (finished in a
+	// resumed run); nil skips none.
+	skip func(username string) bool
+	// stopped reports whether the run was interrupted, so no further user is
+	// logged in; nil never stops.
+	stopped func() bool
 }
 
 // NewUserServiceWithAsyncClient creates a new user service with an async client
@@ -28,24 +42,39 @@ func NewUserServiceWithAsyncClient(client *client.APIClient, asyncClient *async.
 	}
 }
 
-// GetUsers retrieves all users from the API
-func (s *UserService) GetUsers() ([]string, error) {
-	var response models.UserResponse
-	if err := s.client.Get("/users", &response); err != nil {
-		return nil, fmt.Errorf("failed to get users: %w", err)
-	}
+// SetUserFilter restricts the users processed to those for which selected
+// returns true.
+func (s *UserService) SetUserFilter(selected func(username string) bool) {
+	s.selected = selected
+}
 
-	var users []string
-	for username := range response.Result {
-		users = append(users, username)
-	}
-	sort.Strings(users)
+// SetSkipFilter makes ProcessUsersWithCallback pass over users for which skip
+// returns true, without logging them in.
+func (s *UserService) SetSkipFilter(skip func(username string) bool) {
+	s.skip = skip
+}
 
-	return users, nil
+// SetStopCheck makes ProcessUsersWithCallback stop before the next user once
+// stopped returns true.
+func (s *UserService) SetStopCheck(stopped func() bool) {
+	s.stopped = stopped
+}
+
+// SetPreserveSessions makes the service leave users it did not log in logged
+// in. rotki-core allows a single session, so while such a session is open only
+// its own user can be processed.
+func (s *UserService) SetPreserveSessions(preserve bool) {
+	s.preserveSessions = preserve
+}
+
+// GetUsers retrieves the selected users from the API, sorted
+func (s *UserService) GetUsers() ([]string, error) {
+	users, _, err := s.getSortedUsers(context.Background())
+	return users, err
 }
 
 // Login logs in a user with the password resolved from the secret store.
-func (s *UserService) Login(username string) error {
+func (s *UserService) Login(ctx context.Context, username string) error {
 	logger.Info("Logging in user %s", username)
 
 	password, ok, err := s.secrets.Get(secrets.ScopeUsers, username)
@@ -62,7 +91,7 @@ func (s *UserService) Login(username string) error {
 	}
 
 	// Use async login
-	response, err := async.Post[models.UserLoginResponse](s.asyncClient, endpoint, loginData)
+	response, err := async.PostContext[models.UserLoginResponse](ctx, s.asyncClient, endpoint, loginData)
 	if err != nil {
 		return fmt.Errorf("failed to login user %s: %w", username, err)
 	}
@@ -93,22 +122,37 @@ func (s *UserService) Logout(username string) error {
 	return nil
 }
 
-// getSortedUsers fetches users and returns sorted usernames plus any currently logged-in users
-func (s *UserService) getSortedUsers() (allUsers []string, loggedIn []string, err error) {
+// getSortedUsers fetches users and returns the sorted selected usernames plus
+// any currently logged-in users. loggedIn is not filtered: rotki-core allows a
+// single session, so an excluded user that is logged in must still be logged
+// out before a selected one can log in.
+func (s *UserService) getSortedUsers(ctx context.Context) (allUsers []string, loggedIn []string, err error) {
 	var userResponse models.UserResponse
-	if err := s.client.Get("/users", &userResponse); err != nil {
+	if err := s.client.GetContext(ctx, "/users", &userResponse); err != nil {
 		return nil, nil, fmt.Errorf("failed to get users: %w", err)
 	}
 
+	excluded := 0
 	for username, userStatus := range userResponse.Result {
-		allUsers = append(allUsers, username)
 		if userStatus == models.StatusLoggedIn {
 			loggedIn = append(loggedIn, username)
 		}
+		if s.selected != nil && !s.selected(username) {
+			excluded++
+			continue
+		}
+		allUsers = append(allUsers, username)
 	}
 	sort.Strings(allUsers)
 	sort.Strings(loggedIn)
 
+	if excluded > 0 {
+		logger.Info("User selection: %d of %d users selected", len(allUsers), len(userResponse.Result))
+		if len(allUsers) == 0 {
+			return nil, nil, fmt.Errorf("no users match the user selection (%d users excluded)", excluded)
+		}
+	}
+
 	return allUsers, loggedIn, nil
 }
 
@@ -121,55 +165,89 @@ func (s *UserService) logoutUsers(usernames []string) {
 	}
 }
 
-// ProcessUsers processes all users with the given function
-func (s *UserService) ProcessUsers(processFunc func(username string) error) error {
-	allUsers, loggedIn, err := s.getSortedUsers()
+// prepareSessions returns the users to process and those whose existing
+// session is reused (neither logged in nor out by this run). Unless sessions
+// are preserved, every logged-in user is logged out first.
+func (s *UserService) prepareSessions(ctx context.Context) (users []string, reused map[string]bool, err error) {
+	allUsers, loggedIn, err := s.getSortedUsers(ctx)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	// Logout all currently logged-in users
-	s.logoutUsers(loggedIn)
+	if !s.preserveSessions || len(loggedIn) == 0 {
+		// Logout all currently logged-in users
+		s.logoutUsers(loggedIn)
+		return allUsers, nil, nil
+	}
+	return planPreservedSessions(allUsers, loggedIn)
+}
 
-	// Process each user
+// planPreservedSessions limits a run to the selected users that are already
+// logged in, since logging in anyone else would end their session.
+func planPreservedSessions(allUsers, loggedIn []string) ([]string, map[string]bool, error) {
+	var users []string
+	reused := make(map[string]bool)
 	for _, username := range allUsers {
-		if err := s.Login(username); err != nil {
-			logger.Error("Failed to login user %s: %v", username, err)
-			continue
-		}
-
-		logger.Info("Processing user: %s", username)
-		if err := processFunc(username); err != nil {
-			logger.Error("Error processing user %s: %v", username, err)
+		if slices.Contains(loggedIn, username) {
+			users = append(users, username)
+			reused[username] = true
 		}
+	}
 
-		if err := s.Logout(username); err != nil {
-			logger.Error("Failed to logout user %s: %v", username, err)
-		}
+	if len(users) == 0 {
+		return nil, nil, fmt.Errorf("attached backend has %s logged in; refusing to log out a session this run did not start (use --force-logout)",
+			strings.Join(loggedIn, ", "))
 	}
+	if skipped := len(allUsers) - len(users); skipped > 0 {
+		logger.Warn("Attached backend has %s logged in; processing only that session and skipping %d other user(s) (use --force-logout to process every user)",
+			strings.Join(users, ", "), skipped)
+	}
+	return users, reused, nil
+}
 
-	return nil
+// finishSession logs out username unless the run reused a session it did not
+// start.
+func (s *UserService) finishSession(username string, reused map[string]bool) {
+	if reused[username] {
+		logger.Info("Leaving user %s logged in (session not started by this run)", username)
+		return
+	}
+	if err := s.Logout(username); err != nil {
+		logger.Error("Failed to logout user %s: %v", username, err)
+	}
 }
 
 // ProcessUsersWithCallback processes all users with callbacks for monitoring.
 // onLoginResult is called after a login attempt with the error (nil on success).
-// onLogout is called after processing or on login failure.
+// onLogout is called after processing or on login failure. ctx bounds the user
+// listing and the logins; logouts still run once it is done so no session is
+// left open.
 func (s *UserService) ProcessUsersWithCallback(
+	ctx context.Context,
 	onLoginResult func(username string, loginErr error),
 	processFunc func(username string) error,
 	onLogout func(username string) error,
 ) error {
-	allUsers, loggedIn, err := s.getSortedUsers()
+	allUsers, reused, err := s.prepareSessions(ctx)
 	if err != nil {
 		return err
 	}
 
-	// Logout all currently logged-in users
-	s.logoutUsers(loggedIn)
-
 	// Process each user
 	for _, username := range allUsers {
-		loginErr := s.Login(username)
+		if s.stopped != nil && s.stopped() {
+			logger.Warn("Run interrupted; not processing user %s or later ones", username)
+			break
+		}
+		if s.skip != nil && s.skip(username) {
+			logger.Info("Skipping user %s (finished before the interruption)", username)
+			continue
+		}
+
+		var loginErr error
+		if !reused[username] {
+			loginErr = s.Login(ctx, username)
+		}
 		if loginErr != nil {
 			logger.Error("Failed to login user %s: %v", username, loginErr)
 		}
@@ -199,9 +277,7 @@ func (s *UserService) ProcessUsersWithCallback(
 			}
 		}
 
-		if err := s.Logout(username); err != nil {
-			logger.Error("Failed to logout user %s: %v", username, err)
-		}
+		s.finishSession(username, reused)
 	}
 
 	return nil
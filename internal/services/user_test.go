@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/kelsos/rotki-sync/internal/config"
+)
+
+// newUsersBackend serves a fixed /users listing.
+func newUsersBackend(body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+func TestGetSortedUsersAppliesSelection(t *testing.T) {
+	server := newUsersBackend(`{"result": {"alice": "loggedout", "test-1": "loggedin", "archived": "loggedout", "bob": "loggedout"}, "message": ""}`)
+	defer server.Close()
+
+	cfg := &config.Config{BaseURL: server.URL, ExcludeUsers: []string{"test*", "archived"}}
+	svc := NewSyncService(cfg)
+
+	users, loggedIn, err := svc.user.getSortedUsers(context.Background())
+	if err != nil {
+		t.Fatalf("getSortedUsers: %v", err)
+	}
+	if want := []string{"alice", "bob"}; !slices.Equal(users, want) {
+		t.Errorf("users = %v, want %v", users, want)
+	}
+	// An excluded user holding the session must still be logged out.
+	if want := []string{"test-1"}; !slices.Equal(loggedIn, want) {
+		t.Errorf("loggedIn = %v, want %v", loggedIn, want)
+	}
+}
+
+func TestGetSortedUsersNoMatch(t *testing.T) {
+	server := newUsersBackend(`{"result": {"alice": "loggedout"}, "message": ""}`)
+	defer server.Close()
+
+	svc := NewSyncService(&config.Config{BaseURL: server.URL, Users: []string{"bob"}})
+	if _, err := svc.GetUsers(); err == nil {
+		t.Fatal("expected an error when the selection matches no user")
+	}
+}
+
+func TestPlanPreservedSessions(t *testing.T) {
+	tests := []struct {
+		name     string
+		all      []string
+		loggedIn []string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "selected user logged in", all: []string{"alice", "bob"}, loggedIn: []string{"bob"}, want: []string{"bob"}},
+		{name: "only that user selected", all: []string{"alice"}, loggedIn: []string{"alice"}, want: []string{"alice"}},
+		{name: "unselected user logged in", all: []string{"alice"}, loggedIn: []string{"desktop"}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			users, reused, err := planPreservedSessions(tc.all, tc.loggedIn)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected a refusal to log out a foreign session")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("planPreservedSessions: %v", err)
+			}
+			if !slices.Equal(users, tc.want) {
+				t.Errorf("users = %v, want %v", users, tc.want)
+			}
+			for _, u := range users {
+				if !reused[u] {
+					t.Errorf("session of %s should be reused", u)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckCredentialsRefusesForeignSession(t *testing.T) {
+	server := newUsersBackend(`{"result": {"alice": "loggedin"}, "message": ""}`)
+	defer server.Close()
+
+	cfg := &config.Config{BaseURL: server.URL, Attach: server.URL}
+	if _, err := NewSyncService(cfg).CheckCredentials(); err == nil {
+		t.Fatal("expected an attached credential check to refuse while a user is logged in")
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/logger"
+	"github.com/kelsos/rotki-sync/internal/state"
+)
+
+// windowOverlap is how far before the last successful fetch an incremental
+// fetch starts, so transactions an explorer indexed late are not missed.
+// rotki-core deduplicates, so the overlap only costs a little extra work.
+const windowOverlap = time.Hour
+
+// fetchWindow limits account and exchange fetches to what happened since the
+// last successful fetch, as remembered in the state store. A nil window, a nil
+// store or a full refetch queries the whole history; successful fetches are
+// recorded either way.
+type fetchWindow struct {
+	store *state.Store
+	full  bool
+
+	mu   sync.Mutex
+	user string
+	// to is the upper bound of the current user's fetches: the time their
+	// processing started.
+	to time.Time
+}
+
+// begin starts the window for username's processing.
+func (w *fetchWindow) begin(username string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.user = username
+	w.to = time.Now().UTC()
+	w.mu.Unlock()
+}
+
+// bounds returns the from/to unix timestamps for a fetch covering keys of the
+// given kind. A zero from means a full fetch: no window applies, or one of the
+// keys was never fetched successfully. The window starts at the oldest of the
+// keys' last fetches.
+func (w *fetchWindow) bounds(kind string, keys ...string) (from, to int64) {
+	if w == nil || w.store == nil || w.full {
+		return 0, 0
+	}
+	w.mu.Lock()
+	user, end := w.user, w.to
+	w.mu.Unlock()
+
+	var oldest time.Time
+	for _, key := range keys {
+		last, ok := w.store.LastFetch(user, kind, key)
+		if !ok {
+			return 0, 0
+		}
+		if oldest.IsZero() || last.Before(oldest) {
+			oldest = last
+		}
+	}
+	if oldest.IsZero() {
+		return 0, 0
+	}
+	return oldest.Add(-windowOverlap).Unix(), end.Unix()
+}
+
+// done records a successful fetch of keys up to the window's end.
+func (w *fetchWindow) done(kind string, keys ...string) {
+	if w == nil || w.store == nil {
+		return
+	}
+	w.mu.Lock()
+	user, end := w.user, w.to
+	w.mu.Unlock()
+
+	for _, key := range keys {
+		w.store.Record(user, kind, key, end)
+	}
+}
+
+// save persists the recorded fetches. A failure only costs a wider window next
+// time, so it is logged rather than failing the run.
+func (w *fetchWindow) save() {
+	if w == nil || w.store == nil {
+		return
+	}
+	if err := w.store.Save(); err != nil {
+		logger.Warn("Failed to save the incremental sync state: %v", err)
+	}
+}
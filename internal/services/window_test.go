@@ -0,0 +1,84 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/state"
+)
+
+func TestFetchWindowBounds(t *testing.T) {
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := old.Add(24 * time.Hour)
+	store.Record("alice", state.KindAccount, "eth 0xa", old)
+	store.Record("alice", state.KindAccount, "eth 0xb", recent)
+
+	w := &fetchWindow{store: store}
+	w.begin("alice")
+
+	tests := []struct {
+		name     string
+		keys     []string
+		wantFrom int64
+	}{
+		{"known account", []string{"eth 0xb"}, recent.Add(-windowOverlap).Unix()},
+		{"batch starts at the oldest", []string{"eth 0xb", "eth 0xa"}, old.Add(-windowOverlap).Unix()},
+		{"unknown account in batch", []string{"eth 0xa", "eth 0xc"}, 0},
+		{"no keys", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := w.bounds(state.KindAccount, tt.keys...)
+			if from != tt.wantFrom {
+				t.Errorf("from = %d, want %d", from, tt.wantFrom)
+			}
+			if from > 0 && to != w.to.Unix() {
+				t.Errorf("to = %d, want %d", to, w.to.Unix())
+			}
+		})
+	}
+
+	if from, _ := w.bounds(state.KindExchange, "eth 0xa"); from != 0 {
+		t.Errorf("kinds should not share state, got from %d", from)
+	}
+
+	w.begin("bob")
+	if from, _ := w.bounds(state.KindAccount, "eth 0xa"); from != 0 {
+		t.Errorf("users should not share state, got from %d", from)
+	}
+}
+
+func TestFetchWindowFullStillRecords(t *testing.T) {
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Record("alice", state.KindExchange, "kraken", time.Now().Add(-time.Hour))
+
+	w := &fetchWindow{store: store, full: true}
+	w.begin("alice")
+	if from, to := w.bounds(state.KindExchange, "kraken"); from != 0 || to != 0 {
+		t.Errorf("full refetch got window %d-%d", from, to)
+	}
+
+	w.done(state.KindExchange, "kraken")
+	last, ok := store.LastFetch("alice", state.KindExchange, "kraken")
+	if !ok || last.Unix() != w.to.Unix() {
+		t.Errorf("LastFetch = %v, %v; want %v", last, ok, w.to)
+	}
+}
+
+func TestNilFetchWindow(t *testing.T) {
+	var w *fetchWindow
+	w.begin("alice")
+	if from, to := w.bounds(state.KindAccount, "eth 0xa"); from != 0 || to != 0 {
+		t.Errorf("nil window got %d-%d", from, to)
+	}
+	w.done(state.KindAccount, "eth 0xa")
+	w.save()
+}
@@ -0,0 +1,122 @@
+// Package state remembers, per rotki user, when each account's transactions
+// and each exchange's history were last fetched successfully, so a run can ask
+// rotki-core only for what happened since. The state is one small JSON file
+// per data dir or attached backend under <home>/state, rewritten atomically;
+// losing it only costs one full refetch.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/paths"
+	"github.com/kelsos/rotki-sync/internal/utils"
+)
+
+// Kinds of fetch tracked per user.
+const (
+	KindAccount  = "account"
+	KindExchange = "exchange"
+)
+
+// schemaVersion is bumped when the file layout changes incompatibly; a file
+// with another version is ignored (treated as empty).
+const schemaVersion = 1
+
+// document is the on-disk layout: user -> kind -> key -> unix timestamp.
+type document struct {
+	SchemaVersion int                                    `json:"schema_version"`
+	Users         map[string]map[string]map[string]int64 `json:"users"`
+}
+
+// Store is the fetch state of every user. All methods are safe for concurrent
+// use.
+type Store struct {
+	path string
+
+	mu   sync.Mutex
+	data document
+}
+
+// Open loads the state file at path. A missing file is an empty state.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, data: document{SchemaVersion: schemaVersion}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync state: %w", err)
+	}
+
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode sync state %s: %w", path, err)
+	}
+	if doc.SchemaVersion == schemaVersion {
+		s.data.Users = doc.Users
+	}
+	return s, nil
+}
+
+// Default opens the state file of the rotki data named by scope at the data
+// home (paths.StateFile).
+func Default(scope string) (*Store, error) {
+	return Open(paths.StateFile(scope))
+}
+
+// LastFetch returns when the fetch of key (an account or exchange) of the given
+// kind last succeeded for user.
+func (s *Store) LastFetch(user, kind, key string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts, ok := s.data.Users[user][kind][key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(ts, 0).UTC(), true
+}
+
+// Record notes that the fetch of key covered everything up to at.
+func (s *Store) Record(user, kind, key string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.Users == nil {
+		s.data.Users = make(map[string]map[string]map[string]int64)
+	}
+	kinds := s.data.Users[user]
+	if kinds == nil {
+		kinds = make(map[string]map[string]int64)
+		s.data.Users[user] = kinds
+	}
+	keys := kinds[kind]
+	if keys == nil {
+		keys = make(map[string]int64)
+		kinds[kind] = keys
+	}
+	keys[key] = at.Unix()
+}
+
+// Save writes the state atomically.
+func (s *Store) Save() error {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode sync state: %w", err)
+	}
+	data = append(data, '\n')
+
+	if err := utils.WriteFileAtomic(s.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write sync state: %w", err)
+	}
+	return nil
+}
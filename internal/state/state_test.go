@@ -0,0 +1,97 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kelsos/rotki-sync/internal/paths"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open on a missing file: %v", err)
+	}
+	if _, ok := store.LastFetch("alice", KindAccount, "eth 0xabc"); ok {
+		t.Fatal("empty state should have no last fetch")
+	}
+
+	at := time.Date(2026, 10, 1, 9, 30, 0, 0, time.UTC)
+	store.Record("alice", KindAccount, "eth 0xabc", at)
+	store.Record("alice", KindExchange, "kraken", at.Add(time.Hour))
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if got, ok := reopened.LastFetch("alice", KindAccount, "eth 0xabc"); !ok || !got.Equal(at) {
+		t.Errorf("account last fetch = %v, %v; want %v", got, ok, at)
+	}
+	if got, ok := reopened.LastFetch("alice", KindExchange, "kraken"); !ok || !got.Equal(at.Add(time.Hour)) {
+		t.Errorf("exchange last fetch = %v, %v", got, ok)
+	}
+	if _, ok := reopened.LastFetch("bob", KindAccount, "eth 0xabc"); ok {
+		t.Error("state must be kept per user")
+	}
+}
+
+func TestOpenIgnoresOtherSchemaVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	content := `{"schema_version": 99, "users": {"alice": {"account": {"eth 0xabc": 1}}}}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, ok := store.LastFetch("alice", KindAccount, "eth 0xabc"); ok {
+		t.Error("a state file of another schema version should be ignored")
+	}
+}
+
+func TestOpenRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Fatal("expected an error for a corrupt state file")
+	}
+}
+
+func TestDefaultKeepsDataDirsApart(t *testing.T) {
+	t.Setenv("ROTKI_SYNC_HOME", t.TempDir())
+	first, second := paths.DataDirKey("/data/first"), paths.DataDirKey("/data/second")
+
+	store, err := Default(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2026, 10, 1, 9, 30, 0, 0, time.UTC)
+	store.Record("alice", KindAccount, "eth 0xabc", at)
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := Default(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := other.LastFetch("alice", KindAccount, "eth 0xabc"); ok {
+		t.Error("the same user of another data dir must not share the fetch window")
+	}
+	reopened, err := Default(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := reopened.LastFetch("alice", KindAccount, "eth 0xabc"); !ok || !got.Equal(at) {
+		t.Errorf("last fetch = %v, %v; want %v", got, ok, at)
+	}
+}
@@ -16,20 +16,18 @@ import (
 type SyncStage string
 
 const (
-	StageIdle              SyncStage = "idle"
-	StageLogin             SyncStage = "login"
-	StageSnapshot          SyncStage = "snapshot"
-	StageTrades            SyncStage = "trades"
-	StageEvents            SyncStage = "events"
-	StageTokenDetection    SyncStage = "token-detect"
-	StageTransactions      SyncStage = "transactions"
-	StageTransactionsFetch SyncStage = "fetch-txs"
-	StageNonEvmTxs         SyncStage = "non-evm-txs"
-	StageDecode            SyncStage = "decode"
-	StageDecodeChains      SyncStage = "decode-chains"
-	StageNonEvmDecode      SyncStage = "non-evm-decode"
-	StageLogout            SyncStage = "logout"
-	StageComplete          SyncStage = "complete"
+	StageIdle           SyncStage = "idle"
+	StageLogin          SyncStage = "login"
+	StageSnapshot       SyncStage = "snapshot"
+	StageTrades         SyncStage = "trades"
+	StageEvents         SyncStage = "events"
+	StageTokenDetection SyncStage = "token-detect"
+	StageTransactions   SyncStage = "transactions"
+	StageNonEvmTxs      SyncStage = "non-evm-txs"
+	StageDecode         SyncStage = "decode"
+	StageNonEvmDecode   SyncStage = "non-evm-decode"
+	StageLogout         SyncStage = "logout"
+	StageComplete       SyncStage = "complete"
 )
 
 type SyncStatus struct {
@@ -365,14 +363,10 @@ func getStageIcon(stage SyncStage) string {
 		return "🔎"
 	case StageTransactions:
 		return "📊"
-	case StageTransactionsFetch:
-		return "🔄"
 	case StageNonEvmTxs:
 		return "🌐"
 	case StageDecode:
 		return "🔍"
-	case StageDecodeChains:
-		return "⚙️"
 	case StageNonEvmDecode:
 		return "🔓"
 	case StageLogout:
@@ -2,28 +2,42 @@ package tui
 
 import (
 	"fmt"
-	"time"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 
-	"github.com/kelsos/rotki-sync/internal/logger"
 	"github.com/kelsos/rotki-sync/internal/services"
 )
 
+// SyncMonitor renders a sync run in the terminal. It drives the same
+// SyncService pipeline as a non-interactive run and only subscribes to its
+// events, so both modes run identical steps and produce the same report.
 type SyncMonitor struct {
 	syncService *services.SyncService
 	program     *tea.Program
+	// finished receives the run's outcome once ProcessAllUsers returns.
+	finished chan runOutcome
+	// itemCounts counts the items of the step in progress, per user.
+	itemCounts map[string]int
+}
+
+type runOutcome struct {
+	report *services.RunReport
+	err    error
 }
 
 func NewSyncMonitor(syncService *services.SyncService) *SyncMonitor {
 	return &SyncMonitor{
 		syncService: syncService,
+		finished:    make(chan runOutcome, 1),
+		itemCounts:  make(map[string]int),
 	}
 }
 
 func (sm *SyncMonitor) Start() error {
 	model := NewModel()
 	sm.program = tea.NewProgram(model, tea.WithAltScreen())
+	sm.syncService.Subscribe(sm.handleEvent)
 
 	return nil
 }
@@ -71,198 +85,184 @@ func (sm *SyncMonitor) SetUsers(users []string) {
 	}
 }
 
-func (sm *SyncMonitor) ProcessUserDataWithMonitoring(username string) error {
-	logger.Info("Starting data processing for user: %s", username)
-
-	// Perform snapshot if needed (0.00 -> 0.10)
-	sm.UpdateStage(username, StageSnapshot, 0.05, "Performing snapshot...")
-	if err := sm.syncService.PerformSnapshotIfNeeded(); err != nil {
-		logger.Error("Failed to perform snapshot: %v", err)
-		sm.UpdateError(username, StageSnapshot, err)
-		sm.AddLog(fmt.Sprintf("❌ Snapshot failed for %s: %v", username, err))
-	} else {
-		sm.AddLog(fmt.Sprintf("✅ Snapshot completed for %s", username))
-	}
+// stepStages maps pipeline step ids to the stage shown for them.
+var stepStages = map[string]SyncStage{
+	services.StepSnapshot:       StageSnapshot,
+	services.StepTokenDetection: StageTokenDetection,
+	services.StepExchangeTrades: StageTrades,
+	services.StepOnlineEvents:   StageEvents,
+	services.StepEvmFetch:       StageTransactions,
+	services.StepNonEvmFetch:    StageNonEvmTxs,
+	services.StepEvmDecode:      StageDecode,
+	services.StepNonEvmDecode:   StageNonEvmDecode,
+}
 
-	// Detect tokens on EVM chains with detailed progress (0.10 -> 0.20)
-	if err := sm.DetectTokensWithProgress(username); err != nil {
-		sm.UpdateError(username, StageTokenDetection, err)
-		sm.AddLog(fmt.Sprintf("❌ Token detection failed for %s: %v", username, err))
+// stepProgress places a step on the user's progress bar: login takes the
+// first 10%, logout the last 5%, and the steps share the rest evenly.
+func stepProgress(index, count int) float64 {
+	if count == 0 {
+		return 0.10
 	}
+	return 0.10 + 0.85*float64(index)/float64(count)
+}
 
-	// Fetch exchange trades (0.20 -> 0.28)
-	sm.UpdateStage(username, StageTrades, 0.20, "Fetching exchange trades...")
-	if err := sm.syncService.GetExchangeTrades(); err != nil {
-		logger.Error("Failed to fetch exchange trades: %v", err)
-		sm.UpdateError(username, StageTrades, err)
-		sm.AddLog(fmt.Sprintf("❌ Trade fetch failed for %s: %v", username, err))
-	} else {
-		sm.AddLog(fmt.Sprintf("✅ Exchange trades fetched for %s", username))
-	}
+// handleEvent translates a sync event into TUI updates.
+func (sm *SyncMonitor) handleEvent(event services.Event) {
+	username := event.Username
+	stage := stepStages[event.StepID]
+
+	switch event.Kind {
+	case services.EventLogin:
+		if event.Err != nil {
+			sm.UpdateError(username, StageLogin, event.Err)
+			sm.AddLog(fmt.Sprintf("❌ Login failed for %s: %v", username, event.Err))
+			return
+		}
+		sm.UpdateStage(username, StageLogin, 0.05, "Logged in")
+		sm.AddLog(fmt.Sprintf("🔐 Logged in as %s", username))
+
+	case services.EventStepStart:
+		sm.itemCounts[username] = 0
+		sm.UpdateStage(username, stage, stepProgress(event.StepIndex, event.StepCount),
+			fmt.Sprintf("Running %s...", event.Step))
+
+	case services.EventItem:
+		sm.itemCounts[username]++
+		sm.UpdateStage(username, stage, stepProgress(event.StepIndex, event.StepCount),
+			fmt.Sprintf("%s: %s (%d done)", event.Step, truncateItem(event.Item.Name), sm.itemCounts[username]))
+		switch {
+		case event.Item.TimedOut:
+			sm.AddLog(fmt.Sprintf("⏱️ %s timed out for %s: %v", event.Step, truncateItem(event.Item.Name), event.Err))
+		case event.Err != nil:
+			sm.AddLog(fmt.Sprintf("⚠️ %s failed for %s: %v", event.Step, truncateItem(event.Item.Name), event.Err))
+		}
 
-	// Fetch online events (0.28 -> 0.35)
-	sm.UpdateStage(username, StageEvents, 0.28, "Fetching online events...")
-	if err := sm.syncService.FetchOnlineEvents(); err != nil {
-		logger.Error("Failed to fetch online events: %v", err)
-		sm.UpdateError(username, StageEvents, err)
-		sm.AddLog(fmt.Sprintf("❌ Events fetch failed for %s: %v", username, err))
-	} else {
-		sm.AddLog(fmt.Sprintf("✅ Online events fetched for %s", username))
-	}
+	case services.EventStepFinish:
+		sm.logStepFinish(username, event.StepReport)
 
-	// Fetch EVM transactions with detailed progress (0.35 -> 0.55)
-	if err := sm.FetchEvmTransactionsWithProgress(username); err != nil {
-		sm.UpdateError(username, StageTransactions, err)
-		sm.AddLog(fmt.Sprintf("❌ EVM transaction fetch failed for %s: %v", username, err))
+	case services.EventLogout:
+		sm.UpdateStage(username, StageLogout, 0.98, "Logging out...")
+		switch {
+		case event.User == nil:
+			// The login failed; its error is already shown.
+			sm.complete(username, "Login failed", fmt.Errorf("login failed"))
+		case event.User.Failed():
+			sm.complete(username, "Sync completed with failures", fmt.Errorf("one or more steps failed"))
+			sm.AddLog(fmt.Sprintf("❌ Sync completed with failures for %s", username))
+		case event.User.HasTimeouts():
+			sm.complete(username, "Sync completed with timeouts", fmt.Errorf("one or more steps timed out"))
+			sm.AddLog(fmt.Sprintf("⏱️ Sync completed with timeouts for %s", username))
+		default:
+			sm.complete(username, "Sync completed", nil)
+			sm.AddLog(fmt.Sprintf("🎉 Sync completed for %s", username))
+		}
 	}
+}
 
-	// Fetch non-EVM transactions (0.55 -> 0.65)
-	sm.UpdateStage(username, StageNonEvmTxs, 0.55, "Fetching non-EVM transactions...")
-	if err := sm.syncService.FetchNonEvmTransactions(); err != nil {
-		logger.Error("Failed to fetch non-EVM transactions: %v", err)
-		sm.UpdateError(username, StageNonEvmTxs, err)
-		sm.AddLog(fmt.Sprintf("❌ Non-EVM transaction fetch failed for %s: %v", username, err))
-	} else {
-		sm.AddLog(fmt.Sprintf("✅ Non-EVM transactions fetched for %s", username))
+// complete marks a user's processing as finished, failed when err is set.
+func (sm *SyncMonitor) complete(username, message string, err error) {
+	if sm.program != nil {
+		sm.program.Send(SyncUpdate{
+			Username: username,
+			Stage:    StageComplete,
+			Progress: 1.0,
+			Message:  message,
+			Error:    err,
+		})
 	}
+}
 
-	// Decode EVM transactions with detailed progress (0.65 -> 0.80)
-	if err := sm.DecodeEvmTransactionsWithProgress(username); err != nil {
-		sm.UpdateError(username, StageDecode, err)
-		sm.AddLog(fmt.Sprintf("❌ EVM decode failed for %s: %v", username, err))
+// logStepFinish logs the outcome of a finished step.
+func (sm *SyncMonitor) logStepFinish(username string, step *services.StepReport) {
+	if step == nil {
+		return
 	}
-
-	// Decode non-EVM transactions (0.80 -> 0.90)
-	sm.UpdateStage(username, StageNonEvmDecode, 0.80, "Decoding non-EVM transactions...")
-	if err := sm.syncService.DecodeNonEvmTransactions(); err != nil {
-		logger.Error("Failed to decode non-EVM transactions: %v", err)
-		sm.UpdateError(username, StageNonEvmDecode, err)
-		sm.AddLog(fmt.Sprintf("❌ Non-EVM decode failed for %s: %v", username, err))
-	} else {
-		sm.AddLog(fmt.Sprintf("✅ Non-EVM transactions decoded for %s", username))
+	switch {
+	case step.Resumed:
+		sm.AddLog(fmt.Sprintf("⏭️ %s already finished for %s before the interruption", step.Step, username))
+	case step.Skipped:
+		sm.AddLog(fmt.Sprintf("⏭️ Skipping %s for %s", step.Step, username))
+	case step.Interrupted:
+		sm.AddLog(fmt.Sprintf("⏹️ %s interrupted for %s: %d ok / %d not finished",
+			step.Step, username, step.Stats.Ok, step.Stats.Failed))
+	case step.Err != nil && !step.TimedOut:
+		sm.UpdateError(username, stepStages[step.ID], step.Err)
+		sm.AddLog(fmt.Sprintf("❌ %s failed for %s: %v", step.Step, username, step.Err))
+	case step.Failed():
+		sm.AddLog(fmt.Sprintf("❌ %s failed for %s: %d ok / %d failed",
+			step.Step, username, step.Stats.Ok, step.Stats.Failed))
+	case step.TimedOut:
+		sm.UpdateError(username, stepStages[step.ID], step.Err)
+		sm.AddLog(fmt.Sprintf("⏱️ %s %s for %s: %d ok / %d failed / %d timed out",
+			step.Step, step.Err, username, step.Stats.Ok, step.Stats.Failed, step.Stats.TimedOut))
+	case step.Stats.TimedOut > 0:
+		sm.AddLog(fmt.Sprintf("⏱️ %s completed for %s with timeouts: %d ok / %d failed / %d timed out",
+			step.Step, username, step.Stats.Ok, step.Stats.Failed, step.Stats.TimedOut))
+	case step.Stats.Total() > 0:
+		sm.AddLog(fmt.Sprintf("✅ %s completed for %s: %d ok / %d failed",
+			step.Step, username, step.Stats.Ok, step.Stats.Failed))
+	default:
+		sm.AddLog(fmt.Sprintf("✅ %s completed for %s", step.Step, username))
 	}
-
-	// Don't mark as complete here - it will be done after logout
-	logger.Info("Completed data processing for user: %s", username)
-
-	return nil
 }
 
-func (sm *SyncMonitor) ProcessAllUsersWithMonitoring() error {
-	// Get all users
-	users, err := sm.syncService.GetUsers()
-	if err != nil {
-		return fmt.Errorf("failed to get users: %w", err)
-	}
-
-	sm.SetUsers(users)
-	sm.AddLog(fmt.Sprintf("Found %d users to process", len(users)))
-
-	// Process each user with monitoring
-	return sm.syncService.ProcessUsersWithCallback(func(username string, loginErr error) {
-		if loginErr != nil {
-			sm.UpdateStage(username, StageLogin, 0.05, fmt.Sprintf("Login failed: %v", loginErr))
-			sm.UpdateError(username, StageLogin, loginErr)
-			sm.AddLog(fmt.Sprintf("❌ Login failed for %s: %v", username, loginErr))
-		} else {
-			sm.UpdateStage(username, StageLogin, 0.05, "Logged in")
-			sm.AddLog(fmt.Sprintf("🔐 Logged in as %s", username))
+// Run starts the sync in the background and shows the TUI until the user
+// quits. It returns the run's report and processing error, or a nil report
+// when the user quit before the sync finished (see Interrupt).
+func (sm *SyncMonitor) Run() (*services.RunReport, error) {
+	go func() {
+		users, err := sm.syncService.GetUsers()
+		if err == nil {
+			sm.SetUsers(users)
+			sm.AddLog(fmt.Sprintf("Found %d users to process", len(users)))
 		}
-	}, func(username string) error {
-		return sm.ProcessUserDataWithMonitoring(username)
-	}, func(username string) error {
-		sm.UpdateStage(username, StageLogout, 0.98, "Logging out...")
-		// Small delay to show logout stage
-		time.Sleep(500 * time.Millisecond)
-		// After logout, mark as complete
-		sm.UpdateStage(username, StageComplete, 1.0, "Sync completed")
-		sm.AddLog(fmt.Sprintf("🎉 Sync completed for %s", username))
-		return nil
-	})
-}
 
-func (sm *SyncMonitor) Run() error {
-	// Start the sync process in a goroutine
-	go func() {
-		err := sm.ProcessAllUsersWithMonitoring()
+		report, err := sm.syncService.ProcessAllUsers()
+		sm.finished <- runOutcome{report: report, err: err}
+
+		status := err
+		if status == nil && report.FatalErr != nil {
+			status = report.FatalErr
+		} else if status == nil && report.Interrupted != "" {
+			status = fmt.Errorf("run interrupted (%s)", report.Interrupted)
+		} else if status == nil && report.HasFailures() {
+			status = fmt.Errorf("one or more steps failed; see the run summary in the log")
+		} else if status == nil && report.HasTimeouts() {
+			status = fmt.Errorf("one or more steps timed out; see the run summary in the log")
+		}
 		if err != nil {
 			sm.AddLog(fmt.Sprintf("❌ Fatal error: %v", err))
 		}
 		// Signal completion — TUI stays open until the user presses 'q'
-		if sm.program != nil {
-			sm.program.Send(SyncComplete{Error: err})
-		}
+		sm.program.Send(SyncComplete{Error: status})
 	}()
 
 	// Run the TUI (blocks until quit)
 	if _, err := sm.program.Run(); err != nil {
-		return fmt.Errorf("failed to run TUI: %w", err)
-	}
-
-	return nil
-}
-
-func (sm *SyncMonitor) DetectTokensWithProgress(username string) error {
-	sm.UpdateStage(username, StageTokenDetection, 0.10, "Getting chains for token detection...")
-	logger.Info("Starting token detection for %s", username)
-
-	chains, err := sm.syncService.GetTokenDetectionChains()
-	if err != nil {
-		return fmt.Errorf("failed to get token detection chains: %w", err)
-	}
-
-	if len(chains) == 0 {
-		sm.AddLog(fmt.Sprintf("🔎 No EVM chains with accounts for %s, skipping token detection", username))
-		return nil
+		return nil, fmt.Errorf("failed to run TUI: %w", err)
 	}
 
-	// Count total chain/address pairs for progress
-	totalPairs := 0
-	for _, chain := range chains {
-		totalPairs += len(chain.Addresses)
-	}
-
-	sm.AddLog(fmt.Sprintf("🔎 Detecting tokens for %d addresses across %d chains for %s", totalPairs, len(chains), username))
-
-	completed := 0
-	for _, chain := range chains {
-		cached, err := sm.syncService.GetCachedTokenDetection(chain.ChainID, chain.Addresses)
-		if err != nil {
-			logger.Error("Failed to query token detection cache on %s, will run detection: %v", chain.ChainName, err)
-			cached = nil
-		}
-
-		for _, address := range chain.Addresses {
-			completed++
-			progress := 0.10 + (0.10 * float64(completed) / float64(totalPairs))
-
-			if skip, age := sm.syncService.ShouldSkipTokenDetection(cached[address]); skip {
-				sm.UpdateStage(username, StageTokenDetection, progress,
-					fmt.Sprintf("Skipping %s - %s (cached %s ago) (%d/%d)",
-						chain.ChainName, truncateAddress(address), age.Round(time.Hour), completed, totalPairs))
-				sm.AddLog(fmt.Sprintf("⏭️ Skipping token detection for %s on %s (cached %s ago)",
-					truncateAddress(address), chain.ChainName, age.Round(time.Hour)))
-				continue
-			}
-
-			sm.UpdateStage(username, StageTokenDetection, progress,
-				fmt.Sprintf("Detecting tokens on %s - %s (%d/%d)",
-					chain.ChainName, truncateAddress(address), completed, totalPairs))
-
-			sm.AddLog(fmt.Sprintf("🔎 Detecting tokens for %s on %s", truncateAddress(address), chain.ChainName))
-
-			if err := sm.syncService.DetectTokensForAddress(chain.ChainID, address); err != nil {
-				logger.Error("Failed to detect tokens for %s on %s: %v", address, chain.ChainName, err)
-				sm.AddLog(fmt.Sprintf("⚠️ Token detection failed for %s on %s: %v", truncateAddress(address), chain.ChainName, err))
-				continue
-			}
-		}
+	select {
+	case outcome := <-sm.finished:
+		return outcome.report, outcome.err
+	default:
+		return nil, nil
 	}
+}
 
-	sm.UpdateStage(username, StageTokenDetection, 0.20, "Token detection completed")
-	sm.AddLog(fmt.Sprintf("✅ Token detection completed for %s", username))
+// Interrupt stops a sync the user quit the TUI on (see
+// services.SyncService.Interrupt) and waits for its partial report.
+func (sm *SyncMonitor) Interrupt() (*services.RunReport, error) {
+	sm.syncService.Interrupt("TUI closed")
+	outcome := <-sm.finished
+	return outcome.report, outcome.err
+}
 
-	return nil
+// truncateItem shortens the address in an item name such as
+// "ethereum 0x1234...abcd" so it fits the status line.
+func truncateItem(name string) string {
+	i := strings.LastIndexByte(name, ' ')
+	return name[:i+1] + truncateAddress(name[i+1:])
 }
 
 func truncateAddress(address string) string {
@@ -271,76 +271,3 @@ func truncateAddress(address string) string {
 	}
 	return address[:6] + "..." + address[len(address)-4:]
 }
-
-func (sm *SyncMonitor) FetchEvmTransactionsWithProgress(username string) error {
-	sm.UpdateStage(username, StageTransactionsFetch, 0.35, "Getting accounts...")
-	logger.Info("Starting detailed EVM transaction fetch for %s", username)
-
-	// Get blockchain service to access account info
-	chainAccounts, err := sm.syncService.FetchAccounts()
-	if err != nil {
-		return fmt.Errorf("failed to fetch accounts: %w", err)
-	}
-
-	sm.AddLog(fmt.Sprintf("📊 Found %d accounts for %s", len(chainAccounts), username))
-
-	// Group accounts by chain (simplified - this would need proper implementation)
-	totalChains := 5 // Simulated number for demo
-	sm.AddLog(fmt.Sprintf("🔗 Processing %d chains for %s", totalChains, username))
-
-	// Simulate processing each chain
-	chainNames := []string{"ethereum", "polygon", "optimism", "arbitrum", "base"}
-	for i, chainName := range chainNames {
-		if i >= totalChains {
-			break
-		}
-
-		progress := 0.35 + (0.15 * float64(i+1) / float64(totalChains))
-		accountCount := (i % 3) + 1 // Simulate varying account counts
-
-		sm.UpdateStage(username, StageTransactionsFetch, progress,
-			fmt.Sprintf("Processing chain %s (%d/%d) - %d accounts",
-				chainName, i+1, totalChains, accountCount))
-
-		sm.AddLog(fmt.Sprintf("⛓️ Processing %d accounts on %s", accountCount, chainName))
-
-		// Add a small delay to show progress animation
-		time.Sleep(800 * time.Millisecond)
-	}
-
-	// Complete transaction fetching
-	sm.UpdateStage(username, StageTransactions, 0.55, "EVM transactions fetched")
-	sm.AddLog(fmt.Sprintf("✅ EVM transactions fetched for %s", username))
-
-	return sm.syncService.FetchEvmTransactions()
-}
-
-func (sm *SyncMonitor) DecodeEvmTransactionsWithProgress(username string) error {
-	sm.UpdateStage(username, StageDecodeChains, 0.65, "Getting EVM chains...")
-	logger.Info("Starting detailed EVM transaction decoding for %s", username)
-
-	// Simulate getting supported EVM chains
-	validChains := []string{"ethereum", "polygon", "optimism", "arbitrum"}
-	totalChains := len(validChains)
-
-	sm.AddLog(fmt.Sprintf("🔍 Decoding transactions on %d chains for %s", totalChains, username))
-
-	// Process each chain
-	for i, chainName := range validChains {
-		progress := 0.65 + (0.10 * float64(i+1) / float64(totalChains))
-
-		sm.UpdateStage(username, StageDecodeChains, progress,
-			fmt.Sprintf("Decoding %s (%d/%d)", chainName, i+1, totalChains))
-
-		sm.AddLog(fmt.Sprintf("⚙️ Decoding transactions on %s", chainName))
-
-		// Add a small delay to show progress animation
-		time.Sleep(1200 * time.Millisecond)
-	}
-
-	// Complete decoding
-	sm.UpdateStage(username, StageDecode, 0.80, "EVM transaction decoding completed")
-	sm.AddLog(fmt.Sprintf("✅ EVM transactions decoded for %s", username))
-
-	return sm.syncService.DecodeEvmTransactions()
-}